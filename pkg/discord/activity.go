@@ -0,0 +1,98 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package discord
+
+import "encoding/json"
+
+type ActivityType int
+
+const (
+	ActivityPlaying   ActivityType = 0
+	ActivityStreaming ActivityType = 1
+	ActivityListening ActivityType = 2
+	ActivityWatching  ActivityType = 3
+	ActivityCompeting ActivityType = 5
+)
+
+// StatusDisplayType picks which field Discord shows after "Listening to" in
+// the member list.
+type StatusDisplayType int
+
+const (
+	StatusDisplayName    StatusDisplayType = 0
+	StatusDisplayState   StatusDisplayType = 1
+	StatusDisplayDetails StatusDisplayType = 2
+)
+
+// Activity is a rich presence activity, as sent to Discord.
+type Activity struct {
+	// Name replaces the application's name. Discord only honours it for
+	// some activity types and clients.
+	Name              string            `json:"name,omitempty"`
+	Type              ActivityType      `json:"type"`
+	StatusDisplayType StatusDisplayType `json:"status_display_type,omitempty"`
+
+	Details    string `json:"details,omitempty"`
+	DetailsURL string `json:"details_url,omitempty"`
+	State      string `json:"state,omitempty"`
+	StateURL   string `json:"state_url,omitempty"`
+
+	Timestamps *Timestamps `json:"timestamps,omitempty"`
+	Assets     *Assets     `json:"assets,omitempty"`
+	Party      *Party      `json:"party,omitempty"`
+	// Secrets and Buttons can't be used together; Discord rejects the
+	// activity if both are set.
+	Secrets  *Secrets `json:"secrets,omitempty"`
+	Buttons  []Button `json:"buttons,omitempty"`
+	Instance bool     `json:"instance,omitempty"`
+}
+
+// Timestamps are in Unix milliseconds. Discord counts up from Start, or
+// down to End if it's set.
+type Timestamps struct {
+	Start int64 `json:"start,omitempty"`
+	End   int64 `json:"end,omitempty"`
+}
+
+// Assets are the large and small images, either an asset key from the
+// application or an image URL, with their hover text.
+type Assets struct {
+	LargeImage string `json:"large_image,omitempty"`
+	LargeText  string `json:"large_text,omitempty"`
+	LargeURL   string `json:"large_url,omitempty"`
+	SmallImage string `json:"small_image,omitempty"`
+	SmallText  string `json:"small_text,omitempty"`
+	SmallURL   string `json:"small_url,omitempty"`
+}
+
+// Party is shown after the state as "(Size of Max)".
+type Party struct {
+	ID   string
+	Size int
+	Max  int
+}
+
+func (p Party) MarshalJSON() ([]byte, error) {
+	v := struct {
+		ID   string `json:"id,omitempty"`
+		Size []int  `json:"size,omitempty"`
+	}{ID: p.ID}
+	if p.Size > 0 {
+		v.Size = []int{p.Size, max(p.Max, p.Size)}
+	}
+	return json.Marshal(v)
+}
+
+type Secrets struct {
+	Join     string `json:"join,omitempty"`
+	Spectate string `json:"spectate,omitempty"`
+	Match    string `json:"match,omitempty"`
+}
+
+// Button is a link shown under the presence. Discord allows at most two.
+type Button struct {
+	Label string `json:"label"`
+	URL   string `json:"url"`
+}
@@ -0,0 +1,61 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !windows
+
+package discord
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// sandboxDirs are where Flatpak and Snap builds of Discord put their
+// socket, relative to the runtime directory.
+var sandboxDirs = []string{
+	"",
+	"app/com.discordapp.Discord",
+	".flatpak/com.discordapp.Discord/xdg-run",
+	"snap.discord",
+}
+
+// socketDirs lists the directories Discord may have put its socket in.
+func socketDirs() []string {
+	var bases []string
+	for _, name := range []string{"XDG_RUNTIME_DIR", "TMPDIR", "TMP", "TEMP"} {
+		if dir := os.Getenv(name); dir != "" {
+			bases = append(bases, dir)
+		}
+	}
+	bases = append(bases, fmt.Sprintf("/run/user/%d", os.Getuid()), "/tmp")
+
+	var dirs []string
+	for _, base := range bases {
+		for _, sub := range sandboxDirs {
+			dirs = append(dirs, filepath.Join(base, sub))
+		}
+	}
+	return dirs
+}
+
+// dial connects to the first discord-ipc-N socket that accepts.
+func dial() (io.ReadWriteCloser, error) {
+	for _, dir := range socketDirs() {
+		for i := range 10 {
+			conn, err := dialPath(filepath.Join(dir, fmt.Sprintf("discord-ipc-%d", i)))
+			if err == nil {
+				return conn, nil
+			}
+		}
+	}
+	return nil, errNoDiscord
+}
+
+func dialPath(path string) (io.ReadWriteCloser, error) {
+	return net.DialTimeout("unix", path, 2*time.Second)
+}
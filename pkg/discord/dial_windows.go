@@ -0,0 +1,38 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package discord
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// dial opens the first \\.\pipe\discord-ipc-N pipe that's free.
+func dial() (io.ReadWriteCloser, error) {
+	for i := range 10 {
+		conn, err := dialPath(fmt.Sprintf(`\\.\pipe\discord-ipc-%d`, i))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, errNoDiscord
+}
+
+// dialPath opens a pipe for overlapped I/O, so reads and writes honour
+// deadlines.
+func dialPath(path string) (io.ReadWriteCloser, error) {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := windows.CreateFile(name, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, windows.FILE_FLAG_OVERLAPPED, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
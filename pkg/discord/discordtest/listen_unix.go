@@ -0,0 +1,41 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !windows
+
+package discordtest
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// listen opens a socket named like Discord's in a new temporary directory,
+// which is removed along with it.
+func listen() (listener, string, error) {
+	dir, err := os.MkdirTemp("", "discordtest")
+	if err != nil {
+		return nil, "", err
+	}
+	path := filepath.Join(dir, "discord-ipc-0")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, "", err
+	}
+	return dirListener{netListener{ln}, dir}, path, nil
+}
+
+// dirListener removes its temporary directory once closed.
+type dirListener struct {
+	netListener
+	dir string
+}
+
+func (l dirListener) Close() error {
+	err := l.netListener.Close()
+	os.RemoveAll(l.dir)
+	return err
+}
@@ -0,0 +1,99 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package discordtest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// listen creates a named pipe with a name no real Discord would use.
+func listen() (listener, string, error) {
+	path := fmt.Sprintf(`\\.\pipe\discordtest-%d-%d`, os.Getpid(), time.Now().UnixNano())
+	l := &pipeListener{path: path}
+	// The first instance is created up front so a client can connect as
+	// soon as NewServer returns.
+	h, err := l.create()
+	if err != nil {
+		return nil, "", err
+	}
+	l.next = h
+	return l, path, nil
+}
+
+// pipeListener accepts clients on a named pipe, one pipe instance each.
+type pipeListener struct {
+	path string
+
+	mu     sync.Mutex
+	next   windows.Handle
+	closed bool
+}
+
+func (l *pipeListener) create() (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(l.path)
+	if err != nil {
+		return 0, err
+	}
+	return windows.CreateNamedPipe(name, windows.PIPE_ACCESS_DUPLEX,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT,
+		windows.PIPE_UNLIMITED_INSTANCES, 64<<10, 64<<10, 0, nil)
+}
+
+func (l *pipeListener) Accept() (io.ReadWriteCloser, error) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	h := l.next
+	l.mu.Unlock()
+
+	err := windows.ConnectNamedPipe(h, nil)
+	if err != nil && !errors.Is(err, windows.ERROR_PIPE_CONNECTED) {
+		windows.CloseHandle(h)
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		windows.CloseHandle(h)
+		return nil, net.ErrClosed
+	}
+	if l.next, err = l.create(); err != nil {
+		windows.CloseHandle(h)
+		return nil, err
+	}
+	return os.NewFile(uintptr(h), l.path), nil
+}
+
+// Close stops accepting. A pending Accept is woken by connecting to the
+// waiting instance.
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.mu.Unlock()
+
+	name, err := windows.UTF16PtrFromString(l.path)
+	if err != nil {
+		return err
+	}
+	if h, err := windows.CreateFile(name, windows.GENERIC_READ, 0, nil, windows.OPEN_EXISTING, 0, 0); err == nil {
+		windows.CloseHandle(h)
+	}
+	return nil
+}
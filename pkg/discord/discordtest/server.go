@@ -0,0 +1,259 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package discordtest fakes the Discord client's side of the IPC
+// protocol, for exercising lyra-rpc end to end without Discord. It accepts
+// the handshake and SET_ACTIVITY commands and records every activity it's
+// sent.
+package discordtest
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// Frame opcodes, as in package discord.
+const (
+	opHandshake = 0
+	opFrame     = 1
+	opClose     = 2
+	opPing      = 3
+	opPong      = 4
+)
+
+// Activity is one SET_ACTIVITY command the server received.
+type Activity struct {
+	// Received is when the command arrived.
+	Received time.Time
+	// Payload is the activity as sent, or null when it was cleared.
+	Payload json.RawMessage
+}
+
+// Server listens on a temporary socket, or named pipe on Windows, as the
+// Discord client would. Point a discord.Client's Path at Path to use it.
+type Server struct {
+	Path string
+	// OnActivity, if set, is called with every activity as it arrives. Set
+	// it before anything connects.
+	OnActivity func(Activity)
+
+	ln listener
+
+	mu         sync.Mutex
+	activities []Activity
+	clients    int
+	changed    chan struct{}
+}
+
+// NewServer starts a server on a fresh temporary path.
+func NewServer() (*Server, error) {
+	ln, path, err := listen()
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{Path: path, ln: ln, changed: make(chan struct{})}
+	go s.serve()
+	return s, nil
+}
+
+// Close stops accepting connections and removes the socket.
+func (s *Server) Close() error {
+	return s.ln.Close()
+}
+
+// Activities returns every activity received so far, in order.
+func (s *Server) Activities() []Activity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Activity(nil), s.activities...)
+}
+
+// Connected reports how many clients have completed the handshake and are
+// still connected.
+func (s *Server) Connected() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clients
+}
+
+// Wait blocks until at least n activities have been received, or timeout
+// passes.
+func (s *Server) Wait(n int, timeout time.Duration) ([]Activity, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		activities := append([]Activity(nil), s.activities...)
+		changed := s.changed
+		s.mu.Unlock()
+		if len(activities) >= n {
+			return activities, nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return activities, fmt.Errorf("got %d activities in %s, want %d", len(activities), timeout, n)
+		}
+	}
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle speaks the protocol with one client until it disconnects.
+func (s *Server) handle(conn io.ReadWriteCloser) {
+	defer conn.Close()
+
+	op, payload, err := readFrame(conn)
+	if err != nil {
+		return
+	}
+	var handshake struct {
+		V        int    `json:"v"`
+		ClientID string `json:"client_id"`
+	}
+	if op != opHandshake || json.Unmarshal(payload, &handshake) != nil || handshake.ClientID == "" {
+		writeFrame(conn, opClose, []byte(`{"code":4000,"message":"Invalid handshake"}`))
+		return
+	}
+	ready, _ := json.Marshal(map[string]any{
+		"cmd": "DISPATCH",
+		"evt": "READY",
+		"data": map[string]any{
+			"v":    1,
+			"user": map[string]string{"id": "1", "username": "discordtest"},
+		},
+	})
+	if err := writeFrame(conn, opFrame, ready); err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.clients++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.clients--
+		s.mu.Unlock()
+	}()
+
+	for {
+		op, payload, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+		switch op {
+		case opPing:
+			if err := writeFrame(conn, opPong, payload); err != nil {
+				return
+			}
+		case opClose:
+			return
+		case opFrame:
+			reply, err := s.command(payload)
+			if err != nil {
+				log.Printf("discordtest: %v", err)
+				return
+			}
+			if err := writeFrame(conn, opFrame, reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// command handles a command frame and returns the reply.
+func (s *Server) command(payload []byte) ([]byte, error) {
+	var cmd struct {
+		Cmd   string `json:"cmd"`
+		Nonce string `json:"nonce"`
+		Args  struct {
+			PID      int             `json:"pid"`
+			Activity json.RawMessage `json:"activity"`
+		} `json:"args"`
+	}
+	if err := json.Unmarshal(payload, &cmd); err != nil {
+		return nil, fmt.Errorf("decoding command: %w", err)
+	}
+	if cmd.Cmd != "SET_ACTIVITY" {
+		return json.Marshal(map[string]any{
+			"cmd":   cmd.Cmd,
+			"nonce": cmd.Nonce,
+			"evt":   "ERROR",
+			"data":  map[string]any{"code": 4000, "message": "Unknown command " + cmd.Cmd},
+		})
+	}
+
+	activity := Activity{Received: time.Now(), Payload: cmd.Args.Activity}
+	if len(activity.Payload) == 0 {
+		activity.Payload = json.RawMessage("null")
+	}
+	s.mu.Lock()
+	s.activities = append(s.activities, activity)
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.mu.Unlock()
+	if s.OnActivity != nil {
+		s.OnActivity(activity)
+	}
+
+	return json.Marshal(map[string]any{
+		"cmd":   "SET_ACTIVITY",
+		"nonce": cmd.Nonce,
+		"evt":   nil,
+		"data":  activity.Payload,
+	})
+}
+
+// listener is a net.Listener, or the named pipe equivalent on Windows.
+type listener interface {
+	Accept() (io.ReadWriteCloser, error)
+	Close() error
+}
+
+// netListener adapts a net.Listener.
+type netListener struct {
+	net.Listener
+}
+
+func (l netListener) Accept() (io.ReadWriteCloser, error) {
+	return l.Listener.Accept()
+}
+
+func writeFrame(w io.Writer, op uint32, payload []byte) error {
+	buf := make([]byte, 8+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:], op)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(payload)))
+	copy(buf[8:], payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r io.Reader) (uint32, []byte, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.LittleEndian.Uint32(header[4:])
+	if n > 1<<20 {
+		return 0, nil, fmt.Errorf("frame too large (%d bytes)", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return binary.LittleEndian.Uint32(header[0:]), payload, nil
+}
@@ -0,0 +1,252 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package discord sets a rich presence through the Discord client's local
+// IPC socket, or named pipe on Windows.
+package discord
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Frame opcodes.
+const (
+	opHandshake = 0
+	opFrame     = 1
+	opClose     = 2
+	opPing      = 3
+	opPong      = 4
+)
+
+// maxFrameSize bounds how much a reply may claim to be, so a corrupt
+// length doesn't allocate without limit.
+const maxFrameSize = 1 << 20
+
+// ioTimeout is how long to wait for Discord to answer a frame.
+const ioTimeout = 5 * time.Second
+
+// errNoDiscord is returned when no Discord IPC endpoint could be opened.
+var errNoDiscord = errors.New("couldn't find a running Discord client")
+
+// Error is returned when Discord rejects a command or closes the
+// connection, as when the client ID is unknown.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("discord: %s (code %d)", e.Message, e.Code)
+}
+
+// User is the Discord user the client is logged in as.
+type User struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// Client talks to the local Discord client on behalf of an application.
+// It connects on first use and again after the connection breaks, such as
+// when Discord restarts. It's safe for concurrent use.
+type Client struct {
+	ClientID string
+	// Path, if set, is the socket or named pipe to connect to instead of
+	// looking for one.
+	Path string
+
+	mu   sync.Mutex
+	conn io.ReadWriteCloser
+	user User
+}
+
+func NewClient(clientID string) *Client {
+	return &Client{ClientID: clientID}
+}
+
+// Connect opens the connection and completes the handshake, if it isn't
+// open already.
+func (c *Client) Connect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connect()
+}
+
+func (c *Client) connect() error {
+	if c.conn != nil {
+		return nil
+	}
+	var conn io.ReadWriteCloser
+	var err error
+	if c.Path != "" {
+		conn, err = dialPath(c.Path)
+	} else {
+		conn, err = dial()
+	}
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+
+	handshake, _ := json.Marshal(map[string]any{"v": 1, "client_id": c.ClientID})
+	reply, err := c.roundTrip(opHandshake, handshake)
+	if err != nil {
+		c.close()
+		return fmt.Errorf("discord handshake: %w", err)
+	}
+	var ready struct {
+		Evt  string `json:"evt"`
+		Data struct {
+			User User `json:"user"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(reply, &ready); err != nil || ready.Evt != "READY" {
+		c.close()
+		return fmt.Errorf("discord handshake: unexpected reply %s", reply)
+	}
+	c.user = ready.Data.User
+	return nil
+}
+
+// Connected reports whether the connection is open, as far as the client
+// knows. A connection Discord dropped is only noticed on the next command.
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// User returns the user from the last handshake.
+func (c *Client) User() User {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.user
+}
+
+// SetActivity shows activity on the user's profile, or clears it if
+// activity is nil.
+func (c *Client) SetActivity(activity *Activity) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]any{
+		"cmd":   "SET_ACTIVITY",
+		"nonce": nonce(),
+		"args": map[string]any{
+			"pid":      os.Getpid(),
+			"activity": activity,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	reply, err := c.roundTrip(opFrame, payload)
+	if err != nil {
+		c.close()
+		return err
+	}
+	var resp struct {
+		Evt  string `json:"evt"`
+		Data Error  `json:"data"`
+	}
+	if err := json.Unmarshal(reply, &resp); err != nil {
+		return fmt.Errorf("decoding SET_ACTIVITY reply: %w", err)
+	}
+	if resp.Evt == "ERROR" {
+		return &resp.Data
+	}
+	return nil
+}
+
+// Close closes the connection. Discord clears the activity when it does.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.close()
+}
+
+func (c *Client) close() error {
+	if c.conn == nil {
+		return nil
+	}
+	writeFrame(c.conn, opClose, []byte("{}"))
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// roundTrip sends a frame and returns the payload of the next frame
+// Discord sends back, answering any pings in between.
+func (c *Client) roundTrip(op uint32, payload []byte) ([]byte, error) {
+	if d, ok := c.conn.(interface{ SetDeadline(time.Time) error }); ok {
+		d.SetDeadline(time.Now().Add(ioTimeout))
+		defer d.SetDeadline(time.Time{})
+	}
+	if err := writeFrame(c.conn, op, payload); err != nil {
+		return nil, err
+	}
+	for {
+		op, reply, err := readFrame(c.conn)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case opFrame:
+			return reply, nil
+		case opPing:
+			if err := writeFrame(c.conn, opPong, reply); err != nil {
+				return nil, err
+			}
+		case opClose:
+			var e Error
+			json.Unmarshal(reply, &e)
+			return nil, &e
+		}
+	}
+}
+
+func writeFrame(w io.Writer, op uint32, payload []byte) error {
+	buf := make([]byte, 8+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:], op)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(payload)))
+	copy(buf[8:], payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r io.Reader) (uint32, []byte, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	op := binary.LittleEndian.Uint32(header[0:])
+	n := binary.LittleEndian.Uint32(header[4:])
+	if n > maxFrameSize {
+		return 0, nil, fmt.Errorf("discord frame too large (%d bytes)", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return op, payload, nil
+}
+
+// nonce returns a random UUID to tell replies apart.
+func nonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
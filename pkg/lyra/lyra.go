@@ -0,0 +1,319 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package lyra is a client for the parts of the Lyra music server API that
+// lyra-rpc uses.
+package lyra
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type Playback struct {
+	PlaybackID  int64  `json:"playback_id"`
+	TrackID     int64  `json:"track_id"`
+	UserID      int64  `json:"user_id"`
+	PositionMs  int64  `json:"position_ms"`
+	State       string `json:"state"`
+	ActivityMs  int64  `json:"activity_ms"`
+	UpdatedAtMs int64  `json:"updated_at_ms"`
+	DurationMs  *int64 `json:"duration_ms"`
+}
+
+// EffectivePositionMs estimates the current position from the last
+// position Lyra reported, clamped to the track length.
+func (p *Playback) EffectivePositionMs() int64 {
+	positionMs := p.PositionMs
+	if p.State == "playing" {
+		positionMs += time.Now().UnixMilli() - p.UpdatedAtMs
+	}
+	if p.DurationMs != nil && positionMs > *p.DurationMs {
+		positionMs = *p.DurationMs
+	}
+	return positionMs
+}
+
+type Artist struct {
+	DbID       int64  `json:"db_id"`
+	ArtistName string `json:"artist_name"`
+}
+
+type Album struct {
+	DbID       int64  `json:"db_id"`
+	AlbumTitle string `json:"album_title"`
+	Year       int    `json:"year"`
+}
+
+type Genre struct {
+	DbID      int64  `json:"db_id"`
+	GenreName string `json:"genre_name"`
+}
+
+type Track struct {
+	DbID    int64    `json:"db_id"`
+	Title   string   `json:"title"`
+	Artists []Artist `json:"artists"`
+	Albums  []Album  `json:"albums"`
+	Genres  []Genre  `json:"genres"`
+}
+
+// StatusError is returned when the API answers with an unexpected status.
+type StatusError struct {
+	API    string
+	Status int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned status %d", e.API, e.Status)
+}
+
+// HTTPStatus returns the status code, so callers can tell rate limits and
+// server errors apart without knowing this type.
+func (e *StatusError) HTTPStatus() int {
+	return e.Status
+}
+
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+	// MaxImageBytes is the largest image Image will download; zero means
+	// no limit.
+	MaxImageBytes int64
+	// UserID is whose playback ActivePlayback returns on a shared server.
+	// Zero takes whichever playback Lyra lists first.
+	UserID int64
+	// ImageSize asks Image for variants scaled to this many pixels, with
+	// ?size=N, rather than the original files. Zero asks for originals.
+	ImageSize int
+
+	// sizeUnsupported is set once the server turns the size parameter
+	// down, so later images go straight to the originals.
+	sizeUnsupported atomic.Bool
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), HTTP: http.DefaultClient}
+}
+
+// ActivePlayback returns the playback in progress, or nil if there is none.
+func (c *Client) ActivePlayback() (*Playback, error) {
+	playbacks, err := c.ActivePlaybacks()
+	if err != nil {
+		return nil, err
+	}
+	own, _ := c.split(playbacks)
+	return own, nil
+}
+
+// split picks the client's own playback out of playbacks, returning it
+// and everyone else's.
+func (c *Client) split(playbacks []Playback) (*Playback, []Playback) {
+	own := -1
+	for i, p := range playbacks {
+		if c.UserID != 0 && p.UserID != c.UserID {
+			continue
+		}
+		if own == -1 {
+			own = i
+			if c.UserID == 0 {
+				break
+			}
+			continue
+		}
+		// While crossfading, a user briefly has two playbacks: the track
+		// ending and the one starting. Taking the one starting every time
+		// switches the presence once rather than back and forth.
+		if supersedes(p, playbacks[own]) {
+			own = i
+		}
+	}
+	if own == -1 {
+		return nil, playbacks
+	}
+
+	var others []Playback
+	for i, p := range playbacks {
+		if i != own && (c.UserID == 0 || p.UserID != c.UserID) {
+			others = append(others, p)
+		}
+	}
+	p := playbacks[own]
+	return &p, others
+}
+
+// supersedes reports whether p took over from q: it's playing and q isn't,
+// or both are and p started later.
+func supersedes(p, q Playback) bool {
+	if (p.State == "playing") != (q.State == "playing") {
+		return p.State == "playing"
+	}
+	return p.UpdatedAtMs-p.PositionMs > q.UpdatedAtMs-q.PositionMs
+}
+
+// ActivePlaybacks returns every playback in progress on the server.
+func (c *Client) ActivePlaybacks() ([]Playback, error) {
+	return getList[Playback](c, "playbacks API", "/api/playbacks?active=true")
+}
+
+// maxPages bounds how many pages getList follows, in case a server keeps
+// pointing at the same one.
+const maxPages = 100
+
+// page is the envelope paginated list endpoints wrap their items in. Next
+// is the URL of the following page, absolute or relative to the server,
+// and empty on the last.
+type page[T any] struct {
+	Items []T    `json:"items"`
+	Next  string `json:"next"`
+}
+
+// getList fetches a list endpoint, accepting either a bare JSON array or
+// pages of items in an envelope, and following the pages to the end.
+func getList[T any](c *Client, api, path string) ([]T, error) {
+	var all []T
+	next := c.BaseURL + path
+	for range maxPages {
+		resp, err := c.HTTP.Get(next)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, &StatusError{API: api, Status: resp.StatusCode}
+		}
+
+		body = bytes.TrimSpace(body)
+		if len(body) > 0 && body[0] == '[' {
+			var items []T
+			if err := json.Unmarshal(body, &items); err != nil {
+				return nil, err
+			}
+			return append(all, items...), nil
+		}
+		var p page[T]
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, err
+		}
+		all = append(all, p.Items...)
+		if p.Next == "" {
+			return all, nil
+		}
+		u, err := resp.Request.URL.Parse(p.Next)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid next page %q: %w", api, p.Next, err)
+		}
+		next = u.String()
+	}
+	return nil, fmt.Errorf("%s: more than %d pages", api, maxPages)
+}
+
+// SendCommand asks Lyra to act on a playback: "play", "pause", "stop",
+// "next", or "previous".
+func (c *Client) SendCommand(playbackID int64, command string) error {
+	resp, err := c.HTTP.Post(fmt.Sprintf("%s/api/playbacks/%d/%s", c.BaseURL, playbackID, command), "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return &StatusError{API: "playbacks API", Status: resp.StatusCode}
+	}
+	return nil
+}
+
+// Track fetches a track with the given relations included, e.g. "albums",
+// "artists", or "genres".
+func (c *Client) Track(id int64, inc ...string) (*Track, error) {
+	resp, err := c.HTTP.Get(fmt.Sprintf("%s/api/tracks/%d?inc=%s", c.BaseURL, id, strings.Join(inc, ",")))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{API: "tracks API", Status: resp.StatusCode}
+	}
+
+	var result Track
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func AlbumCoverPath(albumID int64) string {
+	return fmt.Sprintf("/api/albums/%d/cover", albumID)
+}
+
+func ArtistImagePath(artistID int64) string {
+	return fmt.Sprintf("/api/artists/%d/image", artistID)
+}
+
+// Image downloads an image from the given API path, such as
+// AlbumCoverPath, refusing anything over MaxImageBytes. With ImageSize set,
+// it asks for a scaled variant first, falling back to the original if the
+// server doesn't offer one.
+func (c *Client) Image(path string) ([]byte, error) {
+	if c.ImageSize > 0 && !c.sizeUnsupported.Load() {
+		data, err := c.image(fmt.Sprintf("%s?size=%d", path, c.ImageSize))
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.Status < 400 || statusErr.Status > 499 {
+			return data, err
+		}
+		// A 404 may only mean there's no image at all, which the original
+		// path confirms; anything else means sizes aren't supported.
+		data, rawErr := c.image(path)
+		if rawErr == nil {
+			c.sizeUnsupported.Store(true)
+		}
+		return data, rawErr
+	}
+	return c.image(path)
+}
+
+func (c *Client) image(path string) ([]byte, error) {
+	resp, err := c.HTTP.Get(c.BaseURL + path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{API: "image API " + path, Status: resp.StatusCode}
+	}
+
+	maxBytes := c.MaxImageBytes
+	if maxBytes > 0 && resp.ContentLength > maxBytes {
+		return nil, fmt.Errorf("image API %s returned %d bytes, over the limit of %d", path, resp.ContentLength, maxBytes)
+	}
+
+	// Content-Length can be missing or wrong, so also stop reading one byte
+	// past the limit.
+	body := io.Reader(resp.Body)
+	if maxBytes > 0 {
+		body = io.LimitReader(resp.Body, maxBytes+1)
+	}
+
+	var imageData bytes.Buffer
+	if _, err := io.Copy(&imageData, body); err != nil {
+		return nil, err
+	}
+	if maxBytes > 0 && int64(imageData.Len()) > maxBytes {
+		return nil, fmt.Errorf("image API %s returned more than the limit of %d bytes", path, maxBytes)
+	}
+	return imageData.Bytes(), nil
+}
@@ -0,0 +1,171 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyra
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGetList(t *testing.T) {
+	tests := []struct {
+		name  string
+		pages map[string]string
+		want  []int64
+	}{
+		{
+			name:  "bare array",
+			pages: map[string]string{"/list": `[{"track_id": 1}, {"track_id": 2}]`},
+			want:  []int64{1, 2},
+		},
+		{
+			name:  "empty array",
+			pages: map[string]string{"/list": ` [] `},
+			want:  nil,
+		},
+		{
+			name:  "single page envelope",
+			pages: map[string]string{"/list": `{"items": [{"track_id": 3}]}`},
+			want:  []int64{3},
+		},
+		{
+			name: "relative next page",
+			pages: map[string]string{
+				"/list":        `{"items": [{"track_id": 1}], "next": "/list?page=2"}`,
+				"/list?page=2": `{"items": [{"track_id": 2}], "next": "?page=3"}`,
+				"/list?page=3": `{"items": [{"track_id": 3}]}`,
+			},
+			want: []int64{1, 2, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, ok := tt.pages[r.URL.RequestURI()]
+				if !ok {
+					http.NotFound(w, r)
+					return
+				}
+				w.Write([]byte(body))
+			}))
+			defer srv.Close()
+
+			got, err := getList[Playback](NewClient(srv.URL), "test API", "/list")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int64
+			for _, p := range got {
+				ids = append(ids, p.TrackID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("got track IDs %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetListErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+	}{
+		{
+			name:    "status",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusBadGateway) },
+			status:  http.StatusBadGateway,
+		},
+		{
+			name:    "malformed",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{"items": [`)) },
+		},
+		{
+			name: "endless pages",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"items": [], "next": "/list"}`))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			_, err := getList[Playback](NewClient(srv.URL), "test API", "/list")
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			var statusErr *StatusError
+			if tt.status != 0 && (!errors.As(err, &statusErr) || statusErr.Status != tt.status) {
+				t.Errorf("got %v, want status %d", err, tt.status)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name      string
+		userID    int64
+		playbacks []Playback
+		wantOwn   int64
+		wantOther int
+	}{
+		{
+			name:      "no user takes the first",
+			playbacks: []Playback{{PlaybackID: 1, UserID: 5}, {PlaybackID: 2, UserID: 6}},
+			wantOwn:   1,
+			wantOther: 1,
+		},
+		{
+			name:      "user's own",
+			userID:    6,
+			playbacks: []Playback{{PlaybackID: 1, UserID: 5}, {PlaybackID: 2, UserID: 6}},
+			wantOwn:   2,
+			wantOther: 1,
+		},
+		{
+			name:   "crossfade prefers the track starting",
+			userID: 6,
+			playbacks: []Playback{
+				{PlaybackID: 1, UserID: 6, State: "playing", PositionMs: 200_000, UpdatedAtMs: 300_000},
+				{PlaybackID: 2, UserID: 6, State: "playing", PositionMs: 1_000, UpdatedAtMs: 300_000},
+			},
+			wantOwn: 2,
+		},
+		{
+			name:   "playing beats paused",
+			userID: 6,
+			playbacks: []Playback{
+				{PlaybackID: 1, UserID: 6, State: "paused", UpdatedAtMs: 300_000},
+				{PlaybackID: 2, UserID: 6, State: "playing", UpdatedAtMs: 100_000},
+			},
+			wantOwn: 2,
+		},
+		{
+			name:      "none of the user's",
+			userID:    7,
+			playbacks: []Playback{{PlaybackID: 1, UserID: 5}},
+			wantOther: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{UserID: tt.userID}
+			own, others := c.split(tt.playbacks)
+			var ownID int64
+			if own != nil {
+				ownID = own.PlaybackID
+			}
+			if ownID != tt.wantOwn || len(others) != tt.wantOther {
+				t.Errorf("got own %d and %d others, want %d and %d", ownID, len(others), tt.wantOwn, tt.wantOther)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyra
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Update is one observation from a Source: the active playback, nil if
+// nothing is playing, or the error that kept the source from finding out.
+type Update struct {
+	Playback *Playback
+	Err      error
+	// Client is the server Playback is on, where its track and artwork
+	// are looked up. Nil means the caller's usual server.
+	Client *Client
+	// Others are other users' playbacks in progress on the same server,
+	// if the source knows about them.
+	Others []Playback
+}
+
+// Source reports where playback is at. Run sends an Update whenever playback
+// may have changed, until ctx is done or the source fails for good.
+type Source interface {
+	Run(ctx context.Context, updates chan<- Update) error
+}
+
+// Poller is a Source that asks Lyra for the active playback on an interval.
+// Polling several servers, it reports the playback on the first of them
+// that's playing, or failing that, the first that's paused.
+type Poller struct {
+	clients []*Client
+	wake    chan struct{}
+	paused  atomic.Bool
+
+	mu       sync.Mutex
+	interval time.Duration
+}
+
+func NewPoller(client *Client, interval time.Duration) *Poller {
+	return NewMultiPoller([]*Client{client}, interval)
+}
+
+// NewMultiPoller polls every one of clients, in order of priority.
+func NewMultiPoller(clients []*Client, interval time.Duration) *Poller {
+	return &Poller{clients: clients, interval: interval, wake: make(chan struct{}, 1)}
+}
+
+// Wake makes the poller check right away rather than at the next tick.
+func (p *Poller) Wake() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// SetInterval changes how often the poller checks, from the next tick on.
+func (p *Poller) SetInterval(d time.Duration) {
+	p.mu.Lock()
+	p.interval = d
+	p.mu.Unlock()
+}
+
+func (p *Poller) currentInterval() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.interval
+}
+
+// Pause stops the poller from asking Lyra anything until Resume is called.
+func (p *Poller) Pause() {
+	p.paused.Store(true)
+}
+
+// Resume undoes Pause and checks right away.
+func (p *Poller) Resume() {
+	p.paused.Store(false)
+	p.Wake()
+}
+
+func (p *Poller) Run(ctx context.Context, updates chan<- Update) error {
+	interval := p.currentInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if !p.paused.Load() {
+			select {
+			case updates <- p.poll():
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-p.wake:
+		case <-ctx.Done():
+			return nil
+		}
+		if d := p.currentInterval(); d != interval {
+			interval = d
+			ticker.Reset(d)
+		}
+	}
+}
+
+// poll asks every server at once and picks the playback to report. An
+// error is only reported when no server has anything playing.
+func (p *Poller) poll() Update {
+	if len(p.clients) == 1 {
+		return pollClient(p.clients[0])
+	}
+
+	results := make([]Update, len(p.clients))
+	var wg sync.WaitGroup
+	for i, c := range p.clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = pollClient(c)
+			if results[i].Err != nil {
+				results[i].Err = fmt.Errorf("%s: %w", c.BaseURL, results[i].Err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, state := range []string{"playing", "paused"} {
+		for _, r := range results {
+			if r.Playback != nil && r.Playback.State == state {
+				return r
+			}
+		}
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			return r
+		}
+	}
+	return Update{}
+}
+
+func pollClient(c *Client) Update {
+	playbacks, err := c.ActivePlaybacks()
+	if err != nil {
+		return Update{Err: err, Client: c}
+	}
+	own, others := c.split(playbacks)
+	return Update{Playback: own, Client: c, Others: others}
+}
@@ -0,0 +1,65 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"log"
+	"time"
+)
+
+// AlertsConfig configures desktop notifications for when Lyra or Discord
+// stays unreachable, so a presence that silently stopped updating doesn't
+// go unnoticed.
+type AlertsConfig struct {
+	Enabled bool `json:"enabled"`
+	// AfterMin is how many minutes something has to keep failing before
+	// it's alerted on.
+	AfterMin int `json:"after_min"`
+}
+
+// alertInterval is the least time between two alerts for the same
+// failure, so one that keeps coming and going doesn't keep popping up.
+const alertInterval = time.Hour
+
+// checkAlert shows s's desktop alert once it's been failing for long
+// enough.
+func (s *errorSampler) checkAlert(now time.Time, err error) {
+	if s.alert == "" || s.alerted || !config.Alerts.Enabled {
+		return
+	}
+	down := now.Sub(s.since)
+	if down < time.Duration(config.Alerts.AfterMin)*time.Minute {
+		return
+	}
+	if !s.lastAlert.IsZero() && now.Sub(s.lastAlert) < alertInterval {
+		return
+	}
+	// Marked as alerted even if it can't be shown, so a missing
+	// notification service isn't retried on every poll.
+	s.alerted = true
+	s.lastAlert = now
+	body := tr("The presence hasn't updated for %s: %v", down.Round(time.Minute), err)
+	if err := showNotification(s.alert, tr(s.alert), body); err != nil {
+		log.Printf("Error showing desktop alert: %v", err)
+	}
+}
+
+// clearAlert takes s's desktop alert back once it recovers, or where
+// notifications can't be withdrawn, says it's working again.
+func (s *errorSampler) clearAlert() {
+	if !s.alerted {
+		return
+	}
+	s.alerted = false
+	var err error
+	if canWithdrawNotifications {
+		err = withdrawNotification(s.alert)
+	} else {
+		err = showNotification(s.alert, tr(s.alert), tr("Working again."))
+	}
+	if err != nil {
+		debugf("Error clearing desktop alert: %v", err)
+	}
+}
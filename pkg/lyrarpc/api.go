@@ -0,0 +1,207 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// APIConfig serves a local HTTP API exposing what lyra-rpc knows, for
+// scripts, stream decks and other tools on the same machine.
+type APIConfig struct {
+	Enabled bool   `json:"enabled"`
+	Listen  string `json:"listen"`
+	// Token protects the control endpoints, which are only served when
+	// it's set. Send it as "Authorization: Bearer <token>" or ?token=.
+	Token string `json:"token"`
+}
+
+// nowPlayingResponse is the body of GET /nowplaying.
+type nowPlayingResponse struct {
+	Playing    bool     `json:"playing"`
+	State      string   `json:"state,omitempty"`
+	TrackID    int64    `json:"track_id,omitempty"`
+	Title      string   `json:"title,omitempty"`
+	Artist     string   `json:"artist,omitempty"`
+	Artists    []string `json:"artists,omitempty"`
+	AlbumID    int64    `json:"album_id,omitempty"`
+	Album      string   `json:"album,omitempty"`
+	Year       int      `json:"year,omitempty"`
+	ArtworkURL string   `json:"artwork_url,omitempty"`
+	PositionMs int64    `json:"position_ms"`
+	DurationMs int64    `json:"duration_ms,omitempty"`
+}
+
+// apiServer keeps the latest snapshot to answer requests from.
+type apiServer struct {
+	config APIConfig
+	// mastodon, if enabled, can be told to post the current track.
+	mastodon *mastodonSink
+
+	mu      sync.Mutex
+	current *NowPlaying
+}
+
+func newAPIServer(c APIConfig) *apiServer {
+	return &apiServer{config: c}
+}
+
+func (s *apiServer) update(np *NowPlaying) {
+	s.mu.Lock()
+	s.current = np
+	s.mu.Unlock()
+}
+
+func (s *apiServer) snapshot() *NowPlaying {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /nowplaying", s.serveNowPlaying)
+	mux.HandleFunc("GET /healthz", s.serveHealth)
+	if s.config.Token != "" {
+		mux.Handle("GET /status", s.authorized(s.serveStatus))
+		mux.Handle("POST /pause", s.authorized(s.servePause))
+		mux.Handle("POST /resume", s.authorized(s.serveResume))
+		mux.Handle("POST /private", s.authorized(s.servePrivate))
+		mux.Handle("DELETE /private", s.authorized(s.serveEndPrivate))
+		mux.Handle("POST /refresh", s.authorized(s.serveRefresh))
+		mux.Handle("POST /mastodon", s.authorized(s.serveMastodon))
+	}
+	return mux
+}
+
+// authorized rejects requests without the configured token.
+func (s *apiServer) authorized(next http.HandlerFunc) http.Handler {
+	want := []byte("Bearer " + s.config.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get("Authorization")
+		if token := r.URL.Query().Get("token"); token != "" {
+			got = "Bearer " + token
+		}
+		if subtle.ConstantTimeCompare([]byte(got), want) != 1 {
+			writeJSON(w, http.StatusUnauthorized, apiError{Error: "missing or wrong token"})
+			return
+		}
+		next(w, r)
+	})
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func (s *apiServer) serveStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, presenceState.status())
+}
+
+func (s *apiServer) servePause(w http.ResponseWriter, r *http.Request) {
+	presenceState.setPaused(true)
+	writeJSON(w, http.StatusOK, presenceState.status())
+}
+
+func (s *apiServer) serveResume(w http.ResponseWriter, r *http.Request) {
+	presenceState.setPaused(false)
+	writeJSON(w, http.StatusOK, presenceState.status())
+}
+
+// servePrivate starts a private session, for ?duration= (e.g. 1h) if
+// given and otherwise until it's ended with DELETE /private.
+func (s *apiServer) servePrivate(w http.ResponseWriter, r *http.Request) {
+	var d time.Duration
+	if value := r.URL.Query().Get("duration"); value != "" {
+		var err error
+		d, err = time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid duration " + value})
+			return
+		}
+	}
+	presenceState.setPrivate(d)
+	writeJSON(w, http.StatusOK, presenceState.status())
+}
+
+func (s *apiServer) serveEndPrivate(w http.ResponseWriter, r *http.Request) {
+	presenceState.endPrivate()
+	writeJSON(w, http.StatusOK, presenceState.status())
+}
+
+func (s *apiServer) serveRefresh(w http.ResponseWriter, r *http.Request) {
+	presenceState.refresh()
+	writeJSON(w, http.StatusOK, presenceState.status())
+}
+
+func (s *apiServer) serveMastodon(w http.ResponseWriter, r *http.Request) {
+	if s.mastodon == nil {
+		writeJSON(w, http.StatusNotFound, apiError{Error: "mastodon isn't enabled"})
+		return
+	}
+	if err := s.mastodon.trigger(); err != nil {
+		writeJSON(w, http.StatusConflict, apiError{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, presenceState.status())
+}
+
+func (s *apiServer) serveNowPlaying(w http.ResponseWriter, r *http.Request) {
+	resp := nowPlayingResponse{}
+	// The position is worked out at request time so it stays accurate
+	// between polls.
+	if np := s.snapshot(); np != nil {
+		data := newTemplateData(np)
+		resp = nowPlayingResponse{
+			Playing:    true,
+			State:      data.State,
+			TrackID:    data.TrackID,
+			Title:      data.Title,
+			Artist:     data.Artist,
+			Artists:    data.Artists,
+			AlbumID:    data.AlbumID,
+			Album:      data.Album,
+			Year:       data.Year,
+			ArtworkURL: data.ImageURL,
+			PositionMs: data.PositionMs,
+			DurationMs: data.DurationMs,
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// serveHealth answers 200 when everything is working and 503 otherwise,
+// for container healthchecks and uptime monitors.
+func (s *apiServer) serveHealth(w http.ResponseWriter, r *http.Request) {
+	report := presenceState.health()
+	status := http.StatusOK
+	if !report.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *apiServer) start() (*http.Server, error) {
+	ln, err := net.Listen("tcp", s.config.Listen)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	serve(server, ln, "API server")
+	log.Printf("Serving API on http://%s/", s.config.Listen)
+	return server, nil
+}
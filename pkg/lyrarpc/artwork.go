@@ -0,0 +1,78 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+
+	"lyra-rpc/pkg/lyra"
+)
+
+// artworkResult is a track's cover and artist image, as looked up in the
+// background.
+type artworkResult struct {
+	trackID  int64
+	cover    string
+	coverErr error
+	artist   string
+}
+
+// showArtwork sets the images shown for track: the cover, else the artist
+// image, else a placeholder.
+func (e *Engine) showArtwork(track *lyra.Track, cover, artist string, coverErr error) {
+	e.cachedArtistImage = artist
+	e.coverPending = isRetryable(coverErr)
+	switch {
+	case cover != "":
+		e.cachedImage = cover
+	case artist != "":
+		e.cachedImage = artist
+	default:
+		e.cachedImage = placeholderImage(track, coverErr)
+	}
+}
+
+// lookUpArtwork finds track's cover and artist image off the main loop, as
+// uploading them can take a while, and pokes it once they're in.
+func (e *Engine) lookUpArtwork(track *lyra.Track) {
+	e.artworkFor = track.DbID
+	go func() {
+		result := artworkResult{trackID: track.DbID}
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Error looking up artwork: %v\n%s", r, debug.Stack())
+				result = artworkResult{trackID: track.DbID, coverErr: fmt.Errorf("%v", r)}
+			}
+			e.artworkMu.Lock()
+			e.artwork = append(e.artwork, result)
+			e.artworkMu.Unlock()
+			presenceState.poke()
+		}()
+		concurrently(
+			func() { result.cover, result.coverErr = resolveCover(track) },
+			func() { result.artist = resolveArtistImage(track) },
+		)
+	}()
+}
+
+// takeArtwork shows the artwork looked up for trackID, if it's come in
+// since the last update. Artwork for any other track is dropped.
+func (e *Engine) takeArtwork(trackID int64) {
+	e.artworkMu.Lock()
+	results := e.artwork
+	e.artwork = nil
+	e.artworkMu.Unlock()
+
+	for _, result := range results {
+		if result.trackID == e.artworkFor {
+			e.artworkFor = 0
+		}
+		if result.trackID == trackID && e.cachedTrack != nil && e.cachedTrack.DbID == trackID {
+			e.showArtwork(e.cachedTrack, result.cover, result.artist, result.coverErr)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import "strconv"
+
+// AssetKeys maps albums and artists, by ID, to art assets uploaded to the
+// Discord application in discord_application_id, so their artwork is
+// served by Discord instead of being uploaded elsewhere.
+type AssetKeys struct {
+	Albums  map[string]string `json:"albums"`
+	Artists map[string]string `json:"artists"`
+}
+
+// discordAppID is the Discord application the presence is shown as.
+func discordAppID() string {
+	if config.DiscordApplicationID != "" {
+		return config.DiscordApplicationID
+	}
+	return discordClientID
+}
+
+// assetKey looks id up in keys. Asset keys only mean something to the
+// application they were uploaded to, so there are none without a custom
+// one.
+func assetKey(keys map[string]string, id int64) (string, bool) {
+	if config.DiscordApplicationID == "" {
+		return "", false
+	}
+	key, ok := keys[strconv.FormatInt(id, 10)]
+	return key, ok && key != ""
+}
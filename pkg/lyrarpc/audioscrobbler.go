@@ -0,0 +1,187 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AudioscrobblerConfig targets a server speaking the legacy Audioscrobbler
+// 1.2 submission protocol, such as Libre.fm or a self-hosted GNU FM.
+type AudioscrobblerConfig struct {
+	Enabled      bool   `json:"enabled"`
+	HandshakeURL string `json:"handshake_url"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	ClientID     string `json:"client_id"`
+}
+
+// audioscrobblerError is a failure reported in a protocol response.
+// Handshake failures keep queued listens; rejected submissions don't.
+type audioscrobblerError struct {
+	response  string
+	transient bool
+}
+
+func (e *audioscrobblerError) Error() string {
+	return "audioscrobbler server responded " + e.response
+}
+
+func (e *audioscrobblerError) retryable() bool { return e.transient }
+
+type audioscrobblerScrobbler struct {
+	config AudioscrobblerConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	sessionID     string
+	nowPlayingURL string
+	submissionURL string
+}
+
+func newAudioscrobblerScrobbler(c AudioscrobblerConfig) *audioscrobblerScrobbler {
+	if c.HandshakeURL == "" {
+		c.HandshakeURL = "https://turtle.libre.fm/"
+	}
+	if c.ClientID == "" {
+		c.ClientID = "lrp"
+	}
+	return &audioscrobblerScrobbler{config: c, client: newHTTPClient(15 * time.Second)}
+}
+
+func (s *audioscrobblerScrobbler) name() string { return "audioscrobbler" }
+
+// handshake opens a session, authenticating with the token scheme:
+// md5(md5(password) + timestamp).
+func (s *audioscrobblerScrobbler) handshake() error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	passwordHash := md5.Sum([]byte(s.config.Password))
+	token := md5.Sum([]byte(hex.EncodeToString(passwordHash[:]) + timestamp))
+
+	query := url.Values{}
+	query.Set("hs", "true")
+	query.Set("p", "1.2.1")
+	query.Set("c", s.config.ClientID)
+	query.Set("v", "1.0")
+	query.Set("u", s.config.Username)
+	query.Set("t", timestamp)
+	query.Set("a", hex.EncodeToString(token[:]))
+
+	sep := "?"
+	if strings.Contains(s.config.HandshakeURL, "?") {
+		sep = "&"
+	}
+	resp, err := s.client.Get(s.config.HandshakeURL + sep + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{api: "audioscrobbler handshake", status: resp.StatusCode}
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, 4096))
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSpace(scanner.Text()))
+	}
+	if len(lines) < 4 || lines[0] != "OK" {
+		status := "an empty response"
+		if len(lines) > 0 {
+			status = lines[0]
+		}
+		return &audioscrobblerError{response: status, transient: true}
+	}
+
+	s.sessionID, s.nowPlayingURL, s.submissionURL = lines[1], lines[2], lines[3]
+	return nil
+}
+
+// post sends form to the URL chosen by endpoint, handshaking first if
+// needed and once more if the server has forgotten the session.
+func (s *audioscrobblerScrobbler) post(endpoint func() string, form url.Values) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if s.sessionID == "" {
+			if err := s.handshake(); err != nil {
+				return err
+			}
+		}
+		form.Set("s", s.sessionID)
+
+		resp, err := s.client.PostForm(endpoint(), form)
+		if err != nil {
+			return err
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return &statusError{api: "audioscrobbler API", status: resp.StatusCode}
+		}
+
+		status := strings.TrimSpace(strings.SplitN(string(body), "\n", 2)[0])
+		switch {
+		case status == "OK":
+			return nil
+		case status == "BADSESSION" && attempt == 0:
+			s.sessionID = ""
+		case status == "BADSESSION":
+			return &audioscrobblerError{response: status, transient: true}
+		default:
+			return &audioscrobblerError{response: status}
+		}
+	}
+}
+
+func (s *audioscrobblerScrobbler) nowPlaying(l listen) error {
+	form := url.Values{}
+	form.Set("a", l.artist())
+	form.Set("t", l.Title)
+	form.Set("b", l.Album)
+	form.Set("l", durationSeconds(l))
+	form.Set("n", "")
+	form.Set("m", "")
+	return s.post(func() string { return s.nowPlayingURL }, form)
+}
+
+func (s *audioscrobblerScrobbler) scrobble(batch []listen) error {
+	form := url.Values{}
+	for i, l := range batch {
+		field := func(name string) string { return fmt.Sprintf("%s[%d]", name, i) }
+		form.Set(field("a"), l.artist())
+		form.Set(field("t"), l.Title)
+		form.Set(field("i"), strconv.FormatInt(l.StartedAt.Unix(), 10))
+		form.Set(field("o"), "P")
+		form.Set(field("r"), "")
+		form.Set(field("l"), durationSeconds(l))
+		form.Set(field("b"), l.Album)
+		form.Set(field("n"), "")
+		form.Set(field("m"), "")
+	}
+	return s.post(func() string { return s.submissionURL }, form)
+}
+
+func durationSeconds(l listen) string {
+	if l.DurationMs <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(l.DurationMs/1000, 10)
+}
@@ -0,0 +1,27 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import "fmt"
+
+// runAutostartCommand registers lyra-rpc to start at login, or stops it
+// from doing so, without setting it up as a supervised service.
+func runAutostartCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: lyra-rpc autostart enable|disable")
+	}
+	opts, err := newServiceOptions(true)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "enable":
+		return enableAutostart(opts)
+	case "disable":
+		return disableAutostart()
+	default:
+		return fmt.Errorf("usage: lyra-rpc autostart enable|disable")
+	}
+}
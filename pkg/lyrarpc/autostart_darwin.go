@@ -0,0 +1,40 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// autostartLabel is separate from the service's, so enabling one doesn't
+// replace the other.
+const autostartLabel = launchAgentLabel + ".autostart"
+
+// enableAutostart writes a launch agent that starts lyra-rpc at login but,
+// unlike `lyra-rpc service install`, doesn't start it now or restart it.
+func enableAutostart(opts serviceOptions) error {
+	if _, err := writeLaunchAgent(autostartLabel, opts, false); err != nil {
+		return err
+	}
+	log.Println("lyra-rpc will start at login.")
+	return nil
+}
+
+func disableAutostart() error {
+	path, err := launchAgentPath(autostartLabel)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("autostart isn't enabled")
+		}
+		return err
+	}
+	log.Printf("Removed %s", path)
+	return nil
+}
@@ -0,0 +1,68 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// autostartPath is a shortcut in the user's Startup folder. A shortcut
+// rather than a Run key, since it can set the working directory that
+// config.json is read from.
+func autostartPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "Microsoft", "Windows", "Start Menu", "Programs", "Startup", "lyra-rpc.lnk"), nil
+}
+
+func enableAutostart(opts serviceOptions) error {
+	path, err := autostartPath()
+	if err != nil {
+		return err
+	}
+	// Shortcuts can only be written through COM, which PowerShell makes
+	// easy. WindowStyle 7 starts the console minimized.
+	script := fmt.Sprintf(`$s = (New-Object -ComObject WScript.Shell).CreateShortcut(%s)
+$s.TargetPath = %s
+$s.WorkingDirectory = %s
+$s.WindowStyle = 7
+$s.Description = 'Lyra Discord Rich Presence'
+$s.Save()`, powershellQuote(path), powershellQuote(opts.executable), powershellQuote(opts.workDir))
+
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("creating startup shortcut: %w", err)
+	}
+	log.Printf("lyra-rpc will start at login. Created %s", path)
+	return nil
+}
+
+func disableAutostart() error {
+	path, err := autostartPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("autostart isn't enabled")
+		}
+		return err
+	}
+	log.Printf("Removed %s", path)
+	return nil
+}
+
+func powershellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,77 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !windows && !darwin
+
+package lyrarpc
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// autostartPath is the XDG autostart entry desktop environments launch at
+// login.
+func autostartPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "autostart", "lyra-rpc.desktop"), nil
+}
+
+func enableAutostart(opts serviceOptions) error {
+	path, err := autostartPath()
+	if err != nil {
+		return err
+	}
+	entry := fmt.Sprintf(`[Desktop Entry]
+Type=Application
+Name=Lyra Discord Rich Presence
+Comment=Shows what's playing on Lyra in Discord
+Exec=%s
+Path=%s
+Terminal=false
+X-GNOME-Autostart-enabled=true
+`, desktopExec(opts.executable), desktopEscape(opts.workDir))
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(entry), 0o644); err != nil {
+		return err
+	}
+	log.Printf("lyra-rpc will start at login. Wrote %s", path)
+	return nil
+}
+
+func disableAutostart() error {
+	path, err := autostartPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("autostart isn't enabled")
+		}
+		return err
+	}
+	log.Printf("Removed %s", path)
+	return nil
+}
+
+// desktopExec quotes a program for the Exec key, as the desktop entry spec
+// asks for arguments with spaces or other reserved characters.
+func desktopExec(program string) string {
+	quoted := strings.NewReplacer(`"`, `\"`, "`", "\\`", `$`, `\$`, `\`, `\\`).Replace(program)
+	return strings.ReplaceAll(desktopEscape(`"`+quoted+`"`), "%", "%%")
+}
+
+// desktopEscape escapes a desktop entry string value.
+func desktopEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\t", `\t`).Replace(s)
+}
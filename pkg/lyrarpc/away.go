@@ -0,0 +1,57 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// AwayConfig hides the presence while the user is away from the computer,
+// even if music keeps playing on a speaker elsewhere.
+type AwayConfig struct {
+	Enabled bool `json:"enabled"`
+	// IdleMin is how many minutes without keyboard or mouse input count
+	// as away. Zero only goes by the screen lock.
+	IdleMin int `json:"idle_min"`
+	// WhenLocked also counts a locked screen as away, however recently
+	// it was used.
+	WhenLocked bool `json:"when_locked"`
+}
+
+// awayCheckInterval is how often idle time and the screen lock are checked.
+const awayCheckInterval = 15 * time.Second
+
+// watchAway hides the presence whenever the user is away, until ctx is
+// done.
+func watchAway(ctx context.Context, c AwayConfig) {
+	ticker := time.NewTicker(backgroundInterval(awayCheckInterval))
+	defer ticker.Stop()
+	away := false
+	for {
+		idle, locked, err := userActivity()
+		if err != nil {
+			log.Printf("Error checking whether you're away, the presence won't be hidden when idle: %v", err)
+			return
+		}
+		now := (c.WhenLocked && locked) || (c.IdleMin > 0 && idle >= time.Duration(c.IdleMin)*time.Minute)
+		if now != away {
+			away = now
+			if away {
+				log.Println(tr("Away from the computer, hiding the presence."))
+			} else {
+				log.Println(tr("Back at the computer, showing the presence again."))
+			}
+			presenceState.setAway(away)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
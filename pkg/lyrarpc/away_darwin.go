@@ -0,0 +1,37 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// hidIdleTime matches IOHIDSystem's HIDIdleTime, in nanoseconds, in
+// ioreg's output.
+var hidIdleTime = regexp.MustCompile(`"HIDIdleTime" = (\d+)`)
+
+// userActivity reports how long it's been since the last keyboard or mouse
+// input, as IOKit's HID system counts it. ioreg reads it without needing
+// cgo. The screen lock can't be read that way, so it's never reported as
+// locked; the idle time covers a Mac left locked all the same.
+func userActivity() (time.Duration, bool, error) {
+	out, err := exec.Command("ioreg", "-c", "IOHIDSystem", "-d", "4").Output()
+	if err != nil {
+		return 0, false, fmt.Errorf("running ioreg: %w", err)
+	}
+	m := hidIdleTime.FindSubmatch(out)
+	if m == nil {
+		return 0, false, fmt.Errorf("no HIDIdleTime in ioreg's output")
+	}
+	ns, err := strconv.ParseInt(string(m[1]), 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return time.Duration(ns), false, nil
+}
@@ -0,0 +1,60 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build linux
+
+package lyrarpc
+
+import (
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// logindSession is the user's graphical session, which logind resolves
+// even for callers outside of it, such as a systemd user service.
+const logindSession = "/org/freedesktop/login1/session/auto"
+
+// userActivity reports how long the session has been idle and whether its
+// screen is locked. The lock comes from logind, which desktop environments
+// keep up to date. Idle time comes from GNOME's idle monitor where there is
+// one, and otherwise logind's idle hint, which is coarser.
+func userActivity() (time.Duration, bool, error) {
+	system, err := dbus.SystemBus()
+	if err != nil {
+		return 0, false, err
+	}
+	session := system.Object("org.freedesktop.login1", logindSession)
+	lockedHint, err := session.GetProperty("org.freedesktop.login1.Session.LockedHint")
+	if err != nil {
+		return 0, false, err
+	}
+	locked, _ := lockedHint.Value().(bool)
+
+	if bus, err := dbus.SessionBus(); err == nil {
+		var ms uint64
+		err := bus.Object("org.gnome.Mutter.IdleMonitor", "/org/gnome/Mutter/IdleMonitor/Core").
+			Call("org.gnome.Mutter.IdleMonitor.GetIdletime", 0).Store(&ms)
+		if err == nil {
+			return time.Duration(ms) * time.Millisecond, locked, nil
+		}
+	}
+
+	idleHint, err := session.GetProperty("org.freedesktop.login1.Session.IdleHint")
+	if err != nil {
+		return 0, locked, err
+	}
+	if idle, _ := idleHint.Value().(bool); !idle {
+		return 0, locked, nil
+	}
+	sinceHint, err := session.GetProperty("org.freedesktop.login1.Session.IdleSinceHint")
+	if err != nil {
+		return 0, locked, err
+	}
+	since, _ := sinceHint.Value().(uint64)
+	if since == 0 {
+		return 0, locked, nil
+	}
+	return time.Since(time.UnixMicro(int64(since))), locked, nil
+}
@@ -0,0 +1,16 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !linux && !darwin && !windows
+
+package lyrarpc
+
+import (
+	"fmt"
+	"time"
+)
+
+func userActivity() (time.Duration, bool, error) {
+	return 0, false, fmt.Errorf("idle detection isn't supported on this platform")
+}
@@ -0,0 +1,51 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	user32               = windows.NewLazySystemDLL("user32.dll")
+	procGetLastInputInfo = user32.NewProc("GetLastInputInfo")
+	procOpenInputDesktop = user32.NewProc("OpenInputDesktop")
+	procCloseDesktop     = user32.NewProc("CloseDesktop")
+	procGetTickCount     = kernel32.NewProc("GetTickCount")
+)
+
+// lastInputInfo is LASTINPUTINFO.
+type lastInputInfo struct {
+	size uint32
+	time uint32
+}
+
+// desktopSwitchDesktop is DESKTOP_SWITCHDESKTOP, the access needed to tell
+// whether the input desktop is the user's.
+const desktopSwitchDesktop = 0x0100
+
+// userActivity reports how long it's been since the last keyboard or mouse
+// input, and whether the workstation is locked, which shows as the input
+// desktop no longer being one lyra-rpc can open.
+func userActivity() (time.Duration, bool, error) {
+	info := lastInputInfo{size: uint32(unsafe.Sizeof(lastInputInfo{}))}
+	if ok, _, err := procGetLastInputInfo.Call(uintptr(unsafe.Pointer(&info))); ok == 0 {
+		return 0, false, err
+	}
+	// Both are in milliseconds since boot and wrap around together, so
+	// the unsigned difference stays right.
+	now, _, _ := procGetTickCount.Call()
+	idle := time.Duration(uint32(now)-info.time) * time.Millisecond
+
+	desktop, _, _ := procOpenInputDesktop.Call(0, 0, desktopSwitchDesktop)
+	if desktop == 0 {
+		return idle, true, nil
+	}
+	procCloseDesktop.Call(desktop)
+	return idle, false, nil
+}
@@ -0,0 +1,80 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// BatteryConfig eases off while a laptop runs on battery power.
+type BatteryConfig struct {
+	Enabled bool `json:"enabled"`
+	// PollMultiplier stretches poll_interval_sec while on battery.
+	PollMultiplier float64 `json:"poll_multiplier"`
+	// DeferUploads puts off uploading artwork until back on AC power,
+	// showing cached artwork or the placeholder in the meantime.
+	DeferUploads bool `json:"defer_uploads"`
+}
+
+// batteryCheckInterval is how often the power source is checked.
+const batteryCheckInterval = 30 * time.Second
+
+// onBattery is set while the machine runs on battery and battery is
+// enabled.
+var onBattery atomic.Bool
+
+// errUploadDeferred is returned instead of uploading while uploads are put
+// off on battery. It's retried like a transient failure, so the artwork is
+// uploaded once back on AC power.
+var errUploadDeferred = uploadDeferredError{}
+
+type uploadDeferredError struct{}
+
+func (uploadDeferredError) Error() string   { return "upload deferred while on battery power" }
+func (uploadDeferredError) retryable() bool { return true }
+
+// uploadsDeferred reports whether uploads should wait for AC power.
+func uploadsDeferred() bool {
+	return config.Battery.DeferUploads && onBattery.Load()
+}
+
+// watchBattery follows the power source until ctx is done, stretching the
+// poll interval of source, if it can be changed, while on battery.
+func watchBattery(ctx context.Context, c BatteryConfig, source any) {
+	poller, _ := source.(interface{ SetInterval(time.Duration) })
+	normal := time.Duration(config.PollIntervalSec) * time.Second
+
+	ticker := time.NewTicker(backgroundInterval(batteryCheckInterval))
+	defer ticker.Stop()
+	for {
+		battery, err := onBatteryPower()
+		if err != nil {
+			log.Printf("Error checking the power source, polling won't slow down on battery: %v", err)
+			return
+		}
+		if battery != onBattery.Load() {
+			onBattery.Store(battery)
+			interval := normal
+			if battery {
+				interval = time.Duration(float64(normal) * max(c.PollMultiplier, 1))
+				log.Print(tr("On battery power, polling every %s.", interval))
+			} else {
+				log.Print(tr("On AC power, polling every %s.", interval))
+			}
+			if poller != nil {
+				poller.SetInterval(interval)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
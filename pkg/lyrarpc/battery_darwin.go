@@ -0,0 +1,21 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+)
+
+// onBatteryPower reports whether pmset says the Mac is drawing from its
+// battery.
+func onBatteryPower() (bool, error) {
+	out, err := exec.Command("pmset", "-g", "batt").Output()
+	if err != nil {
+		return false, fmt.Errorf("running pmset: %w", err)
+	}
+	return bytes.Contains(out, []byte("'Battery Power'")), nil
+}
@@ -0,0 +1,41 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build linux
+
+package lyrarpc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const powerSupplyDir = "/sys/class/power_supply"
+
+// onBatteryPower reports whether a system battery is discharging. Batteries
+// in devices such as wireless mice have a device scope, and are skipped.
+func onBatteryPower() (bool, error) {
+	entries, err := os.ReadDir(powerSupplyDir)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	read := func(supply, name string) string {
+		b, _ := os.ReadFile(filepath.Join(powerSupplyDir, supply, name))
+		return strings.TrimSpace(string(b))
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if read(name, "type") != "Battery" || read(name, "scope") == "Device" {
+			continue
+		}
+		if read(name, "status") == "Discharging" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,13 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !linux && !darwin && !windows
+
+package lyrarpc
+
+import "fmt"
+
+func onBatteryPower() (bool, error) {
+	return false, fmt.Errorf("power source detection isn't supported on this platform")
+}
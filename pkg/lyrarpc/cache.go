@@ -0,0 +1,484 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lyra-rpc/pkg/lyra"
+)
+
+// trackCacheTTL is how long fetched track metadata is reused before asking
+// Lyra again.
+const trackCacheTTL = 24 * time.Hour
+
+// litterboxExpiry is how long litterbox keeps uploads, minus a margin so a
+// cached URL is never handed to Discord right as it disappears.
+const litterboxExpiry = 71 * time.Hour
+
+// CacheConfig sets where cached artwork lives and how much disk it may
+// take up.
+type CacheConfig struct {
+	// Dir holds the URL cache and cover files, such as those the image
+	// proxy serves. Empty uses the cache directory.
+	Dir string `json:"dir"`
+	// MaxBytes caps the disk they take up together. Past it, the least
+	// recently served covers are removed first, then the oldest cache
+	// entries. Zero means no limit.
+	MaxBytes int64 `json:"max_bytes"`
+}
+
+type cacheEntry struct {
+	URL       string    `json:"url"`
+	CachedAt  time.Time `json:"cached_at"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+type trackCacheEntry struct {
+	Track    *lyra.Track `json:"track"`
+	CachedAt time.Time   `json:"cached_at"`
+}
+
+// persistentCache remembers uploaded image URLs and track metadata across
+// restarts. The file is re-read whenever another process (such as the
+// cache subcommands) changes it.
+type persistentCache struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+
+	Images map[string]cacheEntry     `json:"images"`
+	Tracks map[int64]trackCacheEntry `json:"tracks"`
+}
+
+var cache = &persistentCache{}
+
+func imageKey(kind string, id int64) string {
+	return fmt.Sprintf("%s:%d", kind, id)
+}
+
+// cacheDir is where lyra-rpc keeps everything it persists between runs.
+func cacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lyra-rpc"), nil
+}
+
+// artworkCacheDir is where the URL cache and cover files are kept.
+func artworkCacheDir() (string, error) {
+	if config.Cache.Dir != "" {
+		return config.Cache.Dir, nil
+	}
+	return cacheDir()
+}
+
+func defaultCachePath() (string, error) {
+	dir, err := artworkCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cache.json"), nil
+}
+
+// open points the cache at path and loads whatever is already there.
+func (c *persistentCache) open(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.path = path
+	c.modTime = time.Time{}
+	c.Images, c.Tracks = nil, nil
+	return c.reload()
+}
+
+// reload re-reads the cache file if it changed since it was last read or
+// written. A missing file is an empty cache.
+func (c *persistentCache) reload() error {
+	if c.Images == nil {
+		c.Images = map[string]cacheEntry{}
+		c.Tracks = map[int64]trackCacheEntry{}
+	}
+	if c.path == "" {
+		return nil
+	}
+
+	info, err := os.Stat(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(c.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+	c.Images = map[string]cacheEntry{}
+	c.Tracks = map[int64]trackCacheEntry{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("reading cache %s: %w", c.path, err)
+	}
+	c.modTime = info.ModTime()
+	return nil
+}
+
+func (c *persistentCache) save() error {
+	if c.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if config.Cache.MaxBytes > 0 {
+		if data, err = c.fitLocked(data, config.Cache.MaxBytes); err != nil {
+			return err
+		}
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(c.path); err == nil {
+		c.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// fitLocked keeps data, the encoded cache, and the cover files within
+// budget bytes between them. Covers go first, least recently served first,
+// along with the entries pointing at them; then the oldest entries. It
+// returns the cache encoded again if anything was removed from it.
+func (c *persistentCache) fitLocked(data []byte, budget int64) ([]byte, error) {
+	covers := listCoverFiles()
+	coverBytes := int64(0)
+	for _, f := range covers {
+		coverBytes += f.size
+	}
+
+	changed := false
+	for len(covers) > 0 && int64(len(data))+coverBytes > budget {
+		f := covers[0]
+		covers = covers[1:]
+		if err := os.Remove(f.path); err != nil {
+			log.Printf("Error removing cached cover: %v", err)
+			continue
+		}
+		coverBytes -= f.size
+		name := "/cover/" + filepath.Base(f.path)
+		for key, entry := range c.Images {
+			if strings.HasSuffix(entry.URL, name) {
+				delete(c.Images, key)
+				changed = true
+			}
+		}
+		debugf("Removed cached cover %s to stay within the cache budget", f.path)
+	}
+
+	// Entries are dropped by their encoded size, and the cache encoded
+	// once more at the end, rather than encoding it after each one.
+	over := int64(len(data)) + coverBytes - budget
+	if over > 0 {
+		type aged struct {
+			key      string
+			track    int64
+			cachedAt time.Time
+		}
+		var entries []aged
+		for key, e := range c.Images {
+			entries = append(entries, aged{key: key, cachedAt: e.CachedAt})
+		}
+		for id, e := range c.Tracks {
+			entries = append(entries, aged{track: id, cachedAt: e.CachedAt})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].cachedAt.Before(entries[j].cachedAt) })
+		for _, e := range entries {
+			if over <= 0 {
+				break
+			}
+			var entry []byte
+			if e.key != "" {
+				entry, _ = json.MarshalIndent(c.Images[e.key], "    ", "  ")
+				over -= int64(len(entry) + len(e.key))
+				delete(c.Images, e.key)
+			} else {
+				entry, _ = json.MarshalIndent(c.Tracks[e.track], "    ", "  ")
+				over -= int64(len(entry) + 20)
+				delete(c.Tracks, e.track)
+			}
+			changed = true
+		}
+		if over > 0 {
+			log.Printf("The cache can't fit in max_bytes (%d); it's over by %d bytes", budget, over)
+		}
+	}
+
+	if !changed {
+		return data, nil
+	}
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// coverFile is a cached cover on disk.
+type coverFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// listCoverFiles lists the cover files the image proxy serves, least
+// recently served first.
+func listCoverFiles() []coverFile {
+	dir, err := proxyDir()
+	if err != nil {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var files []coverFile
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, coverFile{path: filepath.Join(dir, e.Name()), size: info.Size(), modTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	return files
+}
+
+// syncLocked reloads the file before a read, logging rather than failing so
+// a corrupt cache only costs a re-upload.
+func (c *persistentCache) syncLocked() {
+	if err := c.reload(); err != nil {
+		log.Printf("Error loading cache: %v", err)
+	}
+}
+
+func (c *persistentCache) image(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.syncLocked()
+
+	entry, ok := c.Images[key]
+	if !ok || (!entry.ExpiresAt.IsZero() && time.Now().After(entry.ExpiresAt)) {
+		return "", false
+	}
+	return entry.URL, true
+}
+
+func (c *persistentCache) setImage(key, url string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.syncLocked()
+
+	entry := cacheEntry{URL: url, CachedAt: time.Now()}
+	if ttl > 0 {
+		entry.ExpiresAt = entry.CachedAt.Add(ttl)
+	}
+	c.Images[key] = entry
+	if err := c.save(); err != nil {
+		log.Printf("Error saving cache: %v", err)
+	}
+}
+
+func (c *persistentCache) track(id int64) (*lyra.Track, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.syncLocked()
+
+	entry, ok := c.Tracks[id]
+	if !ok || entry.Track == nil || time.Since(entry.CachedAt) > trackCacheTTL {
+		return nil, false
+	}
+	return entry.Track, true
+}
+
+func (c *persistentCache) setTrack(track *lyra.Track) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.syncLocked()
+
+	c.Tracks[track.DbID] = trackCacheEntry{Track: track, CachedAt: time.Now()}
+	if err := c.save(); err != nil {
+		log.Printf("Error saving cache: %v", err)
+	}
+}
+
+// purge removes matching entries and reports how many were removed. An empty
+// filter removes everything.
+func (c *persistentCache) purge(filter cacheFilter) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.reload(); err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for key := range c.Images {
+		if filter.matchesImage(key) {
+			delete(c.Images, key)
+			removed++
+		}
+	}
+	for id, entry := range c.Tracks {
+		if filter.matchesTrack(id, entry.Track) {
+			delete(c.Tracks, id)
+			removed++
+		}
+	}
+	return removed, c.save()
+}
+
+// cacheExport is the file `lyra-rpc cache export` writes: the image URLs,
+// without track metadata, which is quickly fetched again.
+type cacheExport struct {
+	Images map[string]cacheEntry `json:"images"`
+}
+
+// export returns the image entries that haven't expired.
+func (c *persistentCache) export() (cacheExport, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.reload(); err != nil {
+		return cacheExport{}, err
+	}
+
+	out := cacheExport{Images: map[string]cacheEntry{}}
+	now := time.Now()
+	for key, entry := range c.Images {
+		if entry.ExpiresAt.IsZero() || now.Before(entry.ExpiresAt) {
+			out.Images[key] = entry
+		}
+	}
+	return out, nil
+}
+
+// importImages adds the entries from an export that aren't cached already,
+// or only expired, and reports how many were added. Entries that have
+// expired since the export are skipped.
+func (c *persistentCache) importImages(in cacheExport) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.reload(); err != nil {
+		return 0, err
+	}
+
+	added := 0
+	now := time.Now()
+	for key, entry := range in.Images {
+		if entry.URL == "" || (!entry.ExpiresAt.IsZero() && !now.Before(entry.ExpiresAt)) {
+			continue
+		}
+		if have, ok := c.Images[key]; ok && (have.ExpiresAt.IsZero() || now.Before(have.ExpiresAt)) {
+			continue
+		}
+		c.Images[key] = entry
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	return added, c.save()
+}
+
+// cacheFilter selects cache entries by album, artist or track ID. Zero IDs
+// are ignored, and a filter with no IDs matches everything.
+type cacheFilter struct {
+	AlbumID  int64
+	ArtistID int64
+	TrackID  int64
+}
+
+func (f cacheFilter) empty() bool {
+	return f.AlbumID == 0 && f.ArtistID == 0 && f.TrackID == 0
+}
+
+// matchesImage reports whether the image cached under key matches. Keys
+// for servers after the first carry the server's URL in front, and match
+// the same IDs as the first server's.
+func (f cacheFilter) matchesImage(key string) bool {
+	key = key[strings.LastIndex(key, "/")+1:]
+	return f.empty() ||
+		(f.AlbumID != 0 && (key == imageKey("album", f.AlbumID) || key == imageKey("album-fallback", f.AlbumID))) ||
+		(f.ArtistID != 0 && key == imageKey("artist", f.ArtistID)) ||
+		(f.TrackID != 0 && (key == imageKey("lyrics", f.TrackID) || key == imageKey("spotify", f.TrackID)))
+}
+
+func (f cacheFilter) matchesTrack(id int64, track *lyra.Track) bool {
+	if f.empty() || id == f.TrackID {
+		return true
+	}
+	if track == nil {
+		return false
+	}
+	for _, album := range track.Albums {
+		if f.AlbumID != 0 && album.DbID == f.AlbumID {
+			return true
+		}
+	}
+	for _, artist := range track.Artists {
+		if f.ArtistID != 0 && artist.DbID == f.ArtistID {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheListing is one row of `lyra-rpc cache ls`.
+type cacheListing struct {
+	Key       string
+	Value     string
+	CachedAt  time.Time
+	ExpiresAt time.Time
+}
+
+func (c *persistentCache) list() ([]cacheListing, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+
+	var rows []cacheListing
+	for key, entry := range c.Images {
+		rows = append(rows, cacheListing{Key: key, Value: entry.URL, CachedAt: entry.CachedAt, ExpiresAt: entry.ExpiresAt})
+	}
+	for id, entry := range c.Tracks {
+		value := ""
+		if entry.Track != nil {
+			value = entry.Track.Title
+		}
+		rows = append(rows, cacheListing{Key: imageKey("track", id), Value: value, CachedAt: entry.CachedAt, ExpiresAt: entry.CachedAt.Add(trackCacheTTL)})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return strings.Compare(rows[i].Key, rows[j].Key) < 0
+	})
+	return rows, nil
+}
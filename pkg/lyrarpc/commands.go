@@ -0,0 +1,142 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runCommand runs a subcommand given on the command line, such as
+// `lyra-rpc cache ls`.
+func runCommand(args []string) error {
+	switch args[0] {
+	case "cache":
+		return runCacheCommand(args[1:])
+	case "stats":
+		return runStatsCommand(args[1:])
+	case "history":
+		return runHistoryCommand(args[1:])
+	case "recap":
+		return runRecapCommand(args[1:])
+	case "demo":
+		return runDemo(args[1:])
+	case "simulate":
+		return runSimulate(args[1:])
+	case "observe":
+		return runObserve(args[1:])
+	case "service":
+		return runServiceCommand(args[1:])
+	case "autostart":
+		return runAutostartCommand(args[1:])
+	case "update":
+		return runUpdateCommand(args[1:])
+	case "status", "toggle":
+		return runControlCommand(args[0])
+	case "tail", "log":
+		return runTail(args[1:])
+	case "lastfm":
+		if len(args) < 2 || args[1] != "auth" {
+			return fmt.Errorf("usage: lyra-rpc lastfm auth")
+		}
+		return runLastFMAuth()
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+func runCacheCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: lyra-rpc cache ls|purge [--album ID] [--artist ID] [--track ID]|export [FILE]|import FILE")
+	}
+
+	switch args[0] {
+	case "ls":
+		rows, err := cache.list()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tVALUE\tCACHED\tEXPIRES")
+		for _, row := range rows {
+			expires := "never"
+			if !row.ExpiresAt.IsZero() {
+				expires = row.ExpiresAt.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", row.Key, row.Value, row.CachedAt.Local().Format(time.DateTime), expires)
+		}
+		return w.Flush()
+
+	case "purge":
+		var filter cacheFilter
+		fs := flag.NewFlagSet("cache purge", flag.ContinueOnError)
+		fs.Int64Var(&filter.AlbumID, "album", 0, "only purge entries for this album ID")
+		fs.Int64Var(&filter.ArtistID, "artist", 0, "only purge entries for this artist ID")
+		fs.Int64Var(&filter.TrackID, "track", 0, "only purge entries for this track ID")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		removed, err := cache.purge(filter)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Purged %d cache entries.\n", removed)
+		return nil
+
+	case "export":
+		export, err := cache.export()
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(export, "", "  ")
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+		if len(args) < 2 || args[1] == "-" {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		if err := os.WriteFile(args[1], data, 0o600); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d cache entries to %s.\n", len(export.Images), args[1])
+		return nil
+
+	case "import":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: lyra-rpc cache import FILE")
+		}
+		var data []byte
+		var err error
+		if args[1] == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(args[1])
+		}
+		if err != nil {
+			return err
+		}
+		var in cacheExport
+		if err := json.Unmarshal(data, &in); err != nil {
+			return fmt.Errorf("reading %s: %w", args[1], err)
+		}
+		added, err := cache.importImages(in)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d of %d cache entries.\n", added, len(in.Images))
+		return nil
+
+	default:
+		return fmt.Errorf("unknown cache command %q", args[0])
+	}
+}
@@ -0,0 +1,120 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// configVersion is the config_version this build writes. Configs without
+// one predate versioning and count as version 1.
+const configVersion = 2
+
+// configMigration upgrades a config to version to, working on the raw JSON
+// since older shapes may not fit Config. apply returns a description of
+// each change it made.
+type configMigration struct {
+	to    int
+	apply func(raw map[string]any) []string
+}
+
+var configMigrations = []configMigration{
+	{to: 2, apply: migrateWebhookEvents},
+}
+
+// migrateConfig upgrades data, the contents of the config file at path,
+// to the current version. If anything changed, the original is kept next
+// to it as a backup and the file is rewritten.
+func migrateConfig(path string, data []byte) ([]byte, error) {
+	// Numbers are kept as written, so large IDs survive the round trip.
+	var raw map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	version := 1
+	if v, ok := raw["config_version"].(json.Number); ok {
+		n, err := v.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("config_version: %w", err)
+		}
+		version = int(n)
+	}
+	if version > configVersion {
+		log.Printf("%s is config_version %d, newer than this lyra-rpc understands (%d); some options may be ignored.", path, version, configVersion)
+		return data, nil
+	}
+
+	var changes []string
+	for _, m := range configMigrations {
+		if m.to > version {
+			changes = append(changes, m.apply(raw)...)
+		}
+	}
+	if len(changes) == 0 {
+		return data, nil
+	}
+	raw["config_version"] = configVersion
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	// Templates are full of characters HTML escaping would mangle.
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(raw); err != nil {
+		return nil, err
+	}
+	migrated := buf.Bytes()
+	backup := fmt.Sprintf("%s.v%d.bak", path, version)
+	if err := os.WriteFile(backup, data, 0o600); err != nil {
+		return nil, fmt.Errorf("backing up config before migrating: %w", err)
+	}
+	if err := os.WriteFile(path, migrated, 0o600); err != nil {
+		return nil, fmt.Errorf("writing migrated config: %w", err)
+	}
+	log.Printf("Migrated %s from config_version %d to %d, keeping the original as %s:", path, version, configVersion, backup)
+	for _, c := range changes {
+		log.Printf("  %s", c)
+	}
+	return migrated, nil
+}
+
+// migrateWebhookEvents replaces the webhook event names from before the
+// event bus with the events they cover now.
+func migrateWebhookEvents(raw map[string]any) []string {
+	hooks, _ := raw["webhooks"].([]any)
+	var changes []string
+	for i, h := range hooks {
+		hook, _ := h.(map[string]any)
+		events, _ := hook["events"].([]any)
+		var renamed []any
+		changed := false
+		for _, e := range events {
+			name, _ := e.(string)
+			legacy, ok := legacyWebhookEvents[name]
+			if !ok {
+				renamed = append(renamed, e)
+				continue
+			}
+			changed = true
+			var names []string
+			for _, t := range legacy {
+				renamed = append(renamed, string(t))
+				names = append(names, string(t))
+			}
+			changes = append(changes, fmt.Sprintf("webhooks[%d].events: %q is now %s", i, name, strings.Join(names, " and ")))
+		}
+		if changed {
+			hook["events"] = renamed
+		}
+	}
+	return changes
+}
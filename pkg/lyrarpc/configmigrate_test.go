@@ -0,0 +1,82 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		// want is the migrated config, or empty if it should be left
+		// alone.
+		want string
+	}{
+		{
+			name: "legacy webhook events",
+			in:   `{"webhooks": [{"url": "https://x", "events": ["track_change", "pause", "seeked"]}], "user_id": 12345678901234567}`,
+			want: `{"config_version":2,"user_id":12345678901234567,"webhooks":[{"events":["track_started","track_changed","paused","seeked"],"url":"https://x"}]}`,
+		},
+		{
+			name: "nothing to change",
+			in:   `{"webhooks": [{"url": "https://x", "events": ["stopped"]}]}`,
+		},
+		{
+			name: "current version",
+			in:   `{"config_version": 2, "webhooks": [{"events": ["pause"]}]}`,
+		},
+		{
+			name: "newer version",
+			in:   `{"config_version": 99, "webhooks": [{"events": ["pause"]}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tt.in), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := migrateConfig(path, []byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			backup, backupErr := os.ReadFile(path + ".v1.bak")
+			if tt.want == "" {
+				if string(got) != tt.in {
+					t.Errorf("got %s, want it unchanged", got)
+				}
+				if backupErr == nil {
+					t.Error("backed up a config that wasn't migrated")
+				}
+				return
+			}
+
+			// Decoding into float64 would round user_id.
+			var v any
+			dec := json.NewDecoder(bytes.NewReader(got))
+			dec.UseNumber()
+			if err := dec.Decode(&v); err != nil {
+				t.Fatal(err)
+			}
+			compact, _ := json.Marshal(v)
+			if string(compact) != tt.want {
+				t.Errorf("got %s, want %s", compact, tt.want)
+			}
+			if string(backup) != tt.in {
+				t.Errorf("backup = %q, want the original", backup)
+			}
+			if written, _ := os.ReadFile(path); string(written) != string(got) {
+				t.Errorf("wrote %s, want the migrated config", written)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !windows
+
+package lyrarpc
+
+func hasConsole() bool {
+	return true
+}
+
+// hideConsole only applies on Windows.
+func hideConsole() bool {
+	return false
+}
+
+func enableANSI() bool {
+	return true
+}
@@ -0,0 +1,45 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	kernel32             = windows.NewLazySystemDLL("kernel32.dll")
+	procFreeConsole      = kernel32.NewProc("FreeConsole")
+	procGetConsoleWindow = kernel32.NewProc("GetConsoleWindow")
+)
+
+// hasConsole reports whether lyra-rpc has a console to log to. A build
+// with -ldflags -H=windowsgui never does.
+func hasConsole() bool {
+	hwnd, _, _ := procGetConsoleWindow.Call()
+	return hwnd != 0
+}
+
+// hideConsole detaches from the console. A console opened just for
+// lyra-rpc, as when it's started from a shortcut, closes along with it.
+func hideConsole() bool {
+	if !hasConsole() {
+		return true
+	}
+	ok, _, _ := procFreeConsole.Call()
+	return ok != 0
+}
+
+// enableANSI turns on escape sequence handling in the console, reporting
+// whether it's supported, as it is from Windows 10 on.
+func enableANSI() bool {
+	handle := windows.Handle(os.Stderr.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return false
+	}
+	return windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) == nil
+}
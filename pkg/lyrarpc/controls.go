@@ -0,0 +1,252 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// presenceControl holds the switches front-ends such as the tray icon can
+// flip while lyra-rpc runs, and the status they show.
+type presenceControl struct {
+	mu sync.Mutex
+	// paused clears the Discord presence; everything else keeps running.
+	paused bool
+	// away hides the presence like paused while the user is away from
+	// the computer, without touching the switch they flip themselves.
+	away bool
+	// private stops broadcasting and scrobbling altogether, until
+	// privateUntil if that's set.
+	private      bool
+	privateUntil time.Time
+
+	lyraErr    error
+	lyraPolled bool
+	discordErr error
+	track      string
+
+	// refreshing makes the next poll set the presence again even if
+	// nothing changed.
+	refreshing bool
+
+	// wake asks the main loop to poll right away, so changes show up
+	// without waiting for the next tick.
+	wake chan struct{}
+	quit chan struct{}
+	once sync.Once
+}
+
+var presenceState = &presenceControl{
+	wake: make(chan struct{}, 1),
+	quit: make(chan struct{}),
+}
+
+// controlStatus is a snapshot of presenceControl.
+type controlStatus struct {
+	Paused       bool      `json:"paused"`
+	Away         bool      `json:"away,omitempty"`
+	Private      bool      `json:"private"`
+	PrivateUntil time.Time `json:"private_until,omitzero"`
+	LyraError    string    `json:"lyra_error,omitempty"`
+	DiscordError string    `json:"discord_error,omitempty"`
+	// Track is "Title – Artist" while something is playing.
+	Track string `json:"track,omitempty"`
+}
+
+func (c *presenceControl) status() controlStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := controlStatus{
+		Paused:       c.paused,
+		Away:         c.away,
+		Private:      c.privateLocked(),
+		PrivateUntil: c.privateUntil,
+		Track:        c.track,
+	}
+	if !s.Private {
+		s.PrivateUntil = time.Time{}
+	}
+	if c.lyraErr != nil {
+		s.LyraError = c.lyraErr.Error()
+	}
+	if c.discordErr != nil {
+		s.DiscordError = c.discordErr.Error()
+	}
+	return s
+}
+
+func (c *presenceControl) isPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+func (c *presenceControl) setPaused(paused bool) {
+	c.mu.Lock()
+	c.paused = paused
+	c.mu.Unlock()
+	c.poke()
+}
+
+// isHidden reports whether the presence is hidden, either because it was
+// paused or because the user is away.
+func (c *presenceControl) isHidden() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused || c.away
+}
+
+func (c *presenceControl) setAway(away bool) {
+	c.mu.Lock()
+	c.away = away
+	c.mu.Unlock()
+	c.poke()
+}
+
+func (c *presenceControl) isPrivate() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.privateLocked()
+}
+
+func (c *presenceControl) privateLocked() bool {
+	if c.private && !c.privateUntil.IsZero() && time.Now().After(c.privateUntil) {
+		c.private = false
+		c.privateUntil = time.Time{}
+	}
+	return c.private
+}
+
+// setPrivate starts a private session lasting d, or until it's ended if d
+// is zero.
+func (c *presenceControl) setPrivate(d time.Duration) {
+	c.mu.Lock()
+	c.private = true
+	c.privateUntil = time.Time{}
+	if d > 0 {
+		c.privateUntil = time.Now().Add(d)
+	}
+	c.mu.Unlock()
+	c.poke()
+}
+
+func (c *presenceControl) endPrivate() {
+	c.mu.Lock()
+	c.private = false
+	c.privateUntil = time.Time{}
+	c.mu.Unlock()
+	c.poke()
+}
+
+// setLyraStatus records the outcome of the latest poll.
+func (c *presenceControl) setLyraStatus(err error) {
+	c.mu.Lock()
+	c.lyraErr = err
+	c.lyraPolled = true
+	c.mu.Unlock()
+}
+
+func (c *presenceControl) setTrack(track string) {
+	c.mu.Lock()
+	c.track = track
+	c.mu.Unlock()
+}
+
+func (c *presenceControl) setDiscordStatus(err error) {
+	c.mu.Lock()
+	c.discordErr = err
+	c.mu.Unlock()
+}
+
+// refresh re-sends the presence and retries the artwork right away.
+func (c *presenceControl) refresh() {
+	c.mu.Lock()
+	c.refreshing = true
+	c.mu.Unlock()
+	c.poke()
+}
+
+// takeRefresh reports whether a refresh was asked for since the last call.
+func (c *presenceControl) takeRefresh() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	refreshing := c.refreshing
+	c.refreshing = false
+	return refreshing
+}
+
+func (c *presenceControl) poke() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// componentHealth is one part of the /healthz response.
+type componentHealth struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type healthReport struct {
+	Healthy  bool            `json:"healthy"`
+	Lyra     componentHealth `json:"lyra"`
+	Discord  componentHealth `json:"discord"`
+	Uploader componentHealth `json:"uploader"`
+}
+
+// health reports whether the latest poll of Lyra, update of the Discord
+// presence, and upload all worked.
+func (c *presenceControl) health() healthReport {
+	c.mu.Lock()
+	report := healthReport{
+		Lyra:    componentHealth{OK: c.lyraPolled && c.lyraErr == nil},
+		Discord: componentHealth{OK: c.discordErr == nil},
+	}
+	switch {
+	case !c.lyraPolled:
+		report.Lyra.Error = "not polled yet"
+	case c.lyraErr != nil:
+		report.Lyra.Error = c.lyraErr.Error()
+	}
+	if c.discordErr != nil {
+		report.Discord.Error = c.discordErr.Error()
+	}
+	c.mu.Unlock()
+
+	report.Uploader.OK = true
+	var failures []string
+	for backend, err := range uploadHealth() {
+		failures = append(failures, fmt.Sprintf("%s: %v", backend, err))
+	}
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		report.Uploader = componentHealth{Error: strings.Join(failures, "; ")}
+	}
+
+	report.Healthy = report.Lyra.OK && report.Discord.OK && report.Uploader.OK
+	return report
+}
+
+// reset turns every switch back off and forgets the status, for a new
+// engine to start from.
+func (c *presenceControl) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused, c.away = false, false
+	c.private, c.privateUntil = false, time.Time{}
+	c.lyraErr, c.lyraPolled, c.discordErr = nil, false, nil
+	c.track = ""
+	c.refreshing = false
+}
+
+// requestQuit asks the main loop to shut down.
+func (c *presenceControl) requestQuit() {
+	c.once.Do(func() { close(c.quit) })
+}
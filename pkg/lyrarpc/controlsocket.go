@@ -0,0 +1,235 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The control socket lets a second invocation of lyra-rpc, such as
+// `lyra-rpc status`, talk to the running one. Requests are a single command
+// line; the reply is the status as one line of JSON, except for "tail",
+// which streams the recent events as one line of JSON each until the
+// caller hangs up.
+
+func controlSocketPath() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "control.sock"), nil
+}
+
+// startControlSocket listens for commands from other invocations until the
+// engine stops.
+func (e *Engine) startControlSocket() error {
+	path, err := controlSocketPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// A socket left behind by a crash would make Listen fail, but one that
+	// still answers belongs to another running instance.
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another lyra-rpc", path)
+	}
+	os.Remove(path)
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	// Closing a unix listener removes the socket too.
+	e.cleanup = append(e.cleanup, func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if err != nil {
+				log.Printf("Control socket stopped: %v", err)
+				return
+			}
+			go e.serveControlConn(conn)
+		}
+	}()
+	return nil
+}
+
+func (e *Engine) serveControlConn(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return
+	}
+	if strings.TrimSpace(line) == "tail" {
+		e.serveTail(conn, r)
+		return
+	}
+	reply := struct {
+		controlStatus
+		Error string `json:"error,omitempty"`
+	}{}
+	switch command := strings.TrimSpace(line); command {
+	case "status":
+	case "toggle":
+		presenceState.setPaused(!presenceState.isPaused())
+	default:
+		reply.Error = fmt.Sprintf("unknown command %q", command)
+	}
+	reply.controlStatus = presenceState.status()
+	json.NewEncoder(conn).Encode(reply)
+}
+
+// serveTail sends the recent events, then each new one, until the caller
+// hangs up.
+func (e *Engine) serveTail(conn net.Conn, r *bufio.Reader) {
+	conn.SetDeadline(time.Time{})
+	entries, ch := e.recentEvents.subscribe()
+	defer e.recentEvents.unsubscribe(ch)
+
+	// The caller sends nothing more, so a read returning means it's gone.
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, r)
+		close(gone)
+	}()
+
+	enc := json.NewEncoder(conn)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case entry := <-ch:
+			if err := enc.Encode(entry); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
+
+// sendControlCommand sends command to the running lyra-rpc.
+func sendControlCommand(command string) (controlStatus, error) {
+	var reply struct {
+		controlStatus
+		Error string `json:"error"`
+	}
+	path, err := controlSocketPath()
+	if err != nil {
+		return reply.controlStatus, err
+	}
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return reply.controlStatus, fmt.Errorf("lyra-rpc doesn't seem to be running: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if _, err := fmt.Fprintln(conn, command); err != nil {
+		return reply.controlStatus, err
+	}
+	if err := json.NewDecoder(conn).Decode(&reply); err != nil {
+		return reply.controlStatus, err
+	}
+	if reply.Error != "" {
+		return reply.controlStatus, fmt.Errorf("%s", reply.Error)
+	}
+	return reply.controlStatus, nil
+}
+
+func runControlCommand(command string) error {
+	status, err := sendControlCommand(command)
+	if err != nil {
+		return err
+	}
+	printControlStatus(status)
+	return nil
+}
+
+// runTail prints the running lyra-rpc's recent events and follows new ones
+// until interrupted.
+func runTail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print each event as a line of JSON")
+	fs.Parse(args)
+
+	path, err := controlSocketPath()
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("lyra-rpc doesn't seem to be running: %w", err)
+	}
+	defer conn.Close()
+	if _, err := fmt.Fprintln(conn, "tail"); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(conn)
+	for {
+		var entry presenceLogEntry
+		if err := dec.Decode(&entry); err != nil {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("lyra-rpc stopped")
+			}
+			return err
+		}
+		if *asJSON {
+			json.NewEncoder(os.Stdout).Encode(entry)
+			continue
+		}
+		fmt.Printf("%s  %-13s  %s\n", entry.Time.Local().Format(time.TimeOnly), entry.Event, entry.Track)
+	}
+}
+
+func printControlStatus(s controlStatus) {
+	switch {
+	case s.Private:
+		fmt.Print("Private session, nothing is broadcast")
+		if !s.PrivateUntil.IsZero() {
+			fmt.Printf(" until %s", s.PrivateUntil.Local().Format(time.DateTime))
+		}
+		fmt.Println(".")
+	case s.Track == "":
+		fmt.Println("Nothing playing.")
+	case s.Paused:
+		fmt.Printf("Presence paused, not showing %s.\n", s.Track)
+	case s.Away:
+		fmt.Printf("Away, not showing %s.\n", s.Track)
+	default:
+		fmt.Printf("Showing %s.\n", s.Track)
+	}
+	if s.LyraError != "" {
+		fmt.Printf("Can't reach Lyra: %s\n", s.LyraError)
+	}
+	if s.DiscordError != "" {
+		fmt.Printf("Can't reach Discord: %s\n", s.DiscordError)
+	}
+}
@@ -0,0 +1,270 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CrashDumpConfig keeps a diagnostic file for bug reports when lyra-rpc
+// exits on a panic or fatal error.
+type CrashDumpConfig struct {
+	Enabled bool `json:"enabled"`
+	// Dir is where the file is written. Empty uses the cache directory.
+	Dir string `json:"dir"`
+	// LogLines is how many of the last log lines the file holds. Zero or
+	// less uses defaultCrashLogLines.
+	LogLines int `json:"log_lines"`
+}
+
+const defaultCrashLogLines = 200
+
+// The crash dump is written as lyra-rpc runs rather than when it crashes,
+// as a panic outside the main loop leaves no chance to: the version and
+// config up front, then the last log lines, kept up to date, and the
+// runtime appends its goroutine dump after them if it dies. A clean exit
+// removes the file.
+var crashDump struct {
+	mu sync.Mutex
+	f  *os.File
+	// headerLen is where the log lines start in f.
+	headerLen int64
+	lines     []string
+	// maxLines is how many lines are kept.
+	maxLines int
+	// flushing is set while lines wait to be written out.
+	flushing bool
+}
+
+// crashLogFlushInterval is how often the log lines in the crash dump are
+// brought up to date, rather than rewriting them on every line.
+const crashLogFlushInterval = time.Second
+
+// startCrashDump opens this run's crash dump, if they're enabled, and
+// starts copying the log into it.
+func startCrashDump() {
+	c := config.CrashDump
+	if !c.Enabled {
+		return
+	}
+	dir := c.Dir
+	if dir == "" {
+		var err error
+		if dir, err = cacheDir(); err != nil {
+			log.Printf("Error creating crash dump: %v", err)
+			return
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("Error creating crash dump: %v", err)
+		return
+	}
+	path := filepath.Join(dir, "crash-"+time.Now().Format("20060102-150405")+".txt")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o600)
+	if err != nil {
+		log.Printf("Error creating crash dump: %v", err)
+		return
+	}
+
+	var header strings.Builder
+	writeCrashHeader(&header)
+	if _, err := f.WriteString(header.String()); err != nil {
+		log.Printf("Error creating crash dump: %v", err)
+		f.Close()
+		os.Remove(path)
+		return
+	}
+	debug.SetTraceback("all")
+	if err := debug.SetCrashOutput(f, debug.CrashOptions{}); err != nil {
+		log.Printf("Error creating crash dump: %v", err)
+		f.Close()
+		os.Remove(path)
+		return
+	}
+
+	crashDump.mu.Lock()
+	crashDump.f = f
+	crashDump.headerLen = int64(header.Len())
+	crashDump.maxLines = c.LogLines
+	if crashDump.maxLines <= 0 {
+		crashDump.maxLines = defaultCrashLogLines
+	}
+	crashDump.mu.Unlock()
+	log.SetOutput(teeCrashLog(log.Writer()))
+	debugf("Writing a crash dump to %s in case lyra-rpc crashes", path)
+}
+
+// writeCrashHeader describes the build, system, and config, with secrets
+// left out.
+func writeCrashHeader(w io.Writer) {
+	fmt.Fprintf(w, "lyra-rpc %s crash dump\n", version)
+	fmt.Fprintf(w, "Started: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(w, "Go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" || s.Key == "vcs.modified" {
+				fmt.Fprintf(w, "%s: %s\n", s.Key, s.Value)
+			}
+		}
+	}
+
+	fmt.Fprintln(w, "\n== Config ==")
+	data, err := json.Marshal(config)
+	if err == nil {
+		var raw any
+		if err = json.Unmarshal(data, &raw); err == nil {
+			data, err = json.MarshalIndent(redactConfig("", "", raw), "", "  ")
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(w, "Error encoding config: %v\n", err)
+	} else {
+		fmt.Fprintf(w, "%s\n", data)
+	}
+	fmt.Fprintln(w, "\n== Log ==")
+}
+
+// redactConfig replaces secrets in v, the config decoded from JSON, where
+// key is the name v had and parent the name of what contained it.
+func redactConfig(parent, key string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = redactConfig(key, k, item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = redactConfig(parent, key, item)
+		}
+		return v
+	case string:
+		if v == "" {
+			return v
+		}
+		if secretConfigKey(parent, key) {
+			return "[redacted]"
+		}
+		// Credentials can hide in any URL, such as an MQTT broker's.
+		if u, err := url.Parse(v); err == nil && u.User != nil {
+			u.User = url.User("redacted")
+			return u.String()
+		}
+	}
+	return v
+}
+
+// secretConfigKey reports whether the option key, inside parent, holds a
+// secret. Webhook URLs count, as they're often all it takes to post to
+// one.
+func secretConfigKey(parent, key string) bool {
+	for _, s := range []string{"token", "secret", "password", "session", "api_key", "userhash"} {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return key == "key" ||
+		strings.HasSuffix(parent, "headers") || strings.HasSuffix(key, "headers") ||
+		(strings.Contains(key, "webhook") && strings.HasSuffix(key, "url")) ||
+		(strings.Contains(parent, "webhook") && key == "url")
+}
+
+// crashLog copies log output into the crash dump.
+type crashLog struct{}
+
+// teeCrashLog adds the crash dump, if there is one, to w.
+func teeCrashLog(w io.Writer) io.Writer {
+	crashDump.mu.Lock()
+	defer crashDump.mu.Unlock()
+	if crashDump.f == nil {
+		return w
+	}
+	return io.MultiWriter(w, crashLog{})
+}
+
+// Write keeps the last log_lines lines of output for the crash dump,
+// rewriting them after the header at most once a second.
+func (crashLog) Write(p []byte) (int, error) {
+	crashDump.mu.Lock()
+	defer crashDump.mu.Unlock()
+	if crashDump.f == nil {
+		return len(p), nil
+	}
+	crashDump.lines = append(crashDump.lines, strings.Split(strings.TrimRight(string(p), "\n"), "\n")...)
+	if n := crashDump.maxLines; len(crashDump.lines) > n {
+		crashDump.lines = crashDump.lines[len(crashDump.lines)-n:]
+	}
+	if !crashDump.flushing {
+		crashDump.flushing = true
+		time.AfterFunc(crashLogFlushInterval, func() {
+			crashDump.mu.Lock()
+			defer crashDump.mu.Unlock()
+			flushCrashLog()
+		})
+	}
+	return len(p), nil
+}
+
+// flushCrashLog rewrites the log lines after the header. Callers hold
+// crashDump.mu.
+func flushCrashLog() {
+	crashDump.flushing = false
+	f := crashDump.f
+	if f == nil {
+		return
+	}
+	// The runtime writes a crash at the file's offset, so it has to end
+	// up right after the last line.
+	if err := f.Truncate(crashDump.headerLen); err == nil {
+		if _, err := f.Seek(crashDump.headerLen, io.SeekStart); err == nil {
+			f.WriteString(strings.Join(crashDump.lines, "\n") + "\n")
+		}
+	}
+}
+
+// finishCrashDump removes the crash dump after a clean exit.
+func finishCrashDump() {
+	crashDump.mu.Lock()
+	defer crashDump.mu.Unlock()
+	if crashDump.f == nil {
+		return
+	}
+	debug.SetCrashOutput(nil, debug.CrashOptions{})
+	crashDump.f.Close()
+	os.Remove(crashDump.f.Name())
+	crashDump.f = nil
+}
+
+// fatal logs v and exits like log.Fatal, keeping the crash dump, with
+// every goroutine's stack added, if there is one.
+func fatal(v ...any) {
+	msg := fmt.Sprint(v...)
+	log.Print(msg)
+
+	crashDump.mu.Lock()
+	flushCrashLog()
+	f := crashDump.f
+	crashDump.f = nil
+	crashDump.mu.Unlock()
+	if f != nil {
+		fmt.Fprintf(f, "\n== Fatal error ==\n%s\n\n", msg)
+		pprof.Lookup("goroutine").WriteTo(f, 2)
+		f.Close()
+		log.Printf("Crash dump written to %s.", f.Name())
+	}
+	os.Exit(1)
+}
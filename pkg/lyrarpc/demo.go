@@ -0,0 +1,234 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"lyra-rpc/pkg/lyra"
+)
+
+//go:embed demo/*.png
+var demoCovers embed.FS
+
+// demoTrack is a track served by the demo server. Albums get one of the
+// covers in demo/ by their ID.
+type demoTrack struct {
+	lyra.Track
+	DurationMs int64 `json:"duration_ms"`
+}
+
+// demoCoverCount is how many covers there are in demo/.
+const demoCoverCount = 3
+
+var demoTracks = []demoTrack{
+	{
+		Track: lyra.Track{
+			DbID:    1,
+			Title:   "Midnight Static",
+			Artists: []lyra.Artist{{DbID: 1, ArtistName: "The Placeholders"}},
+			Albums:  []lyra.Album{{DbID: 1, AlbumTitle: "Test Pattern", Year: 2019}},
+			Genres:  []lyra.Genre{{DbID: 1, GenreName: "Synthwave"}},
+		},
+		DurationMs: 40_000,
+	},
+	{
+		Track: lyra.Track{
+			DbID:    2,
+			Title:   "Low Tide",
+			Artists: []lyra.Artist{{DbID: 2, ArtistName: "Mock Ensemble"}, {DbID: 3, ArtistName: "Sample Rate"}},
+			Albums:  []lyra.Album{{DbID: 2, AlbumTitle: "Fixtures", Year: 2023}},
+			Genres:  []lyra.Genre{{DbID: 2, GenreName: "Ambient"}},
+		},
+		DurationMs: 55_000,
+	},
+	{
+		Track: lyra.Track{
+			DbID:    3,
+			Title:   "Hello, World",
+			Artists: []lyra.Artist{{DbID: 4, ArtistName: "Lorem Ipsum"}},
+			Albums:  []lyra.Album{{DbID: 3, AlbumTitle: "Stub Records"}},
+			Genres:  []lyra.Genre{{DbID: 3, GenreName: "Indie Rock"}},
+		},
+		DurationMs: 35_000,
+	},
+}
+
+// demoServer fakes the parts of Lyra's API that lyra-rpc uses, playing
+// its tracks on repeat.
+type demoServer struct {
+	tracks []demoTrack
+
+	mu      sync.Mutex
+	index   int
+	state   string
+	basePos int64
+	// since is when basePos was last set; the position moves on from there
+	// while playing.
+	since time.Time
+}
+
+func newDemoServer(tracks []demoTrack) *demoServer {
+	return &demoServer{tracks: tracks, state: "playing", since: time.Now()}
+}
+
+// advance moves through the playlist as tracks finish. Callers hold mu.
+func (s *demoServer) advance(now time.Time) {
+	if s.state != "playing" {
+		return
+	}
+	s.basePos += now.Sub(s.since).Milliseconds()
+	s.since = now
+	for s.basePos >= s.tracks[s.index].DurationMs {
+		s.basePos -= s.tracks[s.index].DurationMs
+		s.index = (s.index + 1) % len(s.tracks)
+	}
+}
+
+func (s *demoServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/playbacks", s.servePlaybacks)
+	mux.HandleFunc("POST /api/playbacks/{id}/{command}", s.serveCommand)
+	mux.HandleFunc("GET /api/tracks/{id}", s.serveTrack)
+	mux.HandleFunc("GET /api/albums/{id}/cover", s.serveCover)
+	return mux
+}
+
+func (s *demoServer) servePlaybacks(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	s.mu.Lock()
+	s.advance(now)
+	playbacks := []lyra.Playback{}
+	if s.state != "stopped" {
+		track := s.tracks[s.index]
+		playbacks = append(playbacks, lyra.Playback{
+			PlaybackID:  1,
+			TrackID:     track.DbID,
+			UserID:      1,
+			PositionMs:  s.basePos,
+			State:       s.state,
+			ActivityMs:  now.UnixMilli(),
+			UpdatedAtMs: now.UnixMilli(),
+			DurationMs:  &track.DurationMs,
+		})
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(playbacks)
+}
+
+func (s *demoServer) serveCommand(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(now)
+
+	switch r.PathValue("command") {
+	case "play":
+		s.state = "playing"
+	case "pause":
+		if s.state == "playing" {
+			s.state = "paused"
+		}
+	case "stop":
+		s.state = "stopped"
+		s.basePos = 0
+	case "next":
+		s.index = (s.index + 1) % len(s.tracks)
+		s.basePos = 0
+	case "previous":
+		s.index = (s.index + len(s.tracks) - 1) % len(s.tracks)
+		s.basePos = 0
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	s.since = now
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *demoServer) serveTrack(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	for _, track := range s.tracks {
+		if track.DbID == id {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(track.Track)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (s *demoServer) serveCover(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+	image, err := demoCovers.ReadFile(fmt.Sprintf("demo/cover%d.png", (id-1)%demoCoverCount+1))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(image)
+}
+
+// runDemo runs lyra-rpc against the demo server, or with --serve, only
+// serves the fake API for something else to point at.
+func runDemo(args []string) error {
+	fs := flag.NewFlagSet("demo", flag.ContinueOnError)
+	serve := fs.String("serve", "", "only serve the fake Lyra API at this address")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	addr := *serve
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: newDemoServer(demoTracks).handler()}
+
+	if *serve != "" {
+		log.Printf("Serving a demo Lyra API at http://%s", ln.Addr())
+		return server.Serve(ln)
+	}
+
+	go func() {
+		if err := server.Serve(ln); err != nil {
+			log.Printf("Error serving demo Lyra API: %v", err)
+		}
+	}()
+	useDemoServer(ln.Addr())
+	log.Printf("Demo mode: playing sample tracks from a fake Lyra API at %s", config.BaseURL)
+	runDaemon(false, nil)
+	return nil
+}
+
+// useDemoServer points the config at a demo server listening on addr.
+func useDemoServer(addr net.Addr) {
+	config.BaseURL = fmt.Sprintf("http://%s", addr)
+	config.Servers = nil
+	// Sample tracks shouldn't end up in anyone's listening history.
+	config.LastFM.Enabled = false
+	config.ListenBrainz.Enabled = false
+	config.Audioscrobbler.Enabled = false
+	config.Maloja.Enabled = false
+	config.History.Enabled = false
+}
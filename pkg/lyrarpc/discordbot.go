@@ -0,0 +1,372 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"lyra-rpc/pkg/presence"
+
+	"github.com/coder/websocket"
+)
+
+// DiscordBotConfig publishes playback through a Discord bot instead of (or
+// as well as) the desktop client, for machines without one.
+type DiscordBotConfig struct {
+	Enabled bool   `json:"enabled"`
+	Token   string `json:"token"`
+	// Activity sets the bot's own status to what's playing.
+	Activity bool `json:"activity"`
+	// ChannelID, when set, keeps a now-playing message in that channel up
+	// to date. MessageID reuses an existing message, e.g. a pinned one,
+	// instead of posting a new one on startup.
+	ChannelID string `json:"channel_id"`
+	MessageID string `json:"message_id"`
+}
+
+const (
+	discordGatewayURL = "wss://gateway.discord.gg/?v=10&encoding=json"
+	discordAPIURL     = "https://discord.com/api/v10"
+)
+
+type discordBotSink struct {
+	config DiscordBotConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	activity map[string]any
+	// changed is signalled when activity changes, for the gateway session
+	// to send it.
+	changed chan struct{}
+	// reconnect is signalled when the network changes, for the gateway
+	// session to be opened again over it.
+	reconnect chan struct{}
+	// ctx ends the gateway session once the sink is stopped.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	lastKey   string
+	messageID string
+	edits     chan webhookEmbed
+}
+
+func newDiscordBotSink(c DiscordBotConfig) *discordBotSink {
+	s := &discordBotSink{
+		config:    c,
+		client:    newHTTPClient(15 * time.Second),
+		changed:   make(chan struct{}, 1),
+		reconnect: make(chan struct{}, 1),
+		messageID: c.MessageID,
+		edits:     make(chan webhookEmbed, 1),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	if c.Activity {
+		network.subscribe(func() {
+			select {
+			case s.reconnect <- struct{}{}:
+			default:
+			}
+		})
+		go s.runGateway()
+	}
+	if c.ChannelID != "" {
+		go s.runMessage()
+	}
+	return s
+}
+
+func (s *discordBotSink) update(np *NowPlaying) {
+	// Pausing the presence, or being away, hides the bot's activity too.
+	paused := presenceState.isHidden()
+	key := ""
+	var data presence.Data
+	if np != nil {
+		data = newTemplateData(np)
+		key = fmt.Sprintf("%d/%s/%s/%t", data.TrackID, data.State, data.ImageURL, paused)
+	}
+	if key == s.lastKey {
+		return
+	}
+	s.lastKey = key
+
+	if s.config.Activity {
+		var activity map[string]any
+		if np != nil && data.State == "playing" && !paused {
+			activity = map[string]any{"name": data.Title + " – " + data.Artist, "type": 2}
+		}
+		s.mu.Lock()
+		s.activity = activity
+		s.mu.Unlock()
+		select {
+		case s.changed <- struct{}{}:
+		default:
+		}
+	}
+
+	if s.config.ChannelID != "" {
+		embed := webhookEmbed{Title: "Nothing playing"}
+		if np != nil {
+			embed = webhookEmbed{Title: data.Title, Description: data.Artist}
+			if data.Album != "" {
+				embed.Fields = append(embed.Fields, webhookEmbedField{Name: "Album", Value: data.Album, Inline: true})
+			}
+			if data.State != "playing" {
+				embed.Fields = append(embed.Fields, webhookEmbedField{Name: "State", Value: "Paused", Inline: true})
+			}
+			if data.ImageURL != "" {
+				embed.Thumbnail = &webhookEmbedImage{URL: data.ImageURL}
+			}
+		}
+		// Only the newest message matters; replace one that hasn't been
+		// sent yet.
+		select {
+		case <-s.edits:
+		default:
+		}
+		s.edits <- embed
+	}
+}
+
+func (s *discordBotSink) stop() {
+	s.cancel()
+	close(s.edits)
+}
+
+// runMessage posts or edits the now-playing message, one change at a time.
+func (s *discordBotSink) runMessage() {
+	for embed := range s.edits {
+		if err := s.editMessage(embed); err != nil {
+			log.Printf("Error updating Discord bot message: %v", err)
+		}
+	}
+}
+
+func (s *discordBotSink) editMessage(embed webhookEmbed) error {
+	body, err := json.Marshal(map[string]any{"content": "", "embeds": []webhookEmbed{embed}})
+	if err != nil {
+		return err
+	}
+
+	method, endpoint := "POST", discordAPIURL+"/channels/"+s.config.ChannelID+"/messages"
+	if s.messageID != "" {
+		method, endpoint = "PATCH", endpoint+"/"+s.messageID
+	}
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bot "+s.config.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The message was deleted; post a new one next time.
+	if resp.StatusCode == http.StatusNotFound && s.messageID != "" {
+		s.messageID = ""
+		return s.editMessage(embed)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{api: "Discord API", status: resp.StatusCode}
+	}
+	var message struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+		return err
+	}
+	s.messageID = message.ID
+	return nil
+}
+
+// gatewayPayload is a message on the Discord gateway.
+type gatewayPayload struct {
+	Op       int             `json:"op"`
+	Data     json.RawMessage `json:"d,omitempty"`
+	Sequence *int64          `json:"s,omitempty"`
+	Type     string          `json:"t,omitempty"`
+}
+
+// runGateway keeps a gateway session open so the bot's activity can be set,
+// reconnecting whenever it drops.
+func (s *discordBotSink) runGateway() {
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := s.gatewaySession()
+		if s.ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > time.Minute {
+			backoff = time.Second
+		}
+		log.Printf("Discord gateway disconnected, reconnecting in %s: %v", backoff, err)
+		select {
+		case <-time.After(backoff):
+			backoff = min(2*backoff, 5*time.Minute)
+		case <-s.reconnect:
+			backoff = time.Second
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *discordBotSink) gatewaySession() error {
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, discordGatewayURL, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.CloseNow()
+	// Guild data arrives on connect even without intents.
+	conn.SetReadLimit(16 << 20)
+
+	var writeMu sync.Mutex
+	send := func(op int, data any) error {
+		payload, err := json.Marshal(map[string]any{"op": op, "d": data})
+		if err != nil {
+			return err
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		writeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		return conn.Write(writeCtx, websocket.MessageText, payload)
+	}
+
+	var hello struct {
+		HeartbeatInterval int64 `json:"heartbeat_interval"`
+	}
+	msg, err := readGateway(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if msg.Op != 10 {
+		return fmt.Errorf("expected hello, got op %d", msg.Op)
+	}
+	if err := json.Unmarshal(msg.Data, &hello); err != nil {
+		return err
+	}
+
+	err = send(2, map[string]any{
+		"token":   s.config.Token,
+		"intents": 0,
+		"properties": map[string]string{
+			"os":      runtime.GOOS,
+			"browser": "lyra-rpc",
+			"device":  "lyra-rpc",
+		},
+		"presence": s.presence(),
+	})
+	if err != nil {
+		return err
+	}
+
+	var seq *int64
+	messages := make(chan gatewayPayload)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := readGateway(ctx, conn)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(time.Duration(hello.HeartbeatInterval) * time.Millisecond)
+	defer heartbeat.Stop()
+	acked := true
+	for {
+		select {
+		case <-heartbeat.C:
+			if !acked {
+				return fmt.Errorf("heartbeat not acknowledged")
+			}
+			acked = false
+			if err := send(1, seq); err != nil {
+				return err
+			}
+
+		case <-s.changed:
+			if err := send(3, s.presence()); err != nil {
+				return err
+			}
+
+		case msg := <-messages:
+			if msg.Sequence != nil {
+				seq = msg.Sequence
+			}
+			switch msg.Op {
+			case 0:
+				if msg.Type == "READY" {
+					log.Println("Connected to the Discord gateway as a bot")
+				}
+			case 1:
+				if err := send(1, seq); err != nil {
+					return err
+				}
+			case 7:
+				return fmt.Errorf("asked to reconnect")
+			case 9:
+				return fmt.Errorf("invalid session")
+			case 11:
+				acked = true
+			}
+
+		case <-s.reconnect:
+			return fmt.Errorf("network changed")
+
+		case err := <-readErr:
+			return err
+		}
+	}
+}
+
+func readGateway(ctx context.Context, conn *websocket.Conn) (gatewayPayload, error) {
+	var msg gatewayPayload
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		return msg, err
+	}
+	err = json.Unmarshal(data, &msg)
+	return msg, err
+}
+
+// presence is the gateway presence update for the current activity.
+func (s *discordBotSink) presence() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activities := []map[string]any{}
+	if s.activity != nil {
+		activities = append(activities, s.activity)
+	}
+	return map[string]any{
+		"since":      nil,
+		"activities": activities,
+		"status":     "online",
+		"afk":        false,
+	}
+}
@@ -0,0 +1,73 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build discordtest
+
+package lyrarpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"lyra-rpc/pkg/discord/discordtest"
+)
+
+// recordActivities starts a fake Discord for the presence to connect to,
+// writing every activity it's sent to path as a line of JSON. Timestamps
+// are made relative to when the activity arrived and rounded to the
+// second, so that the same scenario records the same lines every run.
+func recordActivities(path string) (func(), error) {
+	out := os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+	server, err := discordtest.NewServer()
+	if err != nil {
+		return nil, fmt.Errorf("starting fake Discord: %w", err)
+	}
+
+	start := time.Now()
+	enc := json.NewEncoder(out)
+	var mu sync.Mutex
+	server.OnActivity = func(a discordtest.Activity) {
+		var activity map[string]any
+		json.Unmarshal(a.Payload, &activity)
+		if ts, ok := activity["timestamps"].(map[string]any); ok {
+			for k, v := range ts {
+				if ms, ok := v.(float64); ok {
+					ts[k] = time.UnixMilli(int64(ms)).Sub(a.Received).Round(time.Second).Seconds()
+				}
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		err := enc.Encode(struct {
+			AtSec    float64        `json:"at_sec"`
+			Activity map[string]any `json:"activity"`
+		}{a.Received.Sub(start).Round(time.Second).Seconds(), activity})
+		if err != nil {
+			log.Printf("Error recording activity: %v", err)
+		}
+	}
+
+	config.DiscordRPC = true
+	config.Observe = false
+	config.DiscordIPCPath = server.Path
+	// Whatever the last real run left behind shouldn't end up recorded.
+	config.RestoreState = false
+	return func() {
+		server.Close()
+		if out != os.Stdout {
+			out.Close()
+		}
+	}, nil
+}
@@ -0,0 +1,15 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !discordtest
+
+package lyrarpc
+
+import "errors"
+
+// recordActivities needs the fake Discord client, which is only built in
+// with the discordtest tag to keep it out of release binaries.
+func recordActivities(path string) (func(), error) {
+	return nil, errors.New("--discord-log needs lyra-rpc built with -tags discordtest")
+}
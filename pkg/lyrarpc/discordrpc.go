@@ -0,0 +1,221 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"lyra-rpc/pkg/discord"
+	"lyra-rpc/pkg/presence"
+)
+
+// ExitPresence is what the Discord presence shows once lyra-rpc stops.
+type ExitPresence string
+
+const (
+	// ExitClear clears the presence.
+	ExitClear ExitPresence = "clear"
+	// ExitFreeze keeps the last presence up without its progress bar.
+	ExitFreeze ExitPresence = "freeze"
+	// ExitOffline replaces the presence with an offline card.
+	ExitOffline ExitPresence = "offline"
+)
+
+// ExitConfig configures what the presence does once lyra-rpc stops.
+type ExitConfig struct {
+	Presence ExitPresence `json:"presence"`
+	// LingerSec is how long a frozen or offline presence stays up before
+	// lyra-rpc exits and Discord drops it.
+	LingerSec int `json:"linger_sec"`
+	// The offline card's text and large image. Empty details show
+	// "Offline".
+	OfflineDetails string `json:"offline_details"`
+	OfflineState   string `json:"offline_state"`
+	OfflineImage   string `json:"offline_image"`
+}
+
+// discordClientID is lyra-rpc's own Discord application, which the
+// presence is shown as unless discord_application_id names another.
+const discordClientID = "1474543583473176846"
+
+// discordRPCSink shows the presence through the local Discord client.
+type discordRPCSink struct {
+	client *discord.Client
+
+	// lastKey identifies the activity Discord is showing, so polls that
+	// change nothing don't resend it. It stays stale after a failed update
+	// so the next poll tries again.
+	lastKey string
+	// last is the activity Discord is showing, if any.
+	last    *discord.Activity
+	paused  bool
+	force   bool
+	errors  errorSampler
+	limiter updateLimiter
+	exiting bool
+}
+
+// presenceKey identifies the activity np shows.
+func presenceKey(np *NowPlaying) string {
+	return fmt.Sprintf("%d/%s/%d/%s/%s/%d/%s", np.Playback.TrackID, np.Playback.State, np.Playback.PositionMs, np.Image, np.ArtistImage, np.Listeners, np.LyricsURL+" "+np.SpotifyURL)
+}
+
+// refresh makes the next update resend the activity even if nothing
+// changed.
+func (s *discordRPCSink) refresh() {
+	s.force = true
+}
+
+func (s *discordRPCSink) update(np *NowPlaying) {
+	if np == nil {
+		// exit has already left the presence as on_exit asks.
+		if s.exiting {
+			return
+		}
+		if s.lastKey != "" {
+			err := s.client.SetActivity(nil)
+			presenceState.setDiscordStatus(err)
+			if err != nil {
+				log.Print(tr("Error clearing activity: %v", err))
+			} else {
+				log.Println(tr("No active playback, cleared presence."))
+			}
+		}
+		s.lastKey = ""
+		s.last = nil
+		return
+	}
+
+	// Pausing the presence only hides it from Discord; the other sinks
+	// carry on as usual.
+	if presenceState.isHidden() {
+		if !s.paused {
+			err := s.client.SetActivity(nil)
+			presenceState.setDiscordStatus(err)
+			if err != nil {
+				log.Print(tr("Error clearing activity: %v", err))
+				return
+			}
+			log.Println(tr("Presence paused."))
+			s.paused = true
+		}
+		s.lastKey = ""
+		s.last = nil
+		return
+	}
+	if s.paused {
+		log.Println(tr("Presence resumed."))
+	}
+
+	key := presenceKey(np)
+	if key == s.lastKey && !s.force {
+		return
+	}
+	if !s.limiter.allow(time.Now()) {
+		debugf("Holding back a presence update to stay within Discord's rate limit")
+		return
+	}
+
+	activity := config.Presence.Activity(np.Playback, newTemplateData(np), np.Image, np.ArtistImage)
+	for _, b := range []discord.Button{
+		{Label: config.SpotifyButton.Label, URL: np.SpotifyURL},
+		{Label: config.LyricsButton.Label, URL: np.LyricsURL},
+	} {
+		if b.URL != "" && len(activity.Buttons) < presence.MaxButtons {
+			activity.Buttons = append(activity.Buttons, b)
+		}
+	}
+	err := s.client.SetActivity(activity)
+	presenceState.setDiscordStatus(err)
+	if err != nil {
+		s.errors.fail(err)
+		return
+	}
+	s.errors.ok()
+	s.lastKey = key
+	s.last = activity
+	s.paused = false
+	s.force = false
+}
+
+// exit leaves the presence as on_exit asks once lyra-rpc stops, and
+// reports whether it left one up. Discord drops it as soon as the
+// connection closes, so it has to be held open for it to stay.
+func (s *discordRPCSink) exit() bool {
+	s.exiting = true
+	var activity *discord.Activity
+	switch config.OnExit.Presence {
+	case ExitFreeze:
+		if s.last == nil {
+			break
+		}
+		frozen := *s.last
+		frozen.Timestamps = nil
+		activity = &frozen
+	case ExitOffline:
+		if presenceState.isHidden() {
+			break
+		}
+		details := config.OnExit.OfflineDetails
+		if details == "" {
+			details = tr("Offline")
+		}
+		activity = &discord.Activity{
+			Type:    discord.ActivityListening,
+			Details: details,
+			State:   config.OnExit.OfflineState,
+			Assets:  &discord.Assets{LargeImage: config.OnExit.OfflineImage},
+		}
+	}
+
+	if activity == nil {
+		if s.lastKey != "" {
+			if err := s.client.SetActivity(nil); err != nil {
+				log.Print(tr("Error clearing activity: %v", err))
+			}
+		}
+		return false
+	}
+	if err := s.client.SetActivity(activity); err != nil {
+		log.Printf("Error setting exit presence: %v", err)
+		return false
+	}
+	return true
+}
+
+// Discord drops activity updates past five in 20 seconds, so the presence
+// sends at most that many and holds anything newer until the window
+// allows it.
+const (
+	discordUpdateLimit  = 5
+	discordUpdateWindow = 20 * time.Second
+)
+
+// updateLimiter keeps activity updates within Discord's rate limit.
+// Updates it holds back are coalesced: only the latest is sent once the
+// window allows, by asking the main loop to check again.
+type updateLimiter struct {
+	sent  []time.Time
+	retry *time.Timer
+}
+
+// allow reports whether an update can be sent now, recording it if so.
+func (l *updateLimiter) allow(now time.Time) bool {
+	cutoff := now.Add(-discordUpdateWindow)
+	for len(l.sent) > 0 && !l.sent[0].After(cutoff) {
+		l.sent = l.sent[1:]
+	}
+	if len(l.sent) < discordUpdateLimit {
+		l.sent = append(l.sent, now)
+		return true
+	}
+	if l.retry != nil {
+		l.retry.Stop()
+	}
+	l.retry = time.AfterFunc(l.sent[0].Sub(cutoff), presenceState.poke)
+	return false
+}
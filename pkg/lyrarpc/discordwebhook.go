@@ -0,0 +1,147 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"lyra-rpc/pkg/presence"
+)
+
+type DiscordWebhookConfig struct {
+	Enabled bool   `json:"enabled"`
+	URL     string `json:"url"`
+	// MinPlayingSec is how long a track must play before it's posted, so
+	// skipped tracks don't flood the channel.
+	MinPlayingSec int `json:"min_playing_sec"`
+	// MinIntervalSec is the shortest time between two posts.
+	MinIntervalSec int `json:"min_interval_sec"`
+	// LinkURL and LinkLabel add a link button. LinkURL is a template, e.g.
+	// "https://music.youtube.com/search?q={{urlquery .Title}}".
+	LinkURL   string `json:"link_url"`
+	LinkLabel string `json:"link_label"`
+	Username  string `json:"username"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type discordWebhookSink struct {
+	config DiscordWebhookConfig
+	client *http.Client
+
+	timer    playTimer
+	posted   bool
+	lastPost time.Time
+}
+
+func newDiscordWebhookSink(c DiscordWebhookConfig) *discordWebhookSink {
+	if c.LinkLabel == "" {
+		c.LinkLabel = "Listen"
+	}
+	return &discordWebhookSink{config: c, client: newHTTPClient(15 * time.Second)}
+}
+
+func (s *discordWebhookSink) update(np *NowPlaying) {
+	if s.timer.update(np) {
+		s.posted = false
+	}
+	if np == nil || s.posted {
+		return
+	}
+	if s.timer.playedFor < time.Duration(s.config.MinPlayingSec)*time.Second {
+		return
+	}
+	if time.Since(s.lastPost) < time.Duration(s.config.MinIntervalSec)*time.Second {
+		return
+	}
+
+	s.posted = true
+	s.lastPost = time.Now()
+	data := newTemplateData(np)
+	go func() {
+		if err := s.post(data); err != nil {
+			log.Printf("Error posting to Discord webhook: %v", err)
+		}
+	}()
+}
+
+type webhookEmbed struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	URL         string              `json:"url,omitempty"`
+	Thumbnail   *webhookEmbedImage  `json:"thumbnail,omitempty"`
+	Fields      []webhookEmbedField `json:"fields,omitempty"`
+}
+
+type webhookEmbedImage struct {
+	URL string `json:"url"`
+}
+
+type webhookEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+func (s *discordWebhookSink) post(data presence.Data) error {
+	embed := webhookEmbed{Title: data.Title, Description: data.Artist}
+	if data.ImageURL != "" {
+		embed.Thumbnail = &webhookEmbedImage{URL: data.ImageURL}
+	}
+	if data.Album != "" {
+		embed.Fields = append(embed.Fields, webhookEmbedField{Name: "Album", Value: data.Album, Inline: true})
+	}
+
+	payload := map[string]any{
+		"username":   s.config.Username,
+		"avatar_url": s.config.AvatarURL,
+		"embeds":     []webhookEmbed{embed},
+	}
+
+	endpoint := s.config.URL
+	if s.config.LinkURL != "" {
+		link, err := presence.Render(s.config.LinkURL, data)
+		if err != nil {
+			return err
+		}
+		embed.URL = link
+		payload["embeds"] = []webhookEmbed{embed}
+		payload["components"] = []map[string]any{{
+			"type": 1,
+			"components": []map[string]any{{
+				"type":  2,
+				"style": 5,
+				"label": s.config.LinkLabel,
+				"url":   link,
+			}},
+		}}
+		// Webhooks not owned by an application only send link buttons when
+		// asked to.
+		if strings.Contains(endpoint, "?") {
+			endpoint += "&with_components=true"
+		} else {
+			endpoint += "?with_components=true"
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return &statusError{api: "Discord webhook", status: resp.StatusCode}
+	}
+	return nil
+}
@@ -0,0 +1,973 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"lyra-rpc/pkg/discord"
+	"lyra-rpc/pkg/lyra"
+	"lyra-rpc/pkg/uploader"
+)
+
+// Sink receives every playback update alongside the configured outputs.
+// Update is called with nil once nothing is playing, and must not block on
+// network I/O.
+type Sink interface {
+	Update(np *NowPlaying)
+}
+
+// externalSink adapts a Sink from Options to the internal interface.
+type externalSink struct {
+	Sink
+}
+
+func (s externalSink) update(np *NowPlaying) {
+	s.Update(np)
+}
+
+// Options configures an Engine.
+type Options struct {
+	// Config is used in place of config.json. Start from DefaultConfig so
+	// that anything left unset keeps its default.
+	Config Config
+	// HTTPClient, if set, is used for requests to Lyra and the built-in
+	// image uploaders.
+	HTTPClient *http.Client
+	// Source, if set, replaces polling Lyra for playback.
+	Source lyra.Source
+	// Sinks receive every update in addition to the outputs enabled in
+	// Config.
+	Sinks []Sink
+}
+
+// Engine follows playback and keeps the presence and every other output up
+// to date, as the lyra-rpc binary does.
+//
+// The config, the Lyra servers, and the image cache are shared across the
+// package, so only one engine may run in a process at a time: Start and Run
+// return an error while another is running. Stopping an engine shuts down
+// everything it started, after which a new one may be started; an engine
+// itself can't be started again.
+type Engine struct {
+	opts Options
+
+	// cleanup is run in reverse once the engine stops.
+	cleanup []func()
+	sinks   []sink
+	listens listenTracker
+	events  eventBus
+	// recentEvents are tailed through the control socket.
+	recentEvents presenceLog
+	source       lyra.Source
+	updates      chan lyra.Update
+	// sourceDone is closed once the source gives up.
+	sourceDone chan struct{}
+	discord    *discordRPCSink
+	// holdForDiscord stops polling while Discord is closed, since it's
+	// the only output. discordBack is closed once it's running again, and
+	// is nil unless polling is on hold.
+	holdForDiscord bool
+	discordBack    chan struct{}
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	// heartbeat is received from whenever the loop is free to handle an
+	// update, to tell a wedged loop from an idle one.
+	heartbeat chan struct{}
+	running   atomic.Bool
+	done      chan struct{}
+
+	// What the last update resolved to, so unchanged polls don't look the
+	// track up or upload its artwork again.
+	lastTrackID       int64
+	lastState         string
+	cachedTrack       *lyra.Track
+	cachedImage       string
+	cachedArtistImage string
+	cachedLyricsURL   string
+	cachedSpotifyURL  string
+	coverPending      bool
+	// artworkFor is the track whose artwork is being looked up in the
+	// background, if any. Lookups add their results to artwork.
+	artworkFor int64
+	artworkMu  sync.Mutex
+	artwork    []artworkResult
+	// trackEndTimers check for the next track right as the current one
+	// ends, with poll_at_track_end on.
+	trackEndTimers []*time.Timer
+	// stoppedAt is when playback was first seen stopped, while the last
+	// track is still shown.
+	stoppedAt time.Time
+	detector  eventDetector
+	// snapshotKey identifies the last saved snapshot, or is "-" once it's
+	// been removed.
+	snapshotKey string
+
+	playbackErrors errorSampler
+	// lyraReached is set once Lyra first answers. Until then, and for up
+	// to lyraStartupGrace, failing to reach it is taken as Lyra still
+	// starting up rather than logged as an error each poll.
+	lyraReached   bool
+	lyraWaitSince time.Time
+
+	// panicBackoff is how long to wait after handle panics, doubling each
+	// time it panics again in a row.
+	panicBackoff time.Duration
+}
+
+func New(opts Options) *Engine {
+	return &Engine{
+		opts:      opts,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		heartbeat: make(chan struct{}),
+
+		playbackErrors: errorSampler{what: "fetching playback", alert: "Can't reach Lyra"},
+	}
+}
+
+// Start sets up the configured outputs, logs in to Discord if enabled, and
+// follows playback in the background until Stop is called.
+func (e *Engine) Start() error {
+	if err := e.setup(); err != nil {
+		return err
+	}
+	go e.loop()
+	return nil
+}
+
+// Run is like Start but follows playback on the calling goroutine,
+// returning once the engine stops. Prefer it on macOS, where the Now
+// Playing widget has to be updated from the main thread.
+func (e *Engine) Run() error {
+	if err := e.setup(); err != nil {
+		return err
+	}
+	e.loop()
+	return nil
+}
+
+// Stop clears the presence, shuts the outputs down, and waits for the
+// engine to finish.
+func (e *Engine) Stop() {
+	e.stopOnce.Do(func() { close(e.stop) })
+	if e.running.Load() {
+		<-e.done
+	}
+}
+
+// activeEngine is the engine running in this process, if any.
+var activeEngine atomic.Pointer[Engine]
+
+func (e *Engine) setup() (err error) {
+	select {
+	case <-e.done:
+		return errors.New("the engine has already stopped; start a new one")
+	default:
+	}
+	if !activeEngine.CompareAndSwap(nil, e) {
+		return errors.New("another engine is already running in this process")
+	}
+	defer func() {
+		if err != nil {
+			e.teardown()
+		}
+	}()
+
+	resetShared()
+	config = e.opts.Config
+	applyLowPower(&config)
+	config.Images.GenreDefaults = lowerGenreDefaults(config.Images.GenreDefaults)
+	setupLanguage()
+	servers := config.Servers
+	if len(servers) == 0 {
+		servers = []ServerConfig{{BaseURL: config.BaseURL}}
+	}
+	configureHTTP(config.HTTP)
+	httpClient := e.opts.HTTPClient
+	if httpClient == nil {
+		httpClient = newHTTPClient(0)
+	}
+	lyraServers = nil
+	for _, s := range servers {
+		if s.BaseURL == "" {
+			return fmt.Errorf("servers: base_url is required")
+		}
+		c := lyra.NewClient(s.BaseURL)
+		c.HTTP = httpClient
+		c.MaxImageBytes = config.Images.MaxCoverBytes
+		c.ImageSize = config.Images.CoverSize
+		c.UserID = config.UserID
+		if s.UserID != 0 {
+			c.UserID = s.UserID
+		}
+		lyraServers = append(lyraServers, c)
+	}
+	lyraClient.Store(lyraServers[0])
+	registerUploaders(httpClient)
+	openCache()
+
+	switch config.OnExit.Presence {
+	case "", ExitClear, ExitFreeze, ExitOffline:
+	default:
+		return fmt.Errorf("on_exit presence must be %q, %q, or %q, not %q", ExitClear, ExitFreeze, ExitOffline, config.OnExit.Presence)
+	}
+
+	switch config.ListeningAlong.Match {
+	case "", "track", "album":
+	default:
+		return fmt.Errorf("listening_along match must be \"track\" or \"album\", not %q", config.ListeningAlong.Match)
+	}
+	// Without a user ID, lyra-rpc can't tell whose playback is whose.
+	if config.ListeningAlong.Enabled {
+		for _, c := range lyraServers {
+			if c.UserID == 0 {
+				return fmt.Errorf("listening_along needs user_id to be set for %s", c.BaseURL)
+			}
+		}
+	}
+
+	if config.Images.usesUploader(UploaderImgur) && config.Images.ImgurClientID == "" {
+		return fmt.Errorf("imgur client_id is required when image_uploader is set to \"imgur\"")
+	}
+
+	if config.MetricsAddr != "" {
+		server, err := startMetricsServer(config.MetricsAddr)
+		if err != nil {
+			return fmt.Errorf("starting metrics server: %w", err)
+		}
+		e.closeOnStop(server)
+	}
+
+	if config.Debug.PprofAddr != "" {
+		server, err := startPprofServer(config.Debug.PprofAddr)
+		if err != nil {
+			return fmt.Errorf("starting pprof server: %w", err)
+		}
+		e.closeOnStop(server)
+	}
+
+	if config.Images.usesUploader(UploaderProxy) {
+		if config.Images.Proxy.PublicURL == "" {
+			return fmt.Errorf("proxy public_url is required when uploader is set to \"proxy\"")
+		}
+		server, err := startProxyServer()
+		if err != nil {
+			return fmt.Errorf("starting image proxy: %w", err)
+		}
+		e.closeOnStop(server)
+	}
+
+	if err := e.startPlugins(config.PluginsDir); err != nil {
+		return fmt.Errorf("loading plugins: %w", err)
+	}
+	configured := []ImageUploader{config.Images.Uploader}
+	if config.Images.AnimatedUploader != "" {
+		configured = append(configured, config.Images.AnimatedUploader)
+	}
+	for _, u := range configured {
+		if u == UploaderNone {
+			continue
+		}
+		if _, ok := uploader.Lookup(string(u)); ok {
+			continue
+		}
+		if strings.HasPrefix(string(u), pluginUploaderPrefix) {
+			if config.PluginsDir == "" {
+				return fmt.Errorf("uploader %q needs plugins_dir to be set", u)
+			}
+			return fmt.Errorf("uploader %q isn't provided by any plugin in %s", u, config.PluginsDir)
+		}
+		return fmt.Errorf("unknown uploader %q; expected one of %s", u, strings.Join(uploader.Names(), ", "))
+	}
+
+	if config.LastFM.Enabled {
+		if config.LastFM.SessionKey == "" {
+			return fmt.Errorf("lastfm session_key is required; run \"lyra-rpc lastfm auth\" to get one")
+		}
+		e.listens.addScrobbler(newLastFMScrobbler(config.LastFM))
+	}
+
+	if config.ListenBrainz.Enabled {
+		if config.ListenBrainz.Token == "" {
+			return fmt.Errorf("listenbrainz token is required when listenbrainz is enabled")
+		}
+		e.listens.addScrobbler(newListenBrainzScrobbler(config.ListenBrainz))
+	}
+
+	if config.Audioscrobbler.Enabled {
+		if config.Audioscrobbler.Username == "" || config.Audioscrobbler.Password == "" {
+			return fmt.Errorf("audioscrobbler username and password are required when audioscrobbler is enabled")
+		}
+		e.listens.addScrobbler(newAudioscrobblerScrobbler(config.Audioscrobbler))
+	}
+
+	if config.Maloja.Enabled {
+		if config.Maloja.URL == "" || config.Maloja.APIKey == "" {
+			return fmt.Errorf("maloja url and api_key are required when maloja is enabled")
+		}
+		e.listens.addScrobbler(newMalojaScrobbler(config.Maloja))
+	}
+
+	if config.DiscordBot.Enabled {
+		if config.DiscordBot.Token == "" {
+			return fmt.Errorf("discord_bot token is required when discord_bot is enabled")
+		}
+		e.sinks = append(e.sinks, newDiscordBotSink(config.DiscordBot))
+	}
+
+	if config.DiscordWebhook.Enabled {
+		if config.DiscordWebhook.URL == "" {
+			return fmt.Errorf("discord_webhook url is required when discord_webhook is enabled")
+		}
+		e.sinks = append(e.sinks, newDiscordWebhookSink(config.DiscordWebhook))
+	}
+
+	var recap *recapper
+	if config.History.Enabled {
+		history, err := newHistorySink(config.History)
+		if err != nil {
+			return fmt.Errorf("opening listening history: %w", err)
+		}
+		e.cleanup = append(e.cleanup, history.close)
+		e.sinks = append(e.sinks, history)
+
+		if config.Recap.Enabled {
+			if config.Recap.DiscordWebhookURL == "" && config.Recap.WebhookURL == "" {
+				return fmt.Errorf("recap needs a discord_webhook_url or webhook_url when enabled")
+			}
+			if recap, err = newRecapper(history.db, config.Recap); err != nil {
+				return fmt.Errorf("recap config: %w", err)
+			}
+		}
+	} else if config.Recap.Enabled {
+		return fmt.Errorf("recap needs history to be enabled")
+	}
+
+	if len(config.Webhooks) > 0 {
+		webhooks, err := newWebhookSender(config.Webhooks)
+		if err != nil {
+			return fmt.Errorf("webhooks config: %w", err)
+		}
+		e.events.subscribe(webhooks.handle)
+	}
+
+	if config.Hooks.enabled() {
+		hooks := &execHooks{config: config.Hooks}
+		e.events.subscribe(hooks.handle)
+	}
+
+	var mastodon *mastodonSink
+	if config.Mastodon.Enabled {
+		if config.Mastodon.InstanceURL == "" || config.Mastodon.AccessToken == "" {
+			return fmt.Errorf("mastodon instance_url and access_token are required when mastodon is enabled")
+		}
+		mastodon = newMastodonSink(config.Mastodon)
+		e.sinks = append(e.sinks, mastodon)
+	}
+
+	if config.Telegram.Enabled {
+		if config.Telegram.BotToken == "" || config.Telegram.ChatID == "" {
+			return fmt.Errorf("telegram bot_token and chat_id are required when telegram is enabled")
+		}
+		e.sinks = append(e.sinks, newTelegramSink(config.Telegram))
+	}
+
+	if config.Matrix.Enabled {
+		if config.Matrix.HomeserverURL == "" || config.Matrix.AccessToken == "" || config.Matrix.RoomID == "" {
+			return fmt.Errorf("matrix homeserver_url, access_token, and room_id are required when matrix is enabled")
+		}
+		e.sinks = append(e.sinks, newMatrixSink(config.Matrix))
+	}
+
+	if config.TextFiles.Enabled {
+		textFiles, err := newTextFilesSink(config.TextFiles)
+		if err != nil {
+			return fmt.Errorf("setting up text files: %w", err)
+		}
+		e.sinks = append(e.sinks, textFiles)
+	}
+
+	if config.Overlay.Enabled {
+		overlay := newOverlaySink(config.Overlay)
+		server, err := overlay.start()
+		if err != nil {
+			return fmt.Errorf("starting overlay: %w", err)
+		}
+		e.closeOnStop(server)
+		e.sinks = append(e.sinks, overlay)
+	}
+
+	if config.API.Enabled {
+		api := newAPIServer(config.API)
+		api.mastodon = mastodon
+		server, err := api.start()
+		if err != nil {
+			return fmt.Errorf("starting API server: %w", err)
+		}
+		e.closeOnStop(server)
+		e.sinks = append(e.sinks, api)
+	}
+
+	if config.MQTT.Enabled {
+		mqttSink := newMQTTSink(config.MQTT)
+		mqttSink.start()
+		e.sinks = append(e.sinks, mqttSink)
+	}
+
+	if config.MediaControls {
+		controls, err := startMediaControls()
+		if err != nil {
+			log.Printf("Error setting up media controls: %v", err)
+		} else {
+			e.sinks = append(e.sinks, controls)
+		}
+	}
+
+	for _, s := range e.opts.Sinks {
+		e.sinks = append(e.sinks, externalSink{s})
+	}
+
+	if err := e.startControlSocket(); err != nil {
+		log.Printf("Error starting control socket: %v", err)
+	}
+
+	if config.Observe {
+		e.sinks = append(e.sinks, &observeSink{})
+	} else if config.DiscordRPC {
+		e.holdForDiscord = len(e.sinks) == 0 && len(e.listens.queues) == 0 && !e.events.active() && config.MetricsAddr == ""
+		rpc := discord.NewClient(discordAppID())
+		rpc.Path = config.DiscordIPCPath
+		if rpc.Path == "" {
+			rpc.Path = os.Getenv("DISCORD_IPC_PATH")
+		}
+		// With nothing else to update, Discord not running yet just
+		// means waiting for it.
+		if err := rpc.Connect(); err != nil {
+			if !e.holdForDiscord {
+				return fmt.Errorf("logging in to Discord: %w", err)
+			}
+			debugf("Error logging in to Discord: %v", err)
+		}
+		e.cleanup = append(e.cleanup, func() { rpc.Close() })
+		e.discord = &discordRPCSink{client: rpc, errors: errorSampler{what: "setting activity", alert: "Can't reach Discord"}}
+		e.sinks = append(e.sinks, e.discord)
+	}
+
+	e.source = e.opts.Source
+	if e.source == nil {
+		e.source = lyra.NewMultiPoller(lyraServers, time.Duration(config.PollIntervalSec)*time.Second)
+	}
+	// Everything started with ctx is waited for, so that none of it is
+	// still running once Stop returns.
+	ctx, cancel := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	e.cleanup = append(e.cleanup, func() {
+		cancel()
+		workers.Wait()
+	})
+	if config.Away.Enabled {
+		away := config.Away
+		workers.Go(func() { watchAway(ctx, away) })
+	}
+	if config.Battery.Enabled {
+		battery := config.Battery
+		workers.Go(func() { watchBattery(ctx, battery, e.source) })
+	}
+	workers.Go(func() { network.watch(ctx, e.opts.HTTPClient) })
+	if recap != nil {
+		workers.Go(func() { recap.run(ctx) })
+	}
+	e.updates = make(chan lyra.Update)
+	e.sourceDone = make(chan struct{})
+	workers.Go(func() {
+		defer close(e.sourceDone)
+		if err := e.source.Run(ctx, e.updates); err != nil {
+			log.Printf("Error reading playback: %v", err)
+		}
+	})
+
+	e.running.Store(true)
+	return nil
+}
+
+// resetShared forgets what the last engine left in the package-wide state.
+func resetShared() {
+	presenceState.reset()
+	network.reset()
+	recentImages.mu.Lock()
+	recentImages.entries = nil
+	recentImages.mu.Unlock()
+}
+
+// serve serves on ln in the background, logging why it stopped unless it
+// was shut down.
+func serve(server *http.Server, ln net.Listener, name string) {
+	go func() {
+		if err := server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("%s stopped: %v", name, err)
+		}
+	}()
+}
+
+// serverShutdownTimeout is how long requests still being served get to
+// finish once the engine stops.
+const serverShutdownTimeout = time.Second
+
+// closeOnStop shuts server down once the engine stops.
+func (e *Engine) closeOnStop(server *http.Server) {
+	e.cleanup = append(e.cleanup, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		if server.Shutdown(ctx) != nil {
+			server.Close()
+		}
+	})
+}
+
+func (e *Engine) teardown() {
+	for _, s := range e.sinks {
+		if s, ok := s.(stoppableSink); ok {
+			s.stop()
+		}
+	}
+	for i := len(e.cleanup) - 1; i >= 0; i-- {
+		e.cleanup[i]()
+	}
+	e.cleanup = nil
+	activeEngine.CompareAndSwap(e, nil)
+}
+
+// loop handles updates from the source until the engine is stopped.
+func (e *Engine) loop() {
+	defer close(e.done)
+	defer e.teardown()
+	defer e.clear()
+
+	e.restore()
+	// A dashboard added since setup is another output to keep up to date.
+	if len(e.sinks) > 1 {
+		e.holdForDiscord = false
+	}
+	e.checkDiscord()
+
+	// last is handled again when woken by a source that can't be asked
+	// to check early, so pausing the presence still applies right away.
+	var last lyra.Update
+	for {
+		select {
+		case last = <-e.updates:
+			e.safeHandle(last)
+			e.scheduleTrackEnd(last.Playback)
+			e.checkDiscord()
+		case <-e.discordBack:
+			e.discordBack = nil
+			log.Println(tr("Discord is running again, resuming polling."))
+			e.discord.refresh()
+			e.source.(pausableSource).Resume()
+		case <-presenceState.wake:
+			if w, ok := e.source.(interface{ Wake() }); ok {
+				w.Wake()
+			} else {
+				e.safeHandle(last)
+			}
+		case <-e.sourceDone:
+			log.Println(tr("Playback source stopped, shutting down."))
+			return
+		case <-presenceState.quit:
+			log.Println(tr("Shutting down."))
+			return
+		case <-e.stop:
+			return
+		case <-e.heartbeat:
+		}
+		if e.panicBackoff > 0 && !e.wait(e.panicBackoff) {
+			return
+		}
+	}
+}
+
+// pausableSource is a source that can stop asking Lyra for playback for a
+// while, such as the poller.
+type pausableSource interface {
+	Pause()
+	Resume()
+}
+
+// discordProbeInterval is how often to look for Discord while polling is on
+// hold.
+const discordProbeInterval = 5 * time.Second
+
+// checkDiscord puts polling on hold if Discord has gone away and nothing
+// else needs playback, and starts looking for it to come back.
+func (e *Engine) checkDiscord() {
+	if !e.holdForDiscord || e.discordBack != nil || e.discord.client.Connected() {
+		return
+	}
+	source, ok := e.source.(pausableSource)
+	if !ok {
+		return
+	}
+	source.Pause()
+	log.Println(tr("Discord isn't running, pausing polling until it starts."))
+	back := make(chan struct{})
+	e.discordBack = back
+	go func() {
+		ticker := time.NewTicker(backgroundInterval(discordProbeInterval))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-e.done:
+				return
+			}
+			// Only the local socket is tried, which costs next to
+			// nothing next to a request to Lyra.
+			if e.discord.client.Connect() == nil {
+				close(back)
+				return
+			}
+		}
+	}()
+}
+
+// alive reports whether the loop gets back to waiting for updates within
+// timeout.
+func (e *Engine) alive(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case e.heartbeat <- struct{}{}:
+		return true
+	case <-e.done:
+		return false
+	case <-timer.C:
+		return false
+	}
+}
+
+// safeHandle handles an update, recovering if anything in handle panics so
+// that one bad update costs a single tick rather than the whole daemon.
+// After a panic the track state is forgotten so the next update starts
+// fresh, and the loop backs off before handling another.
+func (e *Engine) safeHandle(update lyra.Update) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			e.panicBackoff = 0
+			return
+		}
+		e.panicBackoff = min(max(2*e.panicBackoff, time.Second), time.Minute)
+		log.Printf("Error handling playback update, retrying in %s: %v\n%s", e.panicBackoff, r, debug.Stack())
+		e.reset()
+	}()
+	e.handle(update)
+}
+
+// wait sleeps for d, reporting false if the engine is stopped or asked to
+// quit in the meantime.
+func (e *Engine) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-presenceState.quit:
+		log.Println(tr("Shutting down."))
+		return false
+	case <-e.stop:
+		return false
+	}
+}
+
+// reset forgets the current track, so the next update looks it up again.
+func (e *Engine) reset() {
+	e.lastTrackID = 0
+	e.lastState = ""
+	e.cachedTrack = nil
+	e.cachedImage = ""
+	e.cachedArtistImage = ""
+	e.cachedLyricsURL = ""
+	e.cachedSpotifyURL = ""
+	e.coverPending = false
+	e.stoppedAt = time.Time{}
+}
+
+// holdStopped reports whether to keep showing the last track a while
+// longer now that nothing is playing, or Lyra reports it stopped or
+// buffering, in case it's only between tracks or devices.
+func (e *Engine) holdStopped() bool {
+	grace := time.Duration(config.StopGraceSec) * time.Second
+	if grace <= 0 || e.cachedTrack == nil {
+		return false
+	}
+	now := time.Now()
+	if e.stoppedAt.IsZero() {
+		e.stoppedAt = now
+		// Check again once the grace period is up, however long the
+		// poll interval.
+		time.AfterFunc(grace, presenceState.poke)
+		debugf("Playback stopped, keeping the presence up for %s", grace)
+	}
+	return now.Sub(e.stoppedAt) < grace
+}
+
+// clear tells every output that playback stopped, so the presence and
+// everything else stop showing the last track once lyra-rpc exits.
+func (e *Engine) clear() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Error clearing outputs: %v\n%s", r, debug.Stack())
+		}
+	}()
+	e.listens.stop()
+	e.emit(nil)
+	linger := e.discord != nil && e.discord.exit()
+	e.publish(nil)
+	e.reset()
+	if linger && config.OnExit.LingerSec > 0 {
+		d := time.Duration(config.OnExit.LingerSec) * time.Second
+		log.Print(tr("Leaving the presence up for %s before exiting.", d))
+		time.Sleep(d)
+	}
+}
+
+// artistNames lists track's artists, comma-separated.
+func artistNames(track *lyra.Track) string {
+	var names []string
+	for _, a := range track.Artists {
+		if name := strings.TrimSpace(a.ArtistName); name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// trackLabel names track as "Title – Artist" for the tray and logs, with
+// the presence's fallbacks standing in for a missing title or artist.
+func trackLabel(track *lyra.Track) string {
+	title := strings.TrimSpace(track.Title)
+	if title == "" {
+		title = config.Presence.UnknownTitle
+	}
+	artists := artistNames(track)
+	if artists == "" {
+		artists = config.Presence.UnknownArtist
+	}
+	if title == "" || artists == "" {
+		return title + artists
+	}
+	return title + " – " + artists
+}
+
+// listenersAlong counts the other playbacks on the same track as track, or
+// with listening_along's match set to "album", the same album.
+func listenersAlong(track *lyra.Track, others []lyra.Playback) int {
+	n := 0
+	for _, other := range others {
+		if other.State != "playing" {
+			continue
+		}
+		if other.TrackID == track.DbID {
+			n++
+			continue
+		}
+		if config.ListeningAlong.Match != "album" || len(track.Albums) == 0 {
+			continue
+		}
+		otherTrack, err := fetchTrack(other.TrackID)
+		if err != nil {
+			debugf("Error fetching track %d another user is playing: %v", other.TrackID, err)
+			continue
+		}
+		if len(otherTrack.Albums) > 0 && otherTrack.Albums[0].DbID == track.Albums[0].DbID {
+			n++
+		}
+	}
+	return n
+}
+
+// concurrently runs fns side by side and waits for all of them. A panic in
+// any of them is raised again in the caller, where safeHandle recovers it.
+func concurrently(fns ...func()) {
+	var wg sync.WaitGroup
+	panics := make(chan any, len(fns))
+	for _, fn := range fns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					panics <- r
+				}
+			}()
+			fn()
+		}()
+	}
+	wg.Wait()
+	select {
+	case r := <-panics:
+		panic(r)
+	default:
+	}
+}
+
+// emit publishes the events np represents.
+func (e *Engine) emit(np *NowPlaying) {
+	for _, ev := range e.detector.next(np) {
+		e.recentEvents.add(ev)
+		e.events.publish(ev)
+	}
+}
+
+// lyraStartupGrace is how long lyra-rpc waits quietly for a Lyra server
+// that hasn't answered since startup, as when both launch at boot, before
+// treating it as failing.
+const lyraStartupGrace = 2 * time.Minute
+
+// waitForLyra reports whether err is Lyra not having come up yet since
+// startup, warning about it once, rather than an error to log.
+func (e *Engine) waitForLyra(err error) bool {
+	if e.lyraReached {
+		return false
+	}
+	if e.lyraWaitSince.IsZero() {
+		e.lyraWaitSince = time.Now()
+		log.Print(tr("Can't reach Lyra yet, retrying in the background: %v", err))
+		return true
+	}
+	if time.Since(e.lyraWaitSince) < lyraStartupGrace {
+		debugf("Still waiting for Lyra: %v", err)
+		return true
+	}
+	return false
+}
+
+// handle brings every output up to date with an update from the playback
+// source.
+func (e *Engine) handle(update lyra.Update) {
+	playback, err := update.Playback, update.Err
+	presenceState.setLyraStatus(err)
+	if err != nil {
+		if !e.waitForLyra(err) {
+			e.playbackErrors.fail(err)
+		}
+		return
+	}
+	if !e.lyraReached {
+		e.lyraReached = true
+		if !e.lyraWaitSince.IsZero() {
+			log.Println(tr("Lyra is reachable now."))
+		}
+	}
+	e.playbackErrors.ok()
+	// Track IDs from one server mean nothing on another, so switching
+	// servers starts over as if it were a new track.
+	if update.Client != nil && update.Client != lyraClient.Load() {
+		lyraClient.Store(update.Client)
+		e.reset()
+		debugf("Following playback on %s", update.Client.BaseURL)
+	}
+	// A private session looks the same as nothing playing to every
+	// output, scrobblers included.
+	if presenceState.isPrivate() {
+		playback = nil
+	}
+
+	if playback == nil || (playback.State != "playing" && playback.State != "paused") {
+		if !presenceState.isPrivate() && e.holdStopped() {
+			return
+		}
+		e.listens.stop()
+		e.emit(nil)
+		e.publish(nil)
+		presenceState.setTrack("")
+		e.forgetSnapshot()
+		e.reset()
+		return
+	}
+
+	e.stoppedAt = time.Time{}
+
+	if presenceState.takeRefresh() {
+		if e.discord != nil {
+			e.discord.refresh()
+		}
+		if playback.TrackID == e.lastTrackID {
+			e.coverPending = true
+		}
+	}
+
+	e.takeArtwork(playback.TrackID)
+	// A previous upload failed transiently; try again now instead of
+	// leaving the placeholder up until the next track change.
+	if e.coverPending && playback.TrackID == e.lastTrackID && e.artworkFor == 0 {
+		e.lookUpArtwork(e.cachedTrack)
+	}
+
+	// A track that failed to load leaves nothing cached, even when only
+	// the state changed since.
+	if playback.TrackID != e.lastTrackID || e.cachedTrack == nil {
+		track, err := fetchTrack(playback.TrackID)
+		if err != nil {
+			log.Print(tr("Error fetching track: %v", err))
+			return
+		}
+		e.cachedTrack = track
+
+		// The links each wait on a different service, so they're looked
+		// up side by side.
+		concurrently(
+			func() { e.cachedLyricsURL = resolveLyricsURL(track) },
+			func() { e.cachedSpotifyURL = resolveSpotifyURL(track) },
+		)
+		// Artwork that has to be uploaded or searched for could hold up
+		// the loop for minutes, so the presence goes up with what's
+		// already known and is updated once the rest is in.
+		cover, coverKnown := knownCover(track)
+		artist, artistKnown := knownArtistImage(track)
+		e.showArtwork(track, cover, artist, nil)
+		if !coverKnown || !artistKnown {
+			e.lookUpArtwork(track)
+		}
+
+		stateLabel := tr("Playing")
+		if playback.State == "paused" {
+			stateLabel = tr("Paused")
+		}
+		log.Printf("%s: %s", stateLabel, trackLabel(track))
+		presenceState.setTrack(trackLabel(track))
+	} else if playback.State != e.lastState {
+		stateLabel := tr("Playing")
+		if playback.State == "paused" {
+			stateLabel = tr("Paused")
+		}
+		log.Printf("%s: %s", stateLabel, trackLabel(e.cachedTrack))
+	}
+
+	e.listens.update(playback, e.cachedTrack)
+	np := &NowPlaying{Playback: playback, Track: e.cachedTrack, Image: e.cachedImage, ArtistImage: e.cachedArtistImage, LyricsURL: e.cachedLyricsURL, SpotifyURL: e.cachedSpotifyURL}
+	if config.ListeningAlong.Enabled {
+		np.Listeners = listenersAlong(e.cachedTrack, update.Others)
+	}
+	e.emit(np)
+	e.publish(np)
+	e.snapshot(np)
+
+	e.lastTrackID = playback.TrackID
+	e.lastState = playback.State
+}
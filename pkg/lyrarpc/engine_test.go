@@ -0,0 +1,85 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"lyra-rpc/pkg/lyra"
+)
+
+// idleSource reports no playback until the engine stops.
+type idleSource struct{}
+
+func (idleSource) Run(ctx context.Context, updates chan<- lyra.Update) error {
+	<-ctx.Done()
+	return nil
+}
+
+// freeAddr returns a loopback address nothing is listening on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// TestEngineRestart starts an engine, stops it, and starts another on the
+// same addresses, which only works if the first let go of them.
+func TestEngineRestart(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	cfg := DefaultConfig()
+	cfg.Observe = true
+	cfg.RestoreState = false
+	cfg.Battery.Enabled = false
+	cfg.Away = AwayConfig{}
+	cfg.Alerts.Enabled = false
+	cfg.MetricsAddr = freeAddr(t)
+	cfg.API = APIConfig{Enabled: true, Listen: freeAddr(t)}
+	cfg.Overlay = OverlayConfig{Enabled: true, Listen: freeAddr(t)}
+
+	first := New(Options{Config: cfg, Source: idleSource{}})
+	if err := first.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(Options{Config: cfg, Source: idleSource{}}).Start(); err == nil {
+		t.Error("a second engine started while the first was running")
+	}
+	presenceState.setPaused(true)
+	first.Stop()
+
+	for _, addr := range []string{cfg.MetricsAddr, cfg.API.Listen, cfg.Overlay.Listen} {
+		if resp, err := http.Get("http://" + addr + "/"); err == nil {
+			resp.Body.Close()
+			t.Errorf("%s still serving after Stop", addr)
+		}
+	}
+	if err := first.Start(); err == nil {
+		t.Error("a stopped engine started again")
+	}
+
+	second := New(Options{Config: cfg, Source: idleSource{}})
+	if err := second.Start(); err != nil {
+		t.Fatalf("starting after Stop: %v", err)
+	}
+	defer second.Stop()
+	if presenceState.isPaused() {
+		t.Error("the presence is still paused from the last engine")
+	}
+	resp, err := http.Get("http://" + cfg.API.Listen + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,123 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// eventType names a change in playback, for outputs that react to
+// transitions rather than to every update.
+type eventType string
+
+const (
+	// eventTrackStarted is a track starting after nothing was playing.
+	eventTrackStarted eventType = "track_started"
+	// eventTrackChanged is one track replacing another.
+	eventTrackChanged eventType = "track_changed"
+	eventPaused       eventType = "paused"
+	eventResumed      eventType = "resumed"
+	eventStopped      eventType = "stopped"
+	// eventSeeked is the position jumping within the same track.
+	eventSeeked eventType = "seeked"
+)
+
+var eventTypes = []eventType{eventTrackStarted, eventTrackChanged, eventPaused, eventResumed, eventStopped, eventSeeked}
+
+// event is a playback transition. NowPlaying is the playback after it, or
+// for eventStopped, the playback that stopped.
+type event struct {
+	Type       eventType
+	NowPlaying *NowPlaying
+}
+
+// seekThreshold is how far the reported position may drift from the
+// expected one before it counts as a seek rather than timing jitter.
+const seekThreshold = 3 * time.Second
+
+// eventDetector turns the stream of snapshots into events.
+type eventDetector struct {
+	// last is the most recent snapshot, so stop events can still describe
+	// the track that stopped.
+	last *NowPlaying
+}
+
+// next returns the events np represents, if any.
+func (d *eventDetector) next(np *NowPlaying) []event {
+	last := d.last
+	if np == nil {
+		if last == nil {
+			return nil
+		}
+		d.last = nil
+		return []event{{Type: eventStopped, NowPlaying: last}}
+	}
+	d.last = np
+
+	switch {
+	case last == nil:
+		return []event{{Type: eventTrackStarted, NowPlaying: np}}
+	case np.Track.DbID != last.Track.DbID:
+		return []event{{Type: eventTrackChanged, NowPlaying: np}}
+	}
+
+	var events []event
+	if np.Playback.State != last.Playback.State {
+		if np.Playback.State == "playing" {
+			events = append(events, event{Type: eventResumed, NowPlaying: np})
+		} else {
+			events = append(events, event{Type: eventPaused, NowPlaying: np})
+		}
+	}
+	drift := np.Playback.EffectivePositionMs() - last.Playback.EffectivePositionMs()
+	if max(drift, -drift) > seekThreshold.Milliseconds() {
+		events = append(events, event{Type: eventSeeked, NowPlaying: np})
+	}
+	return events
+}
+
+// eventBus hands events to everything subscribed to them.
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers []func(event)
+}
+
+// subscribe calls fn for every event from now on. Like sink updates, fn
+// must not block on network I/O.
+func (b *eventBus) subscribe(fn func(event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, fn)
+}
+
+// active reports whether anything is subscribed.
+func (b *eventBus) active() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers) > 0
+}
+
+// publish calls every subscriber in turn, logging and skipping one that
+// panics.
+func (b *eventBus) publish(e event) {
+	b.mu.Lock()
+	subscribers := b.subscribers
+	b.mu.Unlock()
+
+	debugf("Playback event: %s", e.Type)
+	for _, fn := range subscribers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Error handling %s event: %v\n%s", e.Type, r, debug.Stack())
+				}
+			}()
+			fn(e)
+		}()
+	}
+}
@@ -0,0 +1,343 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"lyra-rpc/pkg/lyra"
+)
+
+// resolveCover returns an image URL for the track's album, preferring the
+// Lyra cover and falling back to the configured public artwork sources.
+// uploadErr holds the reason the Lyra cover couldn't be used, if one was
+// attempted, even when a fallback was found instead, so a transient
+// failure is still retried.
+func resolveCover(track *lyra.Track) (url string, uploadErr error) {
+	if len(track.Albums) == 0 {
+		return "", nil
+	}
+	album := track.Albums[0]
+
+	if image, ok := albumOverride(track, album); ok {
+		return image, nil
+	}
+	if key, ok := assetKey(config.Images.AssetKeys.Albums, album.DbID); ok {
+		return key, nil
+	}
+
+	if config.Images.Uploader != UploaderNone {
+		url, err := uploadCover(album.DbID)
+		if err == nil {
+			return url, nil
+		}
+		// Searching the fallbacks is just as much work as uploading,
+		// so it waits too.
+		if errors.Is(err, errUploadDeferred) {
+			debugf("Deferring cover upload for album %d while on battery", album.DbID)
+			return "", err
+		}
+		log.Printf("Error uploading cover: %v", err)
+		uploadErr = err
+	}
+
+	// Fallbacks are cached apart from uploads, so finding one doesn't stop
+	// the Lyra cover from being uploaded once that works again.
+	fallbackKey := lyraImageKey("album-fallback", album.DbID)
+	if url, ok := cache.image(fallbackKey); ok {
+		return url, uploadErr
+	}
+
+	artist := ""
+	if len(track.Artists) > 0 {
+		artist = track.Artists[0].ArtistName
+	}
+
+	for _, fallback := range config.Images.Fallbacks {
+		var err error
+		switch fallback {
+		case FallbackCAA:
+			url, err = searchCoverArtArchive(artist, album.AlbumTitle)
+		case FallbackITunes:
+			url, err = searchITunesArtwork(artist, album.AlbumTitle)
+		case FallbackDeezer:
+			url, err = searchDeezerArtwork(artist, album.AlbumTitle)
+		default:
+			err = fmt.Errorf("unknown artwork fallback %q", fallback)
+		}
+		if err != nil {
+			log.Printf("Error fetching %s artwork: %v", fallback, err)
+			continue
+		}
+		if url != "" {
+			cache.setImage(fallbackKey, url, 0)
+			return url, uploadErr
+		}
+	}
+
+	return "", uploadErr
+}
+
+// knownCover returns the track's cover if it can be found without going
+// over the network, from the config or the cache, reporting false if
+// resolveCover has to look further.
+func knownCover(track *lyra.Track) (string, bool) {
+	if len(track.Albums) == 0 {
+		return "", true
+	}
+	album := track.Albums[0]
+	if image, ok := albumOverride(track, album); ok {
+		return image, true
+	}
+	if key, ok := assetKey(config.Images.AssetKeys.Albums, album.DbID); ok {
+		return key, true
+	}
+	if url, ok := cache.image(lyraImageKey("album", album.DbID)); ok {
+		return url, true
+	}
+	// A fallback can stand in while the upload is tried.
+	fallback, ok := cache.image(lyraImageKey("album-fallback", album.DbID))
+	if config.Images.Uploader != UploaderNone {
+		return fallback, false
+	}
+	return fallback, ok || len(config.Images.Fallbacks) == 0
+}
+
+// knownArtistImage is knownCover for resolveArtistImage.
+func knownArtistImage(track *lyra.Track) (string, bool) {
+	if len(track.Artists) == 0 {
+		return "", true
+	}
+	if key, ok := assetKey(config.Images.AssetKeys.Artists, track.Artists[0].DbID); ok {
+		return key, true
+	}
+	if !config.Images.ArtistImages || config.Images.Uploader == UploaderNone {
+		return "", true
+	}
+	return cache.image(lyraImageKey("artist", track.Artists[0].DbID))
+}
+
+// albumOverride looks up album in the configured overrides, first by ID and
+// then by the track's artists paired with the album title.
+func albumOverride(track *lyra.Track, album lyra.Album) (string, bool) {
+	if len(config.Images.AlbumOverrides) == 0 {
+		return "", false
+	}
+	if image, ok := config.Images.AlbumOverrides[strconv.FormatInt(album.DbID, 10)]; ok {
+		return image, true
+	}
+	for key, image := range config.Images.AlbumOverrides {
+		// Artists such as AC/DC have a slash in their name, so the album
+		// starts after the last one.
+		i := strings.LastIndex(key, "/")
+		if i < 0 || !strings.EqualFold(key[i+1:], album.AlbumTitle) {
+			continue
+		}
+		artistName := key[:i]
+		for _, artist := range track.Artists {
+			if strings.EqualFold(artistName, artist.ArtistName) {
+				return image, true
+			}
+		}
+	}
+	return "", false
+}
+
+// placeholderImage picks the large image shown when a track has no artwork:
+// the upload-failure placeholder if the cover exists but couldn't be
+// uploaded, otherwise the default for the track's genre, otherwise the
+// global default.
+func placeholderImage(track *lyra.Track, uploadErr error) string {
+	failed := uploadErr != nil && !isNotFound(uploadErr) && !errors.Is(uploadErr, errUploadDeferred)
+	if failed && config.Images.UploadFailedImage != "" {
+		return config.Images.UploadFailedImage
+	}
+	for _, genre := range track.Genres {
+		if image, ok := config.Images.GenreDefaults[strings.ToLower(genre.GenreName)]; ok {
+			return image
+		}
+	}
+	return config.Images.DefaultImage
+}
+
+// lowerGenreDefaults returns defaults keyed by lowercase genre name, as
+// placeholderImage looks them up, leaving defaults itself untouched.
+func lowerGenreDefaults(defaults map[string]string) map[string]string {
+	if defaults == nil {
+		return nil
+	}
+	lower := make(map[string]string, len(defaults))
+	for genre, image := range defaults {
+		lower[strings.ToLower(genre)] = image
+	}
+	return lower
+}
+
+// resolveArtistImage returns an image URL for the track's first artist, or
+// an empty string if artist images are disabled or unavailable. An artist
+// mapped to an asset key gets that, even with artist images disabled.
+func resolveArtistImage(track *lyra.Track) string {
+	if len(track.Artists) > 0 {
+		if key, ok := assetKey(config.Images.AssetKeys.Artists, track.Artists[0].DbID); ok {
+			return key
+		}
+	}
+	if !config.Images.ArtistImages || config.Images.Uploader == UploaderNone || len(track.Artists) == 0 {
+		return ""
+	}
+
+	url, err := uploadArtistImage(track.Artists[0].DbID)
+	if errors.Is(err, errUploadDeferred) {
+		return ""
+	}
+	if err != nil {
+		log.Printf("Error uploading artist image: %v", err)
+		return ""
+	}
+	return url
+}
+
+func searchITunesArtwork(artist, album string) (string, error) {
+	query := url.Values{}
+	query.Set("term", strings.TrimSpace(artist+" "+album))
+	query.Set("entity", "album")
+	query.Set("limit", "1")
+
+	resp, err := defaultHTTPClient.Get("https://itunes.apple.com/search?" + query.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("iTunes API returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Results []struct {
+			ArtworkURL100 string `json:"artworkUrl100"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	if len(result.Results) == 0 || result.Results[0].ArtworkURL100 == "" {
+		return "", nil
+	}
+
+	// The search API only returns the 100x100 variant, but the artwork CDN
+	// serves other sizes from the same path.
+	return strings.Replace(result.Results[0].ArtworkURL100, "100x100bb", "600x600bb", 1), nil
+}
+
+func searchDeezerArtwork(artist, album string) (string, error) {
+	q := fmt.Sprintf("album:%q", album)
+	if artist != "" {
+		q = fmt.Sprintf("artist:%q %s", artist, q)
+	}
+	query := url.Values{}
+	query.Set("q", q)
+	query.Set("limit", "1")
+
+	resp, err := defaultHTTPClient.Get("https://api.deezer.com/search/album?" + query.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("deezer API returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data []struct {
+			CoverXL string `json:"cover_xl"`
+		} `json:"data"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	// Deezer reports quota and query errors with a 200 status.
+	if result.Error != nil {
+		return "", fmt.Errorf("deezer API error: %s", result.Error.Message)
+	}
+	if len(result.Data) == 0 {
+		return "", nil
+	}
+	return result.Data[0].CoverXL, nil
+}
+
+func searchCoverArtArchive(artist, album string) (string, error) {
+	q := fmt.Sprintf("releasegroup:%q", album)
+	if artist != "" {
+		q += fmt.Sprintf(" AND artist:%q", artist)
+	}
+	query := url.Values{}
+	query.Set("query", q)
+	query.Set("fmt", "json")
+	query.Set("limit", "1")
+
+	// MusicBrainz rejects requests without a meaningful User-Agent.
+	req, err := http.NewRequest("GET", "https://musicbrainz.org/ws/2/release-group/?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "lyra-rpc (https://github.com/StayBlue/lyra-rpc)")
+
+	resp, err := defaultHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("musicbrainz API returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		ReleaseGroups []struct {
+			ID string `json:"id"`
+		} `json:"release-groups"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if len(result.ReleaseGroups) == 0 {
+		return "", nil
+	}
+
+	// The archive answers with a redirect to the actual image, so resolve it
+	// here rather than handing Discord a URL that might 404.
+	req, err = http.NewRequest(http.MethodHead, fmt.Sprintf("https://coverartarchive.org/release-group/%s/front-500", result.ReleaseGroups[0].ID), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "lyra-rpc (https://github.com/StayBlue/lyra-rpc)")
+	head, err := defaultHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	head.Body.Close()
+
+	if head.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if head.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cover art archive returned status %d", head.StatusCode)
+	}
+	return head.Request.URL.String(), nil
+}
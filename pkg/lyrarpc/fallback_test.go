@@ -0,0 +1,118 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"maps"
+	"testing"
+
+	"lyra-rpc/pkg/lyra"
+)
+
+// useConfig replaces the config and cache for the rest of the test.
+func useConfig(t *testing.T, c Config) {
+	t.Helper()
+	oldConfig, oldCache := config, cache
+	t.Cleanup(func() { config, cache = oldConfig, oldCache })
+	config = c
+	cache = &persistentCache{}
+	cache.open("")
+}
+
+func TestAlbumOverride(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Images.AlbumOverrides = map[string]string{
+		"7":                           "by-id",
+		"AC/DC/Back in Black":         "acdc",
+		"Miles Davis/Kind of Blue":    "miles",
+		"Someone Else/Kind of Blue":   "other",
+		"no slash, never matches any": "none",
+	}
+	useConfig(t, cfg)
+
+	acdc := &lyra.Track{Artists: []lyra.Artist{{ArtistName: "AC/DC"}}}
+	miles := &lyra.Track{Artists: []lyra.Artist{{ArtistName: "John Coltrane"}, {ArtistName: "miles davis"}}}
+	tests := []struct {
+		track  *lyra.Track
+		album  lyra.Album
+		want   string
+		wantOK bool
+	}{
+		{acdc, lyra.Album{DbID: 7, AlbumTitle: "Anything"}, "by-id", true},
+		{acdc, lyra.Album{DbID: 1, AlbumTitle: "back in black"}, "acdc", true},
+		{acdc, lyra.Album{DbID: 1, AlbumTitle: "DC/Back in Black"}, "", false},
+		{miles, lyra.Album{DbID: 2, AlbumTitle: "Kind of Blue"}, "miles", true},
+		{miles, lyra.Album{DbID: 2, AlbumTitle: "Blue"}, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := albumOverride(tt.track, tt.album)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("albumOverride(%v, %q) = %q, %v, want %q, %v", tt.track.Artists, tt.album.AlbumTitle, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestLowerGenreDefaults(t *testing.T) {
+	tests := []struct {
+		in   map[string]string
+		want map[string]string
+	}{
+		{nil, nil},
+		{map[string]string{}, map[string]string{}},
+		{map[string]string{"Jazz": "a", "hip-hop": "b"}, map[string]string{"jazz": "a", "hip-hop": "b"}},
+	}
+	for _, tt := range tests {
+		in := maps.Clone(tt.in)
+		got := lowerGenreDefaults(tt.in)
+		if !maps.Equal(got, tt.want) || (got == nil) != (tt.want == nil) {
+			t.Errorf("lowerGenreDefaults(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+		if !maps.Equal(tt.in, in) {
+			t.Errorf("lowerGenreDefaults changed its argument to %v", tt.in)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.Images.DefaultImage = "default"
+	cfg.Images.GenreDefaults = lowerGenreDefaults(map[string]string{"Jazz": "jazz"})
+	useConfig(t, cfg)
+	track := &lyra.Track{Genres: []lyra.Genre{{GenreName: "JAZZ"}}}
+	if got := placeholderImage(track, nil); got != "jazz" {
+		t.Errorf("placeholderImage = %q, want the Jazz default", got)
+	}
+}
+
+// TestKnownCoverFallback checks that a cached fallback stands in for the
+// cover without counting as the uploaded one.
+func TestKnownCoverFallback(t *testing.T) {
+	track := &lyra.Track{Albums: []lyra.Album{{DbID: 3, AlbumTitle: "Album"}}}
+	tests := []struct {
+		name     string
+		uploader ImageUploader
+		cached   map[string]string
+		want     string
+		wantOK   bool
+	}{
+		{"uploaded", UploaderCatbox, map[string]string{"album:3": "up", "album-fallback:3": "fb"}, "up", true},
+		{"fallback while uploading", UploaderCatbox, map[string]string{"album-fallback:3": "fb"}, "fb", false},
+		{"fallback without uploads", UploaderNone, map[string]string{"album-fallback:3": "fb"}, "fb", true},
+		{"nothing cached", UploaderNone, nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Images.Uploader = tt.uploader
+			cfg.Images.Fallbacks = []ArtworkFallback{FallbackITunes}
+			useConfig(t, cfg)
+			for key, url := range tt.cached {
+				cache.setImage(key, url, 0)
+			}
+			got, ok := knownCover(track)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("knownCover = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
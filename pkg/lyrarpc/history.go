@@ -0,0 +1,242 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+type HistoryConfig struct {
+	Enabled bool `json:"enabled"`
+	// Path is the SQLite database; empty means history.db in the cache
+	// directory.
+	Path string `json:"path"`
+	// RetentionDays deletes listens older than this many days. Zero keeps
+	// them forever.
+	RetentionDays int `json:"retention_days"`
+}
+
+// historyEntry is one completed listen in the history database.
+type historyEntry struct {
+	TrackID    int64     `json:"track_id"`
+	Title      string    `json:"title"`
+	Artists    []string  `json:"artists"`
+	AlbumID    int64     `json:"album_id"`
+	Album      string    `json:"album"`
+	DurationMs int64     `json:"duration_ms"`
+	ListenedMs int64     `json:"listened_ms"`
+	StartedAt  time.Time `json:"started_at"`
+	EndedAt    time.Time `json:"ended_at"`
+}
+
+const historySchema = `
+CREATE TABLE IF NOT EXISTS listens (
+	id INTEGER PRIMARY KEY,
+	track_id INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	artists TEXT NOT NULL,
+	album_id INTEGER NOT NULL,
+	album TEXT NOT NULL,
+	duration_ms INTEGER NOT NULL,
+	listened_ms INTEGER NOT NULL,
+	started_at INTEGER NOT NULL,
+	ended_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS listens_started_at ON listens (started_at);
+`
+
+func historyPath() (string, error) {
+	if config.History.Path != "" {
+		return config.History.Path, nil
+	}
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.db"), nil
+}
+
+// openHistory opens the history database, creating it if needed.
+func openHistory() (*sql.DB, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	// WAL lets the stats and export commands read while lyra-rpc writes.
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func insertHistory(db *sql.DB, e historyEntry) error {
+	artists, err := json.Marshal(e.Artists)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO listens
+		(track_id, title, artists, album_id, album, duration_ms, listened_ms, started_at, ended_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.TrackID, e.Title, string(artists), e.AlbumID, e.Album, e.DurationMs, e.ListenedMs,
+		e.StartedAt.UnixMilli(), e.EndedAt.UnixMilli())
+	return err
+}
+
+// historySink records listens that were played long enough to count, by the
+// same rule as scrobbling.
+type historySink struct {
+	db        *sql.DB
+	retention time.Duration
+	lastPurge time.Time
+
+	current   *historyEntry
+	playedFor time.Duration
+	lastSeen  time.Time
+	lastPosMs int64
+	playing   bool
+}
+
+func newHistorySink(c HistoryConfig) (*historySink, error) {
+	db, err := openHistory()
+	if err != nil {
+		return nil, err
+	}
+	s := &historySink{db: db, retention: time.Duration(c.RetentionDays) * 24 * time.Hour}
+	s.purge()
+	return s, nil
+}
+
+func (s *historySink) update(np *NowPlaying) {
+	now := time.Now()
+	if np == nil {
+		s.finish(now)
+		return
+	}
+
+	// A repeat of the same track shows up as the position jumping back to
+	// the start once the previous play already counted.
+	restarted := s.counts() && np.Playback.PositionMs < s.lastPosMs && np.Playback.PositionMs < 5000
+	if s.current == nil || s.current.TrackID != np.Track.DbID || restarted {
+		s.finish(now)
+		data := newTemplateData(np)
+		s.current = &historyEntry{
+			TrackID:    data.TrackID,
+			Title:      data.Title,
+			Artists:    data.Artists,
+			AlbumID:    data.AlbumID,
+			Album:      data.Album,
+			DurationMs: data.DurationMs,
+			StartedAt:  now.Add(-time.Duration(np.Playback.PositionMs) * time.Millisecond),
+		}
+		s.playedFor = 0
+	} else if s.playing {
+		s.playedFor += now.Sub(s.lastSeen)
+	}
+
+	s.lastSeen = now
+	s.lastPosMs = np.Playback.PositionMs
+	s.playing = np.Playback.State == "playing"
+}
+
+// counts reports whether the current listen has played long enough to be
+// recorded.
+func (s *historySink) counts() bool {
+	if s.current == nil {
+		return false
+	}
+	threshold, countable := scrobbleThreshold(s.current.DurationMs)
+	return countable && s.playedFor >= threshold
+}
+
+// finish records the current listen if it counts, and forgets it.
+func (s *historySink) finish(now time.Time) {
+	if s.current == nil {
+		return
+	}
+	if s.playing {
+		s.playedFor += now.Sub(s.lastSeen)
+	}
+	counts := s.counts()
+	entry := *s.current
+	s.current = nil
+	s.playing = false
+	if !counts {
+		return
+	}
+	entry.ListenedMs = s.playedFor.Milliseconds()
+	entry.EndedAt = now
+	if err := insertHistory(s.db, entry); err != nil {
+		log.Printf("Error recording listen: %v", err)
+	}
+	if time.Since(s.lastPurge) > 24*time.Hour {
+		s.purge()
+	}
+}
+
+// purge deletes listens past the retention period.
+func (s *historySink) purge() {
+	s.lastPurge = time.Now()
+	if s.retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-s.retention).UnixMilli()
+	if _, err := s.db.Exec(`DELETE FROM listens WHERE started_at < ?`, cutoff); err != nil {
+		log.Printf("Error purging old listens: %v", err)
+	}
+}
+
+// close records the listen in progress, if it already counts, and closes
+// the database.
+func (s *historySink) close() {
+	s.finish(time.Now())
+	s.db.Close()
+}
+
+// queryHistory returns the listens started at or after since, oldest first.
+func queryHistory(db *sql.DB, since time.Time) ([]historyEntry, error) {
+	sinceMs := int64(0)
+	if !since.IsZero() {
+		sinceMs = since.UnixMilli()
+	}
+	rows, err := db.Query(`SELECT track_id, title, artists, album_id, album, duration_ms, listened_ms, started_at, ended_at
+		FROM listens WHERE started_at >= ? ORDER BY started_at`, sinceMs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []historyEntry
+	for rows.Next() {
+		var e historyEntry
+		var artists string
+		var startedAt, endedAt int64
+		err := rows.Scan(&e.TrackID, &e.Title, &artists, &e.AlbumID, &e.Album, &e.DurationMs, &e.ListenedMs, &startedAt, &endedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(artists), &e.Artists); err != nil {
+			return nil, err
+		}
+		e.StartedAt = time.UnixMilli(startedAt)
+		e.EndedAt = time.UnixMilli(endedAt)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,125 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func runHistoryCommand(args []string) error {
+	if len(args) == 0 || args[0] != "export" {
+		return fmt.Errorf("usage: lyra-rpc history export [--format csv|json|listenbrainz] [--since YYYY-MM-DD] [--output FILE]")
+	}
+
+	fs := flag.NewFlagSet("history export", flag.ContinueOnError)
+	format := fs.String("format", "csv", "csv, json, or listenbrainz (JSON lines for ListenBrainz imports)")
+	sinceFlag := fs.String("since", "", "only export listens from this date (YYYY-MM-DD) on")
+	output := fs.String("output", "", "write to this file instead of stdout")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	var since time.Time
+	if *sinceFlag != "" {
+		var err error
+		since, err = time.ParseInLocation(time.DateOnly, *sinceFlag, time.Local)
+		if err != nil {
+			return fmt.Errorf("invalid --since date %q, want YYYY-MM-DD", *sinceFlag)
+		}
+	}
+
+	var write func(io.Writer, []historyEntry) error
+	switch *format {
+	case "csv":
+		write = writeHistoryCSV
+	case "json":
+		write = writeHistoryJSON
+	case "listenbrainz":
+		write = writeHistoryListenBrainz
+	default:
+		return fmt.Errorf("unknown format %q; use csv, json, or listenbrainz", *format)
+	}
+
+	db, err := openHistory()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	entries, err := queryHistory(db, since)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := write(out, entries); err != nil {
+		return err
+	}
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "Exported %d listens to %s.\n", len(entries), *output)
+	}
+	return nil
+}
+
+func writeHistoryCSV(w io.Writer, entries []historyEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"started_at", "ended_at", "track_id", "title", "artists", "album_id", "album", "duration_ms", "listened_ms"})
+	for _, e := range entries {
+		cw.Write([]string{
+			e.StartedAt.Format(time.RFC3339),
+			e.EndedAt.Format(time.RFC3339),
+			strconv.FormatInt(e.TrackID, 10),
+			e.Title,
+			strings.Join(e.Artists, ", "),
+			strconv.FormatInt(e.AlbumID, 10),
+			e.Album,
+			strconv.FormatInt(e.DurationMs, 10),
+			strconv.FormatInt(e.ListenedMs, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeHistoryJSON(w io.Writer, entries []historyEntry) error {
+	if entries == nil {
+		entries = []historyEntry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+// writeHistoryListenBrainz writes one listen per line in the format
+// ListenBrainz accepts for imports.
+func writeHistoryListenBrainz(w io.Writer, entries []historyEntry) error {
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		l := listen{TrackID: e.TrackID, Title: e.Title, Artists: e.Artists, Album: e.Album, DurationMs: e.DurationMs, StartedAt: e.StartedAt}
+		err := enc.Encode(listenBrainzPayload{
+			ListenedAt:    e.StartedAt.Unix(),
+			TrackMetadata: listenBrainzMetadata(l),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+
+	"lyra-rpc/pkg/presence"
+)
+
+// HooksConfig holds shell commands run on playback events. Track metadata
+// is passed in LYRA_* environment variables.
+type HooksConfig struct {
+	// OnTrackChange runs both when a track starts and when it changes.
+	OnTrackChange string `json:"on_track_change"`
+	OnPause       string `json:"on_pause"`
+	OnResume      string `json:"on_resume"`
+	OnStop        string `json:"on_stop"`
+	OnSeek        string `json:"on_seek"`
+	// TimeoutSec is how long a command may run before it's killed. Zero
+	// or less uses defaultHookTimeout.
+	TimeoutSec int `json:"timeout_sec"`
+}
+
+const defaultHookTimeout = 10 * time.Second
+
+// command returns the hook to run for t and its name in the config.
+func (c HooksConfig) command(t eventType) (name, command string) {
+	switch t {
+	case eventTrackStarted, eventTrackChanged:
+		return "on_track_change", c.OnTrackChange
+	case eventPaused:
+		return "on_pause", c.OnPause
+	case eventResumed:
+		return "on_resume", c.OnResume
+	case eventStopped:
+		return "on_stop", c.OnStop
+	case eventSeeked:
+		return "on_seek", c.OnSeek
+	}
+	return "", ""
+}
+
+func (c HooksConfig) enabled() bool {
+	return c.OnTrackChange != "" || c.OnPause != "" || c.OnResume != "" || c.OnStop != "" || c.OnSeek != ""
+}
+
+// execHooks runs the configured commands as events come in.
+type execHooks struct {
+	config HooksConfig
+}
+
+func (h *execHooks) handle(e event) {
+	name, command := h.config.command(e.Type)
+	if command == "" {
+		return
+	}
+	env := hookEnv(e.Type, newTemplateData(e.NowPlaying))
+	go h.run(name, command, env)
+}
+
+func (h *execHooks) run(name, command string, env []string) {
+	timeout := time.Duration(h.config.TimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		log.Printf("Error running %s hook: %v", name, err)
+	}
+}
+
+func hookEnv(t eventType, data presence.Data) []string {
+	return []string{
+		"LYRA_EVENT=" + string(t),
+		"LYRA_STATE=" + data.State,
+		"LYRA_TRACK_ID=" + strconv.FormatInt(data.TrackID, 10),
+		"LYRA_TITLE=" + data.Title,
+		"LYRA_ARTIST=" + data.Artist,
+		"LYRA_ALBUM_ID=" + strconv.FormatInt(data.AlbumID, 10),
+		"LYRA_ALBUM=" + data.Album,
+		"LYRA_YEAR=" + strconv.Itoa(data.Year),
+		"LYRA_IMAGE_URL=" + data.ImageURL,
+		"LYRA_POSITION_MS=" + strconv.FormatInt(data.PositionMs, 10),
+		"LYRA_DURATION_MS=" + strconv.FormatInt(data.DurationMs, 10),
+	}
+}
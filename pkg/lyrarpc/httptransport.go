@@ -0,0 +1,79 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"crypto/tls"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPConfig tunes the connections lyra-rpc keeps open to Lyra and every
+// other service it talks to.
+type HTTPConfig struct {
+	// DisableHTTP2 sticks to HTTP/1.1, for proxies that mishandle HTTP/2.
+	DisableHTTP2 bool `json:"disable_http2"`
+	// MaxIdleConnsPerHost is how many idle connections are kept open to
+	// each host for reuse.
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host"`
+	// IdleTimeoutSec is how long an idle connection is kept before it's
+	// closed.
+	IdleTimeoutSec int `json:"idle_timeout_sec"`
+}
+
+// transport is the transport every request goes through. It's replaced
+// when the config changes, so clients made before keep up.
+var transport atomic.Pointer[http.Transport]
+
+func init() {
+	transport.Store(newTransport(DefaultConfig().HTTP))
+}
+
+func newTransport(c HTTPConfig) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.ForceAttemptHTTP2 = !c.DisableHTTP2
+	if c.DisableHTTP2 {
+		// A non-nil, empty map is what turns HTTP/2 off.
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+		t.MaxIdleConns = max(t.MaxIdleConns, 4*c.MaxIdleConnsPerHost)
+	}
+	if c.IdleTimeoutSec > 0 {
+		t.IdleConnTimeout = time.Duration(c.IdleTimeoutSec) * time.Second
+	}
+	return t
+}
+
+// configureHTTP applies c to the shared transport, closing the idle
+// connections of the one it replaces.
+func configureHTTP(c HTTPConfig) {
+	old := transport.Swap(newTransport(c))
+	old.CloseIdleConnections()
+}
+
+// sharedTransport sends requests through whatever transport is current.
+type sharedTransport struct{}
+
+func (sharedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return transport.Load().RoundTrip(req)
+}
+
+// CloseIdleConnections lets http.Client.CloseIdleConnections reach the
+// current transport.
+func (sharedTransport) CloseIdleConnections() {
+	transport.Load().CloseIdleConnections()
+}
+
+// newHTTPClient returns a client using the shared transport. Zero timeout
+// means none.
+func newHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: sharedTransport{}, Timeout: timeout}
+}
+
+// defaultHTTPClient is for one-off requests, such as artwork searches.
+var defaultHTTPClient = newHTTPClient(30 * time.Second)
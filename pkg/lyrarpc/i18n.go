@@ -0,0 +1,53 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"os"
+	"strings"
+
+	"lyra-rpc/pkg/presence"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// languages are those with a message catalog, English first as the
+// fallback.
+var languages = []language.Tag{language.English, language.German, language.Spanish, language.French}
+
+var printer = message.NewPrinter(language.English)
+
+// tr translates a message into the configured language, formatting it like
+// fmt.Sprintf. Messages without a translation are left in English.
+func tr(format string, args ...any) string {
+	return printer.Sprintf(format, args...)
+}
+
+// setupLanguage picks the language from the config, or failing that, the
+// locale in the environment.
+func setupLanguage() {
+	want := config.Language
+	if want == "" {
+		want = localeFromEnv()
+	}
+	tag, _, _ := language.NewMatcher(languages).Match(language.Make(want))
+	printer = message.NewPrinter(tag)
+	presence.SetLanguage(tag)
+
+	config.Presence.Labels = presence.Labels{Playing: tr("Playing"), Paused: tr("Paused"), Live: tr("Live")}
+}
+
+// localeFromEnv reads the locale as POSIX systems set it, e.g. de_DE.UTF-8
+// becomes de-DE.
+func localeFromEnv() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			v, _, _ = strings.Cut(v, ".")
+			return strings.ReplaceAll(v, "_", "-")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,186 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type LastFMConfig struct {
+	Enabled    bool   `json:"enabled"`
+	APIKey     string `json:"api_key"`
+	APISecret  string `json:"api_secret"`
+	SessionKey string `json:"session_key"`
+}
+
+const lastfmAPI = "https://ws.audioscrobbler.com/2.0/"
+
+// lastfmError is an error reported in a Last.fm response body.
+type lastfmError struct {
+	Code    int    `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *lastfmError) Error() string {
+	return fmt.Sprintf("last.fm error %d: %s", e.Code, e.Message)
+}
+
+// retryable reports whether Last.fm considers the failure temporary:
+// service offline (11), temporarily unavailable (16), or rate limited (29).
+func (e *lastfmError) retryable() bool {
+	return e.Code == 11 || e.Code == 16 || e.Code == 29
+}
+
+type lastfmScrobbler struct {
+	config LastFMConfig
+	client *http.Client
+}
+
+func newLastFMScrobbler(c LastFMConfig) *lastfmScrobbler {
+	return &lastfmScrobbler{config: c, client: newHTTPClient(15 * time.Second)}
+}
+
+func (s *lastfmScrobbler) name() string { return "lastfm" }
+
+// call makes a signed API request. Methods that change state are POSTed;
+// everything else is a GET.
+func (s *lastfmScrobbler) call(params url.Values, post bool, v any) error {
+	params.Set("api_key", s.config.APIKey)
+	params.Set("api_sig", lastfmSignature(params, s.config.APISecret))
+	params.Set("format", "json")
+
+	var resp *http.Response
+	var err error
+	if post {
+		resp, err = s.client.PostForm(lastfmAPI, params)
+	} else {
+		resp, err = s.client.Get(lastfmAPI + "?" + params.Encode())
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		lastfmError
+	}
+	raw := json.RawMessage{}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return &statusError{api: "last.fm API", status: resp.StatusCode}
+		}
+		return err
+	}
+	if err := json.Unmarshal(raw, &body); err == nil && body.Code != 0 {
+		return &body.lastfmError
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{api: "last.fm API", status: resp.StatusCode}
+	}
+	if v != nil {
+		return json.Unmarshal(raw, v)
+	}
+	return nil
+}
+
+// lastfmSignature signs params as described in the Last.fm authentication
+// spec: every parameter except format, sorted by name, concatenated as
+// name+value, followed by the secret, MD5-hashed.
+func lastfmSignature(params url.Values, secret string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k != "format" && k != "api_sig" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteString(params.Get(k))
+	}
+	b.WriteString(secret)
+	sum := md5.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *lastfmScrobbler) nowPlaying(l listen) error {
+	params := url.Values{}
+	params.Set("method", "track.updateNowPlaying")
+	params.Set("sk", s.config.SessionKey)
+	params.Set("artist", l.artist())
+	params.Set("track", l.Title)
+	if l.Album != "" {
+		params.Set("album", l.Album)
+	}
+	if l.DurationMs > 0 {
+		params.Set("duration", strconv.FormatInt(l.DurationMs/1000, 10))
+	}
+	return s.call(params, true, nil)
+}
+
+func (s *lastfmScrobbler) scrobble(batch []listen) error {
+	params := url.Values{}
+	params.Set("method", "track.scrobble")
+	params.Set("sk", s.config.SessionKey)
+	for i, l := range batch {
+		params.Set(fmt.Sprintf("artist[%d]", i), l.artist())
+		params.Set(fmt.Sprintf("track[%d]", i), l.Title)
+		params.Set(fmt.Sprintf("timestamp[%d]", i), strconv.FormatInt(l.StartedAt.Unix(), 10))
+		if l.Album != "" {
+			params.Set(fmt.Sprintf("album[%d]", i), l.Album)
+		}
+		if l.DurationMs > 0 {
+			params.Set(fmt.Sprintf("duration[%d]", i), strconv.FormatInt(l.DurationMs/1000, 10))
+		}
+	}
+	return s.call(params, true, nil)
+}
+
+// runLastFMAuth walks the user through Last.fm's desktop authentication
+// flow and prints the resulting session key for the config file.
+func runLastFMAuth() error {
+	if config.LastFM.APIKey == "" || config.LastFM.APISecret == "" {
+		return fmt.Errorf("lastfm api_key and api_secret must be set in config.json first")
+	}
+	s := newLastFMScrobbler(config.LastFM)
+
+	var token struct {
+		Token string `json:"token"`
+	}
+	if err := s.call(url.Values{"method": {"auth.getToken"}}, false, &token); err != nil {
+		return err
+	}
+
+	fmt.Printf("Open this URL and allow access, then press Enter:\n\n  https://www.last.fm/api/auth/?api_key=%s&token=%s\n\n",
+		url.QueryEscape(config.LastFM.APIKey), url.QueryEscape(token.Token))
+	bufio.NewReader(os.Stdin).ReadString('\n')
+
+	var session struct {
+		Session struct {
+			Name string `json:"name"`
+			Key  string `json:"key"`
+		} `json:"session"`
+	}
+	if err := s.call(url.Values{"method": {"auth.getSession"}, "token": {token.Token}}, false, &session); err != nil {
+		return err
+	}
+
+	fmt.Printf("Authenticated as %s. Add this to the lastfm section of config.json:\n\n  \"session_key\": %q\n",
+		session.Session.Name, session.Session.Key)
+	return nil
+}
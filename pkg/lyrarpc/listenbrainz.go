@@ -0,0 +1,107 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type ListenBrainzConfig struct {
+	Enabled bool   `json:"enabled"`
+	Token   string `json:"token"`
+	// APIURL allows submitting to a self-hosted ListenBrainz instance.
+	APIURL string `json:"api_url"`
+}
+
+type listenBrainzScrobbler struct {
+	config ListenBrainzConfig
+	client *http.Client
+}
+
+func newListenBrainzScrobbler(c ListenBrainzConfig) *listenBrainzScrobbler {
+	if c.APIURL == "" {
+		c.APIURL = "https://api.listenbrainz.org"
+	}
+	return &listenBrainzScrobbler{config: c, client: newHTTPClient(15 * time.Second)}
+}
+
+func (s *listenBrainzScrobbler) name() string { return "listenbrainz" }
+
+type listenBrainzPayload struct {
+	ListenedAt    int64                     `json:"listened_at,omitempty"`
+	TrackMetadata listenBrainzTrackMetadata `json:"track_metadata"`
+}
+
+type listenBrainzTrackMetadata struct {
+	ArtistName     string         `json:"artist_name"`
+	TrackName      string         `json:"track_name"`
+	ReleaseName    string         `json:"release_name,omitempty"`
+	AdditionalInfo map[string]any `json:"additional_info"`
+}
+
+func listenBrainzMetadata(l listen) listenBrainzTrackMetadata {
+	info := map[string]any{
+		"submission_client": "lyra-rpc",
+		"artist_names":      l.Artists,
+	}
+	if l.DurationMs > 0 {
+		info["duration_ms"] = l.DurationMs
+	}
+	return listenBrainzTrackMetadata{
+		ArtistName:     strings.Join(l.Artists, ", "),
+		TrackName:      l.Title,
+		ReleaseName:    l.Album,
+		AdditionalInfo: info,
+	}
+}
+
+func (s *listenBrainzScrobbler) submit(listenType string, payload []listenBrainzPayload) error {
+	body, err := json.Marshal(map[string]any{
+		"listen_type": listenType,
+		"payload":     payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(s.config.APIURL, "/")+"/1/submit-listens", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+s.config.Token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{api: "listenbrainz API", status: resp.StatusCode}
+	}
+	return nil
+}
+
+func (s *listenBrainzScrobbler) nowPlaying(l listen) error {
+	return s.submit("playing_now", []listenBrainzPayload{{TrackMetadata: listenBrainzMetadata(l)}})
+}
+
+func (s *listenBrainzScrobbler) scrobble(batch []listen) error {
+	payload := make([]listenBrainzPayload, len(batch))
+	for i, l := range batch {
+		payload[i] = listenBrainzPayload{ListenedAt: l.StartedAt.Unix(), TrackMetadata: listenBrainzMetadata(l)}
+	}
+
+	listenType := "import"
+	if len(batch) == 1 {
+		listenType = "single"
+	}
+	return s.submit(listenType, payload)
+}
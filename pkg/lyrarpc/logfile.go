@@ -0,0 +1,60 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/mattn/go-isatty"
+)
+
+// setupLogging hides the console if configured, makes the console output
+// pretty if asked to and it's a terminal, and sends the log to log_file.
+// Without a console to write to, the log goes to lyra-rpc.log in the cache
+// directory unless log_file says otherwise.
+func setupLogging() {
+	visible := true
+	if config.HideConsole {
+		visible = !hideConsole()
+	}
+	visible = visible && hasConsole()
+
+	var out io.Writer = os.Stderr
+	if visible && config.LogFormat == "pretty" && isatty.IsTerminal(os.Stderr.Fd()) && enableANSI() {
+		console = newPrettyConsole(os.Stderr)
+		out = console
+		log.SetOutput(out)
+	}
+
+	path := config.LogFile
+	if path == "" && !visible {
+		dir, err := cacheDir()
+		if err != nil {
+			return
+		}
+		path = filepath.Join(dir, "lyra-rpc.log")
+	}
+	if path == "" {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		log.Printf("Error opening log file: %v", err)
+		return
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		log.Printf("Error opening log file: %v", err)
+		return
+	}
+	if visible {
+		log.SetOutput(io.MultiWriter(out, f))
+	} else {
+		log.SetOutput(f)
+	}
+}
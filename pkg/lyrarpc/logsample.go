@@ -0,0 +1,69 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"log"
+	"time"
+)
+
+// errorSummaryInterval is how often an error that keeps happening is
+// logged again.
+const errorSummaryInterval = 10 * time.Minute
+
+// errorSampler logs an error that repeats on every poll only when it first
+// happens or changes, then as a periodic summary, and once more when it
+// clears.
+type errorSampler struct {
+	// what is the failing operation, as in "fetching playback".
+	what string
+	// alert, if set, is the title of the desktop alert shown once the
+	// operation has been failing for a while, as in "Can't reach Lyra".
+	alert string
+
+	failing bool
+	since   time.Time
+	lastLog time.Time
+	count   int
+	lastMsg string
+
+	alerted   bool
+	lastAlert time.Time
+}
+
+func (s *errorSampler) fail(err error) {
+	now := time.Now()
+	msg := err.Error()
+	if !s.failing {
+		s.failing, s.since, s.count = true, now, 0
+	}
+	s.count++
+	s.checkAlert(now, err)
+
+	switch {
+	case s.count == 1 || msg != s.lastMsg:
+		log.Print(tr("Error %s: %v", tr(s.what), err))
+	case now.Sub(s.lastLog) >= errorSummaryInterval:
+		log.Print(tr("Still failing %s (x%d over %s): %v", tr(s.what), s.count, now.Sub(s.since).Round(time.Second), err))
+	default:
+		debugf("Error %s: %v", s.what, err)
+		return
+	}
+	s.lastLog = now
+	s.lastMsg = msg
+}
+
+// ok logs that the operation recovered, if it had been failing.
+func (s *errorSampler) ok() {
+	if !s.failing {
+		return
+	}
+	s.clearAlert()
+	if s.count > 1 {
+		log.Print(tr("No more errors %s after %d failures over %s.", tr(s.what), s.count, time.Since(s.since).Round(time.Second)))
+	}
+	s.failing = false
+	s.lastMsg = ""
+}
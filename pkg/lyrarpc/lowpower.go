@@ -0,0 +1,44 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import "time"
+
+// The low_power profile's limits, for running around the clock on
+// something like a Raspberry Pi, next to Lyra itself.
+const (
+	// lowPowerPollIntervalSec is the shortest poll interval it allows.
+	lowPowerPollIntervalSec = 15
+	// lowPowerSlowdown is how much less often background checks, such as
+	// for network changes, run.
+	lowPowerSlowdown = 6
+	// lowPowerCacheBytes caps the URL cache and cover files, unless
+	// cache.max_bytes is lower already.
+	lowPowerCacheBytes = 16 << 20
+)
+
+// applyLowPower adjusts c to the low_power profile, if it's on: longer
+// intervals, covers in their original size so Lyra doesn't re-encode them,
+// and a capped cache. Covers also aren't kept in memory past their upload.
+func applyLowPower(c *Config) {
+	if !c.LowPower {
+		return
+	}
+	c.PollIntervalSec = max(c.PollIntervalSec, lowPowerPollIntervalSec)
+	c.Images.CoverSize = 0
+	if c.Cache.MaxBytes <= 0 || c.Cache.MaxBytes > lowPowerCacheBytes {
+		c.Cache.MaxBytes = lowPowerCacheBytes
+	}
+	debugf("Low-power profile: polling every %ds, cache capped at %d bytes", c.PollIntervalSec, c.Cache.MaxBytes)
+}
+
+// backgroundInterval is how often a background check meant to run every d
+// runs, which is less often with low_power on.
+func backgroundInterval(d time.Duration) time.Duration {
+	if config.LowPower {
+		return d * lowPowerSlowdown
+	}
+	return d
+}
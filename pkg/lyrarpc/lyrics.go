@@ -0,0 +1,118 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"lyra-rpc/pkg/lyra"
+	"lyra-rpc/pkg/presence"
+)
+
+// LyricsButtonConfig adds a button to the presence linking to the lyrics
+// of what's playing.
+type LyricsButtonConfig struct {
+	Enabled bool   `json:"enabled"`
+	Label   string `json:"label"`
+	// GeniusToken is a Genius API client access token. With it, the button
+	// links straight to the song's page; without it, to a Genius search.
+	GeniusToken string `json:"genius_token"`
+	// URL links to another lyrics site instead of Genius. It's a template
+	// whose fields are URL-escaped already, e.g.
+	// "https://example.com/search?q={{.Artist}}+{{.Title}}".
+	URL string `json:"url"`
+}
+
+// lyricsMissTTL is how long a search that found no page is remembered,
+// so the button falls back to a search link without asking every time.
+const lyricsMissTTL = 24 * time.Hour
+
+// resolveLyricsURL returns the link for the lyrics button, or an empty
+// string if it's disabled.
+func resolveLyricsURL(track *lyra.Track) string {
+	c := config.LyricsButton
+	if !c.Enabled {
+		return ""
+	}
+	if c.URL != "" {
+		data := presence.QueryEscaped(presence.NewData(&lyra.Playback{}, track, ""))
+		link, err := presence.Render(c.URL, data)
+		if err != nil {
+			log.Printf("Error rendering lyrics URL: %v", err)
+			return ""
+		}
+		return link
+	}
+
+	// Genius matches best on the main artist alone.
+	query := track.Title
+	if len(track.Artists) > 0 {
+		query = track.Artists[0].ArtistName + " " + query
+	}
+	search := "https://genius.com/search?q=" + url.QueryEscape(query)
+	if c.GeniusToken == "" {
+		return search
+	}
+
+	key := lyraImageKey("lyrics", track.DbID)
+	if link, ok := cache.image(key); ok {
+		return link
+	}
+	link, err := searchGenius(c.GeniusToken, query)
+	if err != nil {
+		log.Printf("Error searching Genius: %v", err)
+		return search
+	}
+	if link == "" {
+		cache.setImage(key, search, lyricsMissTTL)
+		return search
+	}
+	cache.setImage(key, link, 0)
+	return link
+}
+
+// searchGenius returns the page of the best match for query, or an empty
+// string if there's none.
+func searchGenius(token, query string) (string, error) {
+	req, err := http.NewRequest("GET", "https://api.genius.com/search?q="+url.QueryEscape(query), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := defaultHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("genius API returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Response struct {
+			Hits []struct {
+				Type   string `json:"type"`
+				Result struct {
+					URL string `json:"url"`
+				} `json:"result"`
+			} `json:"hits"`
+		} `json:"response"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	for _, hit := range result.Response.Hits {
+		if hit.Type == "song" && hit.Result.URL != "" {
+			return hit.Result.URL, nil
+		}
+	}
+	return "", nil
+}
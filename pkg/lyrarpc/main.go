@@ -0,0 +1,671 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"lyra-rpc/pkg/lyra"
+	"lyra-rpc/pkg/presence"
+	"lyra-rpc/pkg/uploader"
+)
+
+type ImageUploader string
+
+const (
+	UploaderNone      ImageUploader = "none"
+	UploaderLitterbox ImageUploader = "litterbox"
+	UploaderCatbox    ImageUploader = "catbox"
+	UploaderImgur     ImageUploader = "imgur"
+	UploaderProxy     ImageUploader = "proxy"
+)
+
+type ArtworkFallback string
+
+const (
+	FallbackCAA    ArtworkFallback = "caa"
+	FallbackITunes ArtworkFallback = "itunes"
+	FallbackDeezer ArtworkFallback = "deezer"
+)
+
+// UploaderLimits bounds how long an upload to a backend may take and how
+// large an image it will accept. Zero values fall back to the backend's
+// defaults.
+type UploaderLimits struct {
+	TimeoutSec   int   `json:"timeout_sec"`
+	MaxSizeBytes int64 `json:"max_size_bytes"`
+}
+
+var defaultUploaderLimits = map[ImageUploader]UploaderLimits{
+	UploaderLitterbox: {TimeoutSec: 60, MaxSizeBytes: 1 << 30},
+	UploaderCatbox:    {TimeoutSec: 60, MaxSizeBytes: 200 << 20},
+	UploaderImgur:     {TimeoutSec: 20, MaxSizeBytes: 20 << 20},
+}
+
+// ProxyConfig configures the built-in image server used by the "proxy"
+// uploader. PublicURL is the address Discord should fetch covers from, such
+// as a tunnel or port-forwarded hostname pointing at Listen.
+type ProxyConfig struct {
+	Listen    string `json:"listen"`
+	PublicURL string `json:"public_url"`
+	TLSCert   string `json:"tls_cert"`
+	TLSKey    string `json:"tls_key"`
+}
+
+type ImageConfig struct {
+	Uploader      ImageUploader `json:"uploader"`
+	ImgurClientID string        `json:"imgur_client_id"`
+	// ImgurAccessToken makes uploads authenticated, so they land in the
+	// account and can be grouped into ImgurAlbum. With ImgurRefreshToken
+	// and ImgurClientSecret set, an expired token is refreshed automatically.
+	ImgurAccessToken  string `json:"imgur_access_token"`
+	ImgurRefreshToken string `json:"imgur_refresh_token"`
+	ImgurClientSecret string `json:"imgur_client_secret"`
+	ImgurAlbum        string `json:"imgur_album"`
+	// CatboxUserhash optionally ties catbox uploads to an account.
+	CatboxUserhash string `json:"catbox_userhash"`
+	// AnimatedUploader, when set, is used instead of Uploader for animated
+	// covers, e.g. to keep them off a backend that flattens animation.
+	AnimatedUploader ImageUploader     `json:"animated_uploader"`
+	Fallbacks        []ArtworkFallback `json:"fallbacks"`
+	ArtistImages     bool              `json:"artist_images"`
+	// UploadAttempts bounds how many times a single upload is tried before
+	// giving up until the next poll.
+	UploadAttempts int                              `json:"upload_attempts"`
+	Limits         map[ImageUploader]UploaderLimits `json:"limits"`
+	// MaxCoverBytes is the largest image accepted from Lyra. Zero disables
+	// the check.
+	MaxCoverBytes int64 `json:"max_cover_bytes"`
+	// CoverSize asks Lyra for artwork scaled to this many pixels instead
+	// of the original files, where it supports that. Zero asks for the
+	// originals.
+	CoverSize int         `json:"cover_size"`
+	Proxy     ProxyConfig `json:"proxy"`
+	// DefaultImage, GenreDefaults and UploadFailedImage are Discord asset
+	// keys or image URLs shown when a track has no usable artwork.
+	// GenreDefaults is keyed by genre name, in any case.
+	DefaultImage      string            `json:"default_image"`
+	GenreDefaults     map[string]string `json:"genre_defaults"`
+	UploadFailedImage string            `json:"upload_failed_image"`
+	// AlbumOverrides replaces an album's artwork with a fixed asset key or
+	// URL. Keys are either an album ID or "Artist/Album", case-insensitive.
+	AlbumOverrides map[string]string `json:"album_overrides"`
+	// AssetKeys shows albums and artists with assets of the custom
+	// Discord application rather than uploading their artwork.
+	AssetKeys AssetKeys `json:"asset_keys"`
+}
+
+// ServerConfig is one Lyra server to follow playback on.
+type ServerConfig struct {
+	BaseURL string `json:"base_url"`
+	// UserID overrides the top-level user_id for this server.
+	UserID int64 `json:"user_id"`
+}
+
+// ListeningAlongConfig shows other users on a shared server playing the
+// same music as a party in the presence.
+type ListeningAlongConfig struct {
+	Enabled bool `json:"enabled"`
+	// Match is "track" (the default) to count users on the same track, or
+	// "album" to count anyone on the same album.
+	Match string `json:"match"`
+}
+
+type Config struct {
+	// ConfigVersion is the version of the config's layout, so older files
+	// can be migrated as options change.
+	ConfigVersion int    `json:"config_version"`
+	BaseURL       string `json:"base_url"`
+	// Servers, if set, replaces BaseURL with several Lyra servers. The
+	// presence follows the first of them that's playing.
+	Servers []ServerConfig `json:"servers"`
+	// UserID is whose playback to follow on a server shared with others.
+	// Zero follows whichever playback Lyra lists first.
+	UserID          int64                `json:"user_id"`
+	ListeningAlong  ListeningAlongConfig `json:"listening_along"`
+	PollIntervalSec int                  `json:"poll_interval_sec"`
+	// LowPower trades responsiveness for less CPU, memory, and disk, for
+	// running around the clock on a small machine such as a Raspberry Pi.
+	LowPower bool `json:"low_power"`
+	// PollAtTrackEnd checks for the next track right as the current one
+	// ends, rather than waiting for the next poll.
+	PollAtTrackEnd bool          `json:"poll_at_track_end"`
+	Battery        BatteryConfig `json:"battery"`
+	HTTP           HTTPConfig    `json:"http"`
+	// StopGraceSec is how long the last track stays up once playback
+	// stops, in case it's only switching tracks or devices.
+	StopGraceSec int `json:"stop_grace_sec"`
+	// RestoreState shows what was playing when lyra-rpc last stopped
+	// straight away on start, if it was only minutes ago, instead of
+	// waiting for the first poll.
+	RestoreState bool        `json:"restore_state"`
+	Cache        CacheConfig `json:"cache"`
+	Images       ImageConfig `json:"images"`
+	// LogLevel is "info" or "debug".
+	LogLevel string `json:"log_level"`
+	// Language is the language for the log, tray, dashboard, and presence
+	// labels, such as "de". Empty uses the system locale.
+	Language string `json:"language"`
+	// LogFormat is "text", or "pretty" for colors and a spinner on an
+	// interactive terminal. Pretty falls back to text anywhere else.
+	LogFormat string `json:"log_format"`
+	// LogFile, if set, is appended to with everything that's logged.
+	LogFile string `json:"log_file"`
+	// CrashDump keeps a file with the log, config, and stacks for bug
+	// reports when lyra-rpc crashes.
+	CrashDump CrashDumpConfig `json:"crash_dump"`
+	// HideConsole detaches from the console on Windows, so starting
+	// lyra-rpc from a shortcut doesn't leave a window open. The log goes to
+	// LogFile, or lyra-rpc.log in the cache directory.
+	HideConsole bool `json:"hide_console"`
+	// MetricsAddr, when set, serves Prometheus metrics at /metrics.
+	MetricsAddr  string             `json:"metrics_addr"`
+	Alerts       AlertsConfig       `json:"alerts"`
+	Debug        DebugConfig        `json:"debug"`
+	Presence     presence.Templates `json:"presence"`
+	LyricsButton LyricsButtonConfig `json:"lyrics_button"`
+	// SpotifyButton comes before LyricsButton when both are enabled.
+	SpotifyButton SpotifyButtonConfig `json:"spotify_button"`
+	LastFM        LastFMConfig        `json:"lastfm"`
+	ListenBrainz  ListenBrainzConfig  `json:"listenbrainz"`
+	// Audioscrobbler covers Libre.fm and GNU FM servers.
+	Audioscrobbler AudioscrobblerConfig `json:"audioscrobbler"`
+	Maloja         MalojaConfig         `json:"maloja"`
+	// DiscordRPC shows the presence through the local Discord client.
+	// Turn it off to run headless, e.g. with only DiscordBot.
+	DiscordRPC bool `json:"discord_rpc"`
+	// DiscordIPCPath is the Discord socket or named pipe to connect to,
+	// for when it isn't found on its own, such as in a container. The
+	// DISCORD_IPC_PATH environment variable is used if it's empty.
+	DiscordIPCPath string `json:"discord_ipc_path"`
+	// DiscordApplicationID shows the presence as the user's own Discord
+	// application instead of lyra-rpc's, whose art assets
+	// images.asset_keys can then use.
+	DiscordApplicationID string     `json:"discord_application_id"`
+	OnExit               ExitConfig `json:"on_exit"`
+	Away                 AwayConfig `json:"away"`
+	// Observe logs the presence instead of showing it, leaving Discord
+	// alone entirely while every other output runs as usual.
+	Observe        bool                 `json:"observe"`
+	DiscordBot     DiscordBotConfig     `json:"discord_bot"`
+	DiscordWebhook DiscordWebhookConfig `json:"discord_webhook"`
+	Mastodon       MastodonConfig       `json:"mastodon"`
+	Telegram       TelegramConfig       `json:"telegram"`
+	Matrix         MatrixConfig         `json:"matrix"`
+	History        HistoryConfig        `json:"history"`
+	Recap          RecapConfig          `json:"recap"`
+	Webhooks       []WebhookConfig      `json:"webhooks"`
+	Hooks          HooksConfig          `json:"hooks"`
+	TextFiles      TextFilesConfig      `json:"text_files"`
+	Overlay        OverlayConfig        `json:"overlay"`
+	API            APIConfig            `json:"api"`
+	MQTT           MQTTConfig           `json:"mqtt"`
+	// MediaControls mirrors playback into the operating system's media
+	// controls: MPRIS on Linux, the System Media Transport Controls on
+	// Windows, and the Now Playing widget on macOS.
+	MediaControls bool `json:"media_controls"`
+	// Tray shows an icon with quick controls in the system tray or menu
+	// bar.
+	Tray bool `json:"tray"`
+	// PluginsDir holds external executables acting as sinks or uploaders.
+	// Empty, the default, runs none.
+	PluginsDir string `json:"plugins_dir"`
+}
+
+var config = DefaultConfig()
+
+// DefaultConfig returns the settings used for anything config.json leaves
+// out.
+func DefaultConfig() Config {
+	return Config{
+		ConfigVersion:   configVersion,
+		BaseURL:         "http://localhost:3000",
+		PollIntervalSec: 5,
+		Battery:         BatteryConfig{Enabled: true, PollMultiplier: 3},
+		HTTP:            HTTPConfig{MaxIdleConnsPerHost: 4, IdleTimeoutSec: 90},
+		StopGraceSec:    10,
+		RestoreState:    true,
+		Alerts:          AlertsConfig{Enabled: true, AfterMin: 10},
+		LogLevel:        "info",
+		DiscordRPC:      true,
+		Presence:        presence.DefaultTemplates,
+		LyricsButton:    LyricsButtonConfig{Label: "Lyrics"},
+		SpotifyButton:   SpotifyButtonConfig{Label: "Spotify"},
+		OnExit: ExitConfig{
+			Presence:     ExitClear,
+			LingerSec:    30,
+			OfflineImage: "logo-dark",
+		},
+		Away:      AwayConfig{IdleMin: 10, WhenLocked: true},
+		CrashDump: CrashDumpConfig{LogLines: defaultCrashLogLines},
+		Telegram: TelegramConfig{
+			Template:       "🎵 {{.Title}} by {{.Artist}}{{if .Album}}\n💿 {{.Album}}{{end}}",
+			MinPlayingSec:  30,
+			MinIntervalSec: 60,
+			AttachArtwork:  true,
+		},
+		Matrix: MatrixConfig{
+			Template:       "🎵 {{.Title}} by {{.Artist}}{{if .Album}} from {{.Album}}{{end}}",
+			MinPlayingSec:  30,
+			MinIntervalSec: 60,
+		},
+		Hooks: HooksConfig{
+			TimeoutSec: 10,
+		},
+		DiscordWebhook: DiscordWebhookConfig{
+			MinPlayingSec:  30,
+			MinIntervalSec: 60,
+		},
+		Recap: RecapConfig{
+			Period:  "week",
+			At:      "20:00",
+			Weekday: "sunday",
+			Limit:   5,
+			Title:   "Your {{.Period}} in music",
+		},
+		Mastodon: MastodonConfig{
+			Template:      "#nowplaying {{.Title}} by {{.Artist}}{{if .Album}} from {{.Album}}{{end}}",
+			Visibility:    "unlisted",
+			Mode:          MastodonPerTrack,
+			MinPlayingSec: 30,
+			AttachArtwork: true,
+		},
+		TextFiles: TextFilesConfig{
+			Dir:         "nowplaying",
+			ClearOnStop: true,
+		},
+		Overlay: OverlayConfig{Listen: "127.0.0.1:8788"},
+		API:     APIConfig{Listen: "127.0.0.1:8789"},
+		MQTT: MQTTConfig{
+			Broker:      "tcp://localhost:1883",
+			ClientID:    "lyra-rpc",
+			TopicPrefix: "lyra-rpc",
+			Retain:      true,
+			HomeAssistant: HomeAssistantConfig{
+				DiscoveryPrefix: "homeassistant",
+				NodeID:          "lyra_rpc",
+			},
+		},
+		Images: ImageConfig{
+			Uploader:       UploaderNone,
+			UploadAttempts: 3,
+			Proxy:          ProxyConfig{Listen: ":8787"},
+			ImgurAlbum:     "lyra-rpc covers",
+			MaxCoverBytes:  25 << 20,
+			DefaultImage:   "logo-dark",
+		},
+	}
+}
+
+// usesUploader reports whether u is configured for any kind of image.
+func (c ImageConfig) usesUploader(u ImageUploader) bool {
+	return c.Uploader == u || c.AnimatedUploader == u
+}
+
+// uploaderLimits returns the configured limits for u, filling in anything
+// left unset from the backend defaults.
+func uploaderLimits(u ImageUploader) UploaderLimits {
+	limits := config.Images.Limits[u]
+	defaults := defaultUploaderLimits[u]
+	if limits.TimeoutSec <= 0 {
+		limits.TimeoutSec = defaults.TimeoutSec
+	}
+	if limits.MaxSizeBytes <= 0 {
+		limits.MaxSizeBytes = defaults.MaxSizeBytes
+	}
+	return limits
+}
+
+// openCache loads the persistent cache, leaving it in memory only if that
+// fails.
+func openCache() {
+	if path, err := defaultCachePath(); err != nil {
+		log.Printf("Persistent cache disabled: %v", err)
+	} else if err := cache.open(path); err != nil {
+		log.Printf("Error loading cache: %v", err)
+	}
+}
+
+func loadConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	data, err = migrateConfig(path, data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &config)
+}
+
+// lyraServers are the configured Lyra servers, in order of priority.
+var lyraServers []*lyra.Client
+
+// lyraClient is the server the current playback is on, where its track,
+// artwork, and playback commands go.
+var lyraClient atomic.Pointer[lyra.Client]
+
+// lyraKeyPrefix keeps cache entries for any server but the first apart, as
+// IDs only mean something on the server they came from.
+func lyraKeyPrefix() string {
+	c := lyraClient.Load()
+	if len(lyraServers) == 0 || c == lyraServers[0] {
+		return ""
+	}
+	return c.BaseURL + "/"
+}
+
+// lyraImageKey is the cache key for an image from the current server.
+func lyraImageKey(kind string, id int64) string {
+	return lyraKeyPrefix() + imageKey(kind, id)
+}
+
+func uploadCover(albumID int64) (string, error) {
+	return uploadLyraImage(lyraImageKey("album", albumID), lyra.AlbumCoverPath(albumID))
+}
+
+func uploadArtistImage(artistID int64) (string, error) {
+	return uploadLyraImage(lyraImageKey("artist", artistID), lyra.ArtistImagePath(artistID))
+}
+
+// uploadFlights keeps overlapping polls and prefetches from uploading the
+// same image twice. Keys are either cache keys or content hashes.
+var uploadFlights flightGroup[string]
+
+// uploadLyraImage downloads an image from the given Lyra API path and
+// re-hosts it with the configured uploader, remembering the resulting URL in
+// the persistent cache under key.
+func uploadLyraImage(key string, path string) (string, error) {
+	if config.Images.Uploader == UploaderNone {
+		return "", fmt.Errorf("image uploads disabled")
+	}
+
+	if url, ok := cache.image(key); ok {
+		return url, nil
+	}
+	if uploadsDeferred() {
+		return "", errUploadDeferred
+	}
+
+	return uploadFlights.do(key, func() (string, error) {
+		return downloadAndUpload(key, path)
+	})
+}
+
+// recentImagesMax is how many images downloaded from Lyra are kept in
+// memory. Covers can be large, so only the current track's few at most, and
+// none with low_power on.
+const recentImagesMax = 2
+
+// recentImages and imageFlights let every output showing the same artwork
+// share a single download of it.
+var (
+	recentImages struct {
+		mu      sync.Mutex
+		entries []recentImage
+	}
+	imageFlights flightGroup[[]byte]
+)
+
+type recentImage struct {
+	key  string
+	data []byte
+}
+
+// fetchLyraImage downloads an image from the given Lyra API path, or
+// returns it from memory if it was downloaded just now. Callers must not
+// modify the result.
+func fetchLyraImage(path string) ([]byte, error) {
+	key := lyraKeyPrefix() + path
+	recentImages.mu.Lock()
+	for _, e := range recentImages.entries {
+		if e.key == key {
+			recentImages.mu.Unlock()
+			return e.data, nil
+		}
+	}
+	recentImages.mu.Unlock()
+
+	return imageFlights.do(key, func() ([]byte, error) {
+		data, err := lyraClient.Load().Image(path)
+		if err != nil {
+			return nil, err
+		}
+		if config.LowPower {
+			return data, nil
+		}
+		recentImages.mu.Lock()
+		recentImages.entries = append(recentImages.entries, recentImage{key: key, data: data})
+		if len(recentImages.entries) > recentImagesMax {
+			recentImages.entries = recentImages.entries[1:]
+		}
+		recentImages.mu.Unlock()
+		return data, nil
+	})
+}
+
+func downloadAndUpload(key string, path string) (string, error) {
+	// Another caller may have finished the same upload while we waited.
+	if url, ok := cache.image(key); ok {
+		return url, nil
+	}
+
+	data, err := fetchLyraImage(path)
+	if err != nil {
+		return "", err
+	}
+	imageData := bytes.NewBuffer(data)
+
+	// Albums frequently share artwork (deluxe editions, singles), so the
+	// upload itself is also deduplicated and cached by content.
+	sum := sha256.Sum256(imageData.Bytes())
+	hashKey := "sha256:" + hex.EncodeToString(sum[:])
+
+	format := uploader.DetectFormat(imageData.Bytes())
+	backend := config.Images.Uploader
+	if format.Animated && config.Images.AnimatedUploader != "" {
+		backend = config.Images.AnimatedUploader
+	}
+
+	url, err := uploadFlights.do(hashKey, func() (string, error) {
+		if url, ok := cache.image(hashKey); ok {
+			return url, nil
+		}
+		return uploadImage(hashKey, backend, format, imageData)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	cache.setImage(key, url, uploadTTL(backend))
+	return url, nil
+}
+
+// uploadTTL is how long a URL from backend stays valid, or zero if it
+// doesn't expire.
+func uploadTTL(backend ImageUploader) time.Duration {
+	if backend == UploaderLitterbox {
+		return litterboxExpiry
+	}
+	return 0
+}
+
+// uploadImage re-hosts imageData on backend and caches the result under key.
+// The bytes are passed through untouched so animated covers keep animating.
+func uploadImage(key string, backend ImageUploader, format uploader.Format, imageData *bytes.Buffer) (string, error) {
+	u, ok := uploader.Lookup(string(backend))
+	if !ok {
+		return "", fmt.Errorf("unknown image uploader %q", backend)
+	}
+	limits := uploaderLimits(backend)
+	if limits.MaxSizeBytes > 0 && int64(imageData.Len()) > limits.MaxSizeBytes {
+		return "", fmt.Errorf("image is %d bytes, over the %s limit of %d", imageData.Len(), backend, limits.MaxSizeBytes)
+	}
+	timeout := time.Duration(limits.TimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	meta := uploader.Meta{Format: format, Filename: "cover." + format.Ext}
+
+	defer spin(tr("Uploading artwork…"))()
+	start := time.Now()
+	url, err := retryUpload(uploaderHosts[backend], func() (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return u.Upload(ctx, imageData.Bytes(), meta)
+	})
+	recordUpload(backend, imageData.Len(), time.Since(start), err)
+	if err != nil {
+		return "", err
+	}
+
+	cache.setImage(key, url, uploadTTL(backend))
+	return url, nil
+}
+
+// uploaderHosts is the host each built-in uploader talks to, for rate
+// limiting. Uploads to anything else aren't rate limited.
+var uploaderHosts = map[ImageUploader]string{
+	UploaderLitterbox: "litterbox.catbox.moe",
+	UploaderCatbox:    "catbox.moe",
+	UploaderImgur:     "api.imgur.com",
+}
+
+// registerUploaders registers the built-in uploaders, configured from the
+// config file and using httpClient if it's set. Plugins register their own
+// as they start.
+func registerUploaders(httpClient *http.Client) {
+	uploader.Register(string(UploaderLitterbox), &uploader.Litterbox{HTTP: httpClient})
+	uploader.Register(string(UploaderCatbox), &uploader.Catbox{UserHash: config.Images.CatboxUserhash, HTTP: httpClient})
+	uploader.Register(string(UploaderImgur), &uploader.Imgur{
+		ClientID:     config.Images.ImgurClientID,
+		ClientSecret: config.Images.ImgurClientSecret,
+		AccessToken:  config.Images.ImgurAccessToken,
+		RefreshToken: config.Images.ImgurRefreshToken,
+		Album:        config.Images.ImgurAlbum,
+		HTTP:         httpClient,
+	})
+	uploader.Register(string(UploaderProxy), uploader.Func(func(ctx context.Context, image []byte, meta uploader.Meta) (string, error) {
+		return storeProxyImage(image, meta.Format.Ext)
+	}))
+}
+
+// trackFlights keeps outputs and the engine that want the same track at
+// once from each asking Lyra for it.
+var trackFlights flightGroup[*lyra.Track]
+
+func fetchTrack(id int64) (*lyra.Track, error) {
+	// Only the first server's tracks are kept across restarts.
+	persist := lyraKeyPrefix() == ""
+	if track, ok := cache.track(id); ok && persist {
+		return track, nil
+	}
+	return trackFlights.do(lyraKeyPrefix()+strconv.FormatInt(id, 10), func() (*lyra.Track, error) {
+		return loadTrack(id, persist)
+	})
+}
+
+func loadTrack(id int64, persist bool) (*lyra.Track, error) {
+	inc := []string{"albums", "artists"}
+	// Genres are only needed to pick a per-genre placeholder.
+	if len(config.Images.GenreDefaults) > 0 {
+		inc = append(inc, "genres")
+	}
+
+	track, err := lyraClient.Load().Track(id, inc...)
+	if err != nil {
+		return nil, err
+	}
+
+	if persist {
+		cache.setTrack(track)
+	}
+	return track, nil
+}
+
+// Main runs the lyra-rpc command: the engine configured from config.json,
+// or one of the subcommands.
+func Main() {
+	if runWindowsService() {
+		return
+	}
+	if err := loadConfig("config.json"); err != nil {
+		if !os.IsNotExist(err) {
+			log.Fatalf("Error loading config: %v", err)
+		}
+	}
+	setupLanguage()
+
+	// `lyra-rpc tui` runs as usual, but with a dashboard instead of the log.
+	tui := len(os.Args) > 1 && os.Args[1] == "tui"
+	if len(os.Args) > 1 && !tui {
+		openCache()
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	runDaemon(tui, nil)
+}
+
+// runDaemon runs the engine until it's told to quit, with a dashboard if
+// tui is set. A nil source polls Lyra.
+func runDaemon(tui bool, source lyra.Source) {
+	if !tui {
+		setupLogging()
+	}
+	startCrashDump()
+	engine := New(Options{Config: config, Source: source})
+	if err := engine.setup(); err != nil {
+		fatal(err)
+	}
+	if config.Observe {
+		log.Println(tr("Observing: logging the presence instead of showing it in Discord. Press Ctrl+C to exit."))
+	} else if config.DiscordRPC {
+		log.Println(tr("Rich presence is running. Press Ctrl+C to exit."))
+	} else {
+		log.Println(tr("Running without the Discord client. Press Ctrl+C to exit."))
+	}
+
+	sdNotify("READY=1")
+	startWatchdog(engine)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, shutdownSignals...)
+	go func() {
+		<-sig
+		log.Println(tr("Shutting down."))
+		sdNotify("STOPPING=1")
+		go engine.Stop()
+		// A second signal gives up on shutting down cleanly, in case
+		// something hangs.
+		<-sig
+		fatal(tr("Exiting without cleaning up."))
+	}()
+
+	if tui {
+		dashboard := &tuiSink{}
+		engine.sinks = append(engine.sinks, dashboard)
+		runTUI(dashboard, engine.loop)
+	} else if config.Tray {
+		runTray(engine.loop)
+	} else {
+		engine.loop()
+	}
+	finishCrashDump()
+}
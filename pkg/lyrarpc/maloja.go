@@ -0,0 +1,76 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type MalojaConfig struct {
+	Enabled bool   `json:"enabled"`
+	URL     string `json:"url"`
+	APIKey  string `json:"api_key"`
+}
+
+type malojaScrobbler struct {
+	config MalojaConfig
+	client *http.Client
+}
+
+func newMalojaScrobbler(c MalojaConfig) *malojaScrobbler {
+	return &malojaScrobbler{config: c, client: newHTTPClient(15 * time.Second)}
+}
+
+func (s *malojaScrobbler) name() string { return "maloja" }
+
+// nowPlaying is a no-op: Maloja only records finished listens.
+func (s *malojaScrobbler) nowPlaying(l listen) error { return nil }
+
+// scrobble submits each listen in turn, since Maloja's API takes one per
+// request. Listens accepted before a failure are resubmitted with the rest
+// of the batch; Maloja ignores the duplicates.
+func (s *malojaScrobbler) scrobble(batch []listen) error {
+	for _, l := range batch {
+		if err := s.submit(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *malojaScrobbler) submit(l listen) error {
+	payload := map[string]any{
+		"artists": l.Artists,
+		"title":   l.Title,
+		"time":    l.StartedAt.Unix(),
+		"key":     s.config.APIKey,
+	}
+	if l.Album != "" {
+		payload["album"] = l.Album
+	}
+	if l.DurationMs > 0 {
+		payload["length"] = l.DurationMs / 1000
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(strings.TrimSuffix(s.config.URL, "/")+"/apis/mlj_1/newscrobble", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{api: "maloja API", status: resp.StatusCode}
+	}
+	return nil
+}
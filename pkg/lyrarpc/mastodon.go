@@ -0,0 +1,205 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"lyra-rpc/pkg/lyra"
+	"lyra-rpc/pkg/presence"
+	"lyra-rpc/pkg/uploader"
+)
+
+type MastodonPostMode string
+
+const (
+	// MastodonPerTrack posts every track that plays long enough.
+	MastodonPerTrack MastodonPostMode = "track"
+	// MastodonPerAlbum posts only the first track played from each album.
+	MastodonPerAlbum MastodonPostMode = "album"
+	// MastodonManual only posts when asked to through the control API.
+	MastodonManual MastodonPostMode = "manual"
+)
+
+type MastodonConfig struct {
+	Enabled     bool             `json:"enabled"`
+	InstanceURL string           `json:"instance_url"`
+	AccessToken string           `json:"access_token"`
+	Template    string           `json:"template"`
+	Visibility  string           `json:"visibility"`
+	Mode        MastodonPostMode `json:"mode"`
+	// MinPlayingSec is how long a track must play before it's posted.
+	MinPlayingSec int `json:"min_playing_sec"`
+	// AttachArtwork uploads the album cover with each post.
+	AttachArtwork bool `json:"attach_artwork"`
+}
+
+type mastodonSink struct {
+	config MastodonConfig
+	client *http.Client
+
+	timer       playTimer
+	posted      bool
+	lastAlbumID int64
+
+	mu      sync.Mutex
+	current *NowPlaying
+}
+
+func newMastodonSink(c MastodonConfig) *mastodonSink {
+	return &mastodonSink{config: c, client: newHTTPClient(30 * time.Second)}
+}
+
+func (s *mastodonSink) update(np *NowPlaying) {
+	s.mu.Lock()
+	s.current = np
+	s.mu.Unlock()
+
+	if s.timer.update(np) {
+		s.posted = false
+	}
+	if np == nil || s.posted || s.config.Mode == MastodonManual {
+		return
+	}
+	if s.timer.playedFor < time.Duration(s.config.MinPlayingSec)*time.Second {
+		return
+	}
+
+	s.posted = true
+	data := newTemplateData(np)
+	if s.config.Mode == MastodonPerAlbum {
+		if data.AlbumID != 0 && data.AlbumID == s.lastAlbumID {
+			return
+		}
+		s.lastAlbumID = data.AlbumID
+	}
+	go s.postAndLog(data)
+}
+
+// trigger posts the current track immediately, regardless of mode.
+func (s *mastodonSink) trigger() error {
+	s.mu.Lock()
+	np := s.current
+	s.mu.Unlock()
+	if np == nil {
+		return fmt.Errorf("nothing is playing")
+	}
+	go s.postAndLog(newTemplateData(np))
+	return nil
+}
+
+func (s *mastodonSink) postAndLog(data presence.Data) {
+	if err := s.post(data); err != nil {
+		log.Printf("Error posting to Mastodon: %v", err)
+	}
+}
+
+func (s *mastodonSink) post(data presence.Data) error {
+	status, err := presence.Render(s.config.Template, data)
+	if err != nil {
+		return err
+	}
+
+	form := url.Values{}
+	form.Set("status", status)
+	form.Set("visibility", s.config.Visibility)
+
+	if s.config.AttachArtwork && data.AlbumID != 0 {
+		mediaID, err := s.uploadArtwork(data)
+		if err != nil {
+			log.Printf("Error attaching artwork to Mastodon post: %v", err)
+		} else {
+			form.Add("media_ids[]", mediaID)
+		}
+	}
+
+	req, err := http.NewRequest("POST", s.endpoint("/api/v1/statuses"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{api: "mastodon statuses API", status: resp.StatusCode}
+	}
+	return nil
+}
+
+func (s *mastodonSink) endpoint(path string) string {
+	return strings.TrimSuffix(s.config.InstanceURL, "/") + path
+}
+
+func (s *mastodonSink) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Authorization", "Bearer "+s.config.AccessToken)
+	return s.client.Do(req)
+}
+
+// uploadArtwork uploads the album cover straight from Lyra and waits for the
+// instance to finish processing it, since posts can't reference media that
+// is still being processed.
+func (s *mastodonSink) uploadArtwork(data presence.Data) (string, error) {
+	image, err := fetchLyraImage(lyra.AlbumCoverPath(data.AlbumID))
+	if err != nil {
+		return "", err
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("description", fmt.Sprintf("Cover of %s by %s", data.Album, data.Artist))
+	part, err := writer.CreateFormFile("file", "cover."+uploader.DetectFormat(image).Ext)
+	if err != nil {
+		return "", err
+	}
+	part.Write(image)
+	writer.Close()
+
+	req, err := http.NewRequest("POST", s.endpoint("/api/v2/media"), &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := s.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// 202 means the upload was accepted but is still processing.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return "", &statusError{api: "mastodon media API", status: resp.StatusCode}
+	}
+	var media struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&media); err != nil {
+		return "", err
+	}
+
+	for i := 0; resp.StatusCode == http.StatusAccepted && i < 10; i++ {
+		time.Sleep(time.Second)
+		req, err := http.NewRequest("GET", s.endpoint("/api/v1/media/"+media.ID), nil)
+		if err != nil {
+			return "", err
+		}
+		if resp, err = s.do(req); err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+	}
+	return media.ID, nil
+}
@@ -0,0 +1,154 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"lyra-rpc/pkg/presence"
+)
+
+type MatrixConfig struct {
+	Enabled       bool   `json:"enabled"`
+	HomeserverURL string `json:"homeserver_url"`
+	AccessToken   string `json:"access_token"`
+	RoomID        string `json:"room_id"`
+	Template      string `json:"template"`
+	// Edit keeps editing a single message instead of posting one per
+	// track. EventID reuses an existing message.
+	Edit    bool   `json:"edit"`
+	EventID string `json:"event_id"`
+	// MinPlayingSec is how long a track must play before it's posted.
+	MinPlayingSec int `json:"min_playing_sec"`
+	// MinIntervalSec is the shortest time between two posts or edits.
+	MinIntervalSec int `json:"min_interval_sec"`
+}
+
+type matrixSink struct {
+	config MatrixConfig
+	client *http.Client
+
+	timer    playTimer
+	posted   bool
+	lastPost time.Time
+	pending  chan presence.Data
+
+	eventID string
+}
+
+func newMatrixSink(c MatrixConfig) *matrixSink {
+	s := &matrixSink{
+		config:  c,
+		client:  newHTTPClient(15 * time.Second),
+		pending: make(chan presence.Data, 1),
+		eventID: c.EventID,
+	}
+	go s.run()
+	return s
+}
+
+func (s *matrixSink) update(np *NowPlaying) {
+	if s.timer.update(np) {
+		s.posted = false
+	}
+	if np == nil || s.posted {
+		return
+	}
+	if s.timer.playedFor < time.Duration(s.config.MinPlayingSec)*time.Second {
+		return
+	}
+	if time.Since(s.lastPost) < time.Duration(s.config.MinIntervalSec)*time.Second {
+		return
+	}
+
+	s.posted = true
+	s.lastPost = time.Now()
+	select {
+	case <-s.pending:
+	default:
+	}
+	s.pending <- newTemplateData(np)
+}
+
+func (s *matrixSink) stop() {
+	close(s.pending)
+}
+
+func (s *matrixSink) run() {
+	for data := range s.pending {
+		if err := s.send(data); err != nil {
+			log.Printf("Error posting to Matrix: %v", err)
+		}
+	}
+}
+
+func (s *matrixSink) send(data presence.Data) error {
+	text, err := presence.Render(s.config.Template, data)
+	if err != nil {
+		return err
+	}
+
+	content := map[string]any{"msgtype": "m.text", "body": text}
+	if s.config.Edit && s.eventID != "" {
+		// Clients that don't understand edits show the fallback body.
+		content = map[string]any{
+			"msgtype":       "m.text",
+			"body":          "* " + text,
+			"m.new_content": map[string]any{"msgtype": "m.text", "body": text},
+			"m.relates_to":  map[string]any{"rel_type": "m.replace", "event_id": s.eventID},
+		}
+	}
+
+	eventID, err := s.sendEvent(content)
+	if err != nil {
+		return err
+	}
+	if s.config.Edit && s.eventID == "" {
+		s.eventID = eventID
+	}
+	return nil
+}
+
+func (s *matrixSink) sendEvent(content map[string]any) (string, error) {
+	body, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	// The transaction ID makes retries of the same request idempotent.
+	txnID := fmt.Sprintf("lyra-rpc-%d", time.Now().UnixNano())
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimSuffix(s.config.HomeserverURL, "/"), url.PathEscape(s.config.RoomID), txnID)
+
+	req, err := http.NewRequest("PUT", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.config.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &statusError{api: "matrix send API", status: resp.StatusCode}
+	}
+	var reply struct {
+		EventID string `json:"event_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return "", err
+	}
+	return reply.EventID, nil
+}
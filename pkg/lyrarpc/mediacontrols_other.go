@@ -0,0 +1,13 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !linux && !windows && !(darwin && cgo)
+
+package lyrarpc
+
+import "fmt"
+
+func startMediaControls() (sink, error) {
+	return nil, fmt.Errorf("media controls aren't supported on this platform")
+}
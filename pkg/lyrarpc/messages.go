@@ -0,0 +1,193 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// translations are the message catalogs, keyed by the English message.
+var translations = map[language.Tag]map[string]string{
+	language.German: {
+		"Error %s: %v":                                 "Fehler %s: %v",
+		"Still failing %s (x%d over %s): %v":           "Weiterhin Fehler %s (x%d in %s): %v",
+		"No more errors %s after %d failures over %s.": "Keine Fehler mehr %s nach %d Fehlschlägen in %s.",
+		"fetching playback":                            "beim Abrufen der Wiedergabe",
+		"setting activity":                             "beim Setzen der Aktivität",
+		"Error":                                        "Fehler",
+		"Uploading artwork…":                           "Cover wird hochgeladen…",
+		"Playing":                                      "Wiedergabe",
+		"Paused":                                       "Pausiert",
+		"Live":                                         "Live",
+		"Would show: %s":                               "Würde anzeigen: %s",
+		"Would clear the presence.":                    "Würde die Presence entfernen.",
+		"Observing: logging the presence instead of showing it in Discord. Press Ctrl+C to exit.": "Beobachtungsmodus: Die Presence wird protokolliert statt in Discord angezeigt. Zum Beenden Strg+C drücken.",
+		"Offline": "Offline",
+		"Leaving the presence up for %s before exiting.":            "Presence bleibt vor dem Beenden noch %s sichtbar.",
+		"Restored %s from the last run.":                            "%s vom letzten Lauf wiederhergestellt.",
+		"Rich presence is running. Press Ctrl+C to exit.":           "Rich Presence läuft. Zum Beenden Strg+C drücken.",
+		"Running without the Discord client. Press Ctrl+C to exit.": "Läuft ohne Discord-Client. Zum Beenden Strg+C drücken.",
+		"Shutting down.":                                          "Wird beendet.",
+		"Exiting without cleaning up.":                            "Wird sofort beendet, ohne aufzuräumen.",
+		"Playback source stopped, shutting down.":                 "Wiedergabequelle gestoppt, wird beendet.",
+		"No active playback, cleared presence.":                   "Keine aktive Wiedergabe, Presence entfernt.",
+		"Presence paused.":                                        "Presence pausiert.",
+		"Presence resumed.":                                       "Presence fortgesetzt.",
+		"Discord isn't running, pausing polling until it starts.": "Discord läuft nicht, Abfragen pausiert, bis es startet.",
+		"Discord is running again, resuming polling.":             "Discord läuft wieder, Abfragen werden fortgesetzt.",
+		"Can't reach Lyra yet, retrying in the background: %v":    "Lyra noch nicht erreichbar, wird im Hintergrund erneut versucht: %v",
+		"Lyra is reachable now.":                                  "Lyra ist jetzt erreichbar.",
+		"On battery power, polling every %s.":                     "Im Akkubetrieb, Abfrage alle %s.",
+		"On AC power, polling every %s.":                          "Am Netzteil, Abfrage alle %s.",
+		"Away from the computer, hiding the presence.":            "Nicht am Computer, Presence wird ausgeblendet.",
+		"Back at the computer, showing the presence again.":       "Zurück am Computer, Presence wird wieder angezeigt.",
+		"Away, presence hidden":                                   "Abwesend, Presence ausgeblendet",
+		"Error fetching track: %v":                                "Fehler beim Abrufen des Titels: %v",
+		"Error clearing activity: %v":                             "Fehler beim Entfernen der Aktivität: %v",
+		"Starting…":                                               "Wird gestartet…",
+		"Pause presence":                                          "Presence pausieren",
+		"Hide the Discord presence":                               "Die Discord-Presence ausblenden",
+		"Private session":                                         "Private Sitzung",
+		"Stop broadcasting and scrobbling":                        "Nichts mehr anzeigen oder scrobbeln",
+		"Open config":                                             "Konfiguration öffnen",
+		"Open config.json in an editor":                           "config.json in einem Editor öffnen",
+		"Quit":                                                    "Beenden",
+		"Can't reach Lyra":                                        "Lyra nicht erreichbar",
+		"Can't reach Discord":                                     "Discord nicht erreichbar",
+		"The presence hasn't updated for %s: %v":                  "Die Presence wurde seit %s nicht aktualisiert: %v",
+		"Working again.":                                          "Funktioniert wieder.",
+		"Nothing playing":                                         "Keine Wiedergabe",
+		"Paused: %s":                                              "Pausiert: %s",
+		"connected":                                               "verbunden",
+		"error: %s":                                               "Fehler: %s",
+		"Presence paused":                                         "Presence pausiert",
+		" until %s":                                               " bis %s",
+		"Recent log":                                              "Letzte Meldungen",
+		"p pause presence · s private session · q quit":           "p Presence pausieren · s private Sitzung · q beenden",
+	},
+	language.Spanish: {
+		"Error %s: %v":                                 "Error %s: %v",
+		"Still failing %s (x%d over %s): %v":           "Sigue fallando %s (x%d en %s): %v",
+		"No more errors %s after %d failures over %s.": "Sin errores %s tras %d fallos en %s.",
+		"fetching playback":                            "al obtener la reproducción",
+		"setting activity":                             "al establecer la actividad",
+		"Error":                                        "Error",
+		"Uploading artwork…":                           "Subiendo la portada…",
+		"Playing":                                      "Reproduciendo",
+		"Paused":                                       "En pausa",
+		"Live":                                         "En directo",
+		"Would show: %s":                               "Se mostraría: %s",
+		"Would clear the presence.":                    "Se borraría la presencia.",
+		"Observing: logging the presence instead of showing it in Discord. Press Ctrl+C to exit.": "Modo observador: la presencia se registra en lugar de mostrarse en Discord. Pulsa Ctrl+C para salir.",
+		"Offline": "Desconectado",
+		"Leaving the presence up for %s before exiting.":            "Se mantiene la presencia %s antes de salir.",
+		"Restored %s from the last run.":                            "Restaurado %s de la última ejecución.",
+		"Rich presence is running. Press Ctrl+C to exit.":           "Rich Presence en marcha. Pulsa Ctrl+C para salir.",
+		"Running without the Discord client. Press Ctrl+C to exit.": "En marcha sin el cliente de Discord. Pulsa Ctrl+C para salir.",
+		"Shutting down.":                                          "Cerrando.",
+		"Exiting without cleaning up.":                            "Saliendo sin limpiar.",
+		"Playback source stopped, shutting down.":                 "La fuente de reproducción se detuvo, cerrando.",
+		"No active playback, cleared presence.":                   "No hay reproducción activa, presencia borrada.",
+		"Presence paused.":                                        "Presencia en pausa.",
+		"Presence resumed.":                                       "Presencia reanudada.",
+		"Discord isn't running, pausing polling until it starts.": "Discord no está en marcha, se pausan las consultas hasta que se inicie.",
+		"Discord is running again, resuming polling.":             "Discord vuelve a estar en marcha, se reanudan las consultas.",
+		"Can't reach Lyra yet, retrying in the background: %v":    "Lyra aún no responde, se reintenta en segundo plano: %v",
+		"Lyra is reachable now.":                                  "Lyra ya responde.",
+		"On battery power, polling every %s.":                     "Con batería, consultando cada %s.",
+		"On AC power, polling every %s.":                          "Conectado a la corriente, consultando cada %s.",
+		"Away from the computer, hiding the presence.":            "Lejos del ordenador, se oculta la presencia.",
+		"Back at the computer, showing the presence again.":       "De vuelta en el ordenador, se vuelve a mostrar la presencia.",
+		"Away, presence hidden":                                   "Ausente, presencia oculta",
+		"Error fetching track: %v":                                "Error al obtener la pista: %v",
+		"Error clearing activity: %v":                             "Error al borrar la actividad: %v",
+		"Starting…":                                               "Iniciando…",
+		"Pause presence":                                          "Pausar presencia",
+		"Hide the Discord presence":                               "Ocultar la presencia de Discord",
+		"Private session":                                         "Sesión privada",
+		"Stop broadcasting and scrobbling":                        "Dejar de mostrar y de hacer scrobbling",
+		"Open config":                                             "Abrir configuración",
+		"Open config.json in an editor":                           "Abrir config.json en un editor",
+		"Quit":                                                    "Salir",
+		"Can't reach Lyra":                                        "No se puede conectar con Lyra",
+		"Can't reach Discord":                                     "No se puede conectar con Discord",
+		"The presence hasn't updated for %s: %v":                  "La presencia no se ha actualizado desde hace %s: %v",
+		"Working again.":                                          "Funciona de nuevo.",
+		"Nothing playing":                                         "No se está reproduciendo nada",
+		"Paused: %s":                                              "En pausa: %s",
+		"connected":                                               "conectado",
+		"error: %s":                                               "error: %s",
+		"Presence paused":                                         "Presencia en pausa",
+		" until %s":                                               " hasta las %s",
+		"Recent log":                                              "Registro reciente",
+		"p pause presence · s private session · q quit":           "p pausar presencia · s sesión privada · q salir",
+	},
+	language.French: {
+		"Error %s: %v":                                 "Erreur %s : %v",
+		"Still failing %s (x%d over %s): %v":           "Toujours en échec %s (x%d en %s) : %v",
+		"No more errors %s after %d failures over %s.": "Plus d'erreur %s après %d échecs en %s.",
+		"fetching playback":                            "lors de la récupération de la lecture",
+		"setting activity":                             "lors de la définition de l'activité",
+		"Error":                                        "Erreur",
+		"Uploading artwork…":                           "Envoi de la pochette…",
+		"Playing":                                      "Lecture",
+		"Paused":                                       "En pause",
+		"Live":                                         "En direct",
+		"Would show: %s":                               "Afficherait : %s",
+		"Would clear the presence.":                    "Effacerait la présence.",
+		"Observing: logging the presence instead of showing it in Discord. Press Ctrl+C to exit.": "Mode observateur : la présence est journalisée au lieu d'être affichée dans Discord. Appuyez sur Ctrl+C pour quitter.",
+		"Offline": "Hors ligne",
+		"Leaving the presence up for %s before exiting.":            "La présence reste affichée %s avant de quitter.",
+		"Restored %s from the last run.":                            "%s restauré depuis la dernière exécution.",
+		"Rich presence is running. Press Ctrl+C to exit.":           "La Rich Presence est active. Appuyez sur Ctrl+C pour quitter.",
+		"Running without the Discord client. Press Ctrl+C to exit.": "Fonctionne sans le client Discord. Appuyez sur Ctrl+C pour quitter.",
+		"Shutting down.":                                          "Arrêt en cours.",
+		"Exiting without cleaning up.":                            "Arrêt immédiat, sans nettoyage.",
+		"Playback source stopped, shutting down.":                 "La source de lecture s'est arrêtée, arrêt en cours.",
+		"No active playback, cleared presence.":                   "Aucune lecture en cours, présence effacée.",
+		"Presence paused.":                                        "Présence en pause.",
+		"Presence resumed.":                                       "Présence reprise.",
+		"Discord isn't running, pausing polling until it starts.": "Discord n'est pas lancé, interrogation suspendue jusqu'à son démarrage.",
+		"Discord is running again, resuming polling.":             "Discord est de nouveau lancé, reprise de l'interrogation.",
+		"Can't reach Lyra yet, retrying in the background: %v":    "Lyra n'est pas encore joignable, nouvelle tentative en arrière-plan : %v",
+		"Lyra is reachable now.":                                  "Lyra est maintenant joignable.",
+		"On battery power, polling every %s.":                     "Sur batterie, interrogation toutes les %s.",
+		"On AC power, polling every %s.":                          "Sur secteur, interrogation toutes les %s.",
+		"Away from the computer, hiding the presence.":            "Absent de l'ordinateur, la présence est masquée.",
+		"Back at the computer, showing the presence again.":       "De retour à l'ordinateur, la présence est de nouveau affichée.",
+		"Away, presence hidden":                                   "Absent, présence masquée",
+		"Error fetching track: %v":                                "Erreur lors de la récupération du titre : %v",
+		"Error clearing activity: %v":                             "Erreur lors de l'effacement de l'activité : %v",
+		"Starting…":                                               "Démarrage…",
+		"Pause presence":                                          "Mettre la présence en pause",
+		"Hide the Discord presence":                               "Masquer la présence Discord",
+		"Private session":                                         "Session privée",
+		"Stop broadcasting and scrobbling":                        "Ne plus rien afficher ni scrobbler",
+		"Open config":                                             "Ouvrir la configuration",
+		"Open config.json in an editor":                           "Ouvrir config.json dans un éditeur",
+		"Quit":                                                    "Quitter",
+		"Can't reach Lyra":                                        "Lyra injoignable",
+		"Can't reach Discord":                                     "Discord injoignable",
+		"The presence hasn't updated for %s: %v":                  "La présence n'a pas été mise à jour depuis %s : %v",
+		"Working again.":                                          "Fonctionne à nouveau.",
+		"Nothing playing":                                         "Aucune lecture",
+		"Paused: %s":                                              "En pause : %s",
+		"connected":                                               "connecté",
+		"error: %s":                                               "erreur : %s",
+		"Presence paused":                                         "Présence en pause",
+		" until %s":                                               " jusqu'à %s",
+		"Recent log":                                              "Journal récent",
+		"p pause presence · s private session · q quit":           "p pause de la présence · s session privée · q quitter",
+	},
+}
+
+func init() {
+	for tag, messages := range translations {
+		for key, msg := range messages {
+			message.SetString(tag, key, msg)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// uploadStats accumulates what happened when uploading to one backend.
+type uploadStats struct {
+	Uploads  int64
+	Failures int64
+	Bytes    int64
+	Latency  time.Duration
+	// LastErr is the error from the latest upload, or nil if it worked.
+	LastErr error
+}
+
+var (
+	metricsMu    sync.Mutex
+	uploadTotals = map[ImageUploader]*uploadStats{}
+)
+
+// recordUpload notes the outcome of one upload (including its retries) to
+// backend.
+func recordUpload(backend ImageUploader, size int, elapsed time.Duration, err error) {
+	metricsMu.Lock()
+	stats, ok := uploadTotals[backend]
+	if !ok {
+		stats = &uploadStats{}
+		uploadTotals[backend] = stats
+	}
+	stats.Latency += elapsed
+	stats.LastErr = err
+	if err != nil {
+		stats.Failures++
+	} else {
+		stats.Uploads++
+		stats.Bytes += int64(size)
+	}
+	snapshot := *stats
+	metricsMu.Unlock()
+
+	if err != nil {
+		debugf("Upload of %d bytes to %s failed after %s", size, backend, elapsed.Round(time.Millisecond))
+	} else {
+		debugf("Uploaded %d bytes to %s in %s", size, backend, elapsed.Round(time.Millisecond))
+	}
+	debugf("%s totals: %d uploads, %d failures, %d bytes, %s average latency",
+		backend, snapshot.Uploads, snapshot.Failures, snapshot.Bytes, snapshot.averageLatency())
+}
+
+// uploadHealth returns the error from the latest upload to each backend
+// whose latest upload failed.
+func uploadHealth() map[ImageUploader]error {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	failing := map[ImageUploader]error{}
+	for backend, stats := range uploadTotals {
+		if stats.LastErr != nil {
+			failing[backend] = stats.LastErr
+		}
+	}
+	return failing
+}
+
+func (s uploadStats) averageLatency() time.Duration {
+	attempts := s.Uploads + s.Failures
+	if attempts == 0 {
+		return 0
+	}
+	return (s.Latency / time.Duration(attempts)).Round(time.Millisecond)
+}
+
+// writeMetrics writes all counters in the Prometheus text format.
+func writeMetrics(w http.ResponseWriter, r *http.Request) {
+	metricsMu.Lock()
+	backends := make([]ImageUploader, 0, len(uploadTotals))
+	for backend := range uploadTotals {
+		backends = append(backends, backend)
+	}
+	sort.Slice(backends, func(i, j int) bool { return backends[i] < backends[j] })
+	stats := make([]uploadStats, len(backends))
+	for i, backend := range backends {
+		stats[i] = *uploadTotals[backend]
+	}
+	metricsMu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	metrics := []struct {
+		name, help, kind string
+		value            func(uploadStats) string
+	}{
+		{"lyra_rpc_uploads_total", "Successful image uploads.", "counter",
+			func(s uploadStats) string { return fmt.Sprint(s.Uploads) }},
+		{"lyra_rpc_upload_failures_total", "Image uploads that failed after all retries.", "counter",
+			func(s uploadStats) string { return fmt.Sprint(s.Failures) }},
+		{"lyra_rpc_upload_bytes_total", "Bytes successfully uploaded.", "counter",
+			func(s uploadStats) string { return fmt.Sprint(s.Bytes) }},
+		{"lyra_rpc_upload_seconds_total", "Time spent uploading, including retries.", "counter",
+			func(s uploadStats) string { return fmt.Sprint(s.Latency.Seconds()) }},
+	}
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for i, backend := range backends {
+			fmt.Fprintf(w, "%s{backend=%q} %s\n", m.name, backend, m.value(stats[i]))
+		}
+	}
+}
+
+// startMetricsServer serves /metrics on addr in the background.
+func startMetricsServer(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", writeMetrics)
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	serve(server, ln, "Metrics server")
+	log.Printf("Serving metrics on %s/metrics", addr)
+	return server, nil
+}
+
+// debugf logs only when log_level is "debug".
+func debugf(format string, args ...any) {
+	if config.LogLevel == "debug" {
+		log.Printf(format, args...)
+	}
+}
@@ -0,0 +1,261 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build linux
+
+package lyrarpc
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"lyra-rpc/pkg/lyra"
+	"lyra-rpc/pkg/presence"
+	"lyra-rpc/pkg/uploader"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+const (
+	mprisPath        = "/org/mpris/MediaPlayer2"
+	mprisRootIface   = "org.mpris.MediaPlayer2"
+	mprisPlayerIface = "org.mpris.MediaPlayer2.Player"
+)
+
+// mprisSink mirrors Lyra playback as an MPRIS media player on the session
+// bus, and forwards the transport controls back to Lyra.
+type mprisSink struct {
+	conn  *dbus.Conn
+	props *prop.Properties
+
+	mu         sync.Mutex
+	playbackID int64
+	// data is what was last shown, and localArt the local copy of its
+	// album's cover, if one's been saved.
+	data     presence.Data
+	localArt string
+}
+
+func startMediaControls() (sink, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &mprisSink{conn: conn}
+	if err := conn.Export(mprisRoot{}, mprisPath, mprisRootIface); err != nil {
+		return nil, err
+	}
+	// Seek is renamed on the Go side so it isn't mistaken for io.Seeker.
+	if err := conn.ExportWithMap(mprisPlayer{s}, map[string]string{"SeekBy": "Seek"}, mprisPath, mprisPlayerIface); err != nil {
+		return nil, err
+	}
+
+	readOnly := func(v any) *prop.Prop { return &prop.Prop{Value: v, Emit: prop.EmitTrue} }
+	s.props, err = prop.Export(conn, mprisPath, prop.Map{
+		mprisRootIface: {
+			"CanQuit":             readOnly(false),
+			"CanRaise":            readOnly(false),
+			"HasTrackList":        readOnly(false),
+			"Identity":            readOnly("Lyra"),
+			"SupportedUriSchemes": readOnly([]string{}),
+			"SupportedMimeTypes":  readOnly([]string{}),
+		},
+		mprisPlayerIface: {
+			"PlaybackStatus": readOnly("Stopped"),
+			"Metadata":       readOnly(map[string]dbus.Variant{}),
+			"Position":       {Value: int64(0), Emit: prop.EmitFalse},
+			"Rate":           readOnly(1.0),
+			"MinimumRate":    readOnly(1.0),
+			"MaximumRate":    readOnly(1.0),
+			"Volume":         readOnly(1.0),
+			"CanGoNext":      readOnly(true),
+			"CanGoPrevious":  readOnly(true),
+			"CanPlay":        readOnly(true),
+			"CanPause":       readOnly(true),
+			"CanSeek":        readOnly(false),
+			"CanControl":     readOnly(true),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	playerMethods := introspect.Methods(mprisPlayer{})
+	for i := range playerMethods {
+		if playerMethods[i].Name == "SeekBy" {
+			playerMethods[i].Name = "Seek"
+		}
+	}
+	node := &introspect.Node{
+		Name: mprisPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{Name: mprisRootIface, Methods: introspect.Methods(mprisRoot{}), Properties: s.props.Introspection(mprisRootIface)},
+			{Name: mprisPlayerIface, Methods: playerMethods, Properties: s.props.Introspection(mprisPlayerIface)},
+		},
+	}
+	if err := conn.Export(introspect.NewIntrospectable(node), mprisPath, "org.freedesktop.DBus.Introspectable"); err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.RequestName("org.mpris.MediaPlayer2.lyra", dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return nil, err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return nil, fmt.Errorf("org.mpris.MediaPlayer2.lyra is already taken")
+	}
+
+	log.Println("Registered MPRIS player org.mpris.MediaPlayer2.lyra")
+	return s, nil
+}
+
+func (s *mprisSink) update(np *NowPlaying) {
+	if np == nil {
+		s.mu.Lock()
+		s.playbackID, s.data, s.localArt = 0, presence.Data{}, ""
+		s.mu.Unlock()
+		s.props.SetMust(mprisPlayerIface, "PlaybackStatus", "Stopped")
+		s.props.SetMust(mprisPlayerIface, "Metadata", map[string]dbus.Variant{})
+		return
+	}
+
+	data := newTemplateData(np)
+	s.mu.Lock()
+	s.playbackID = np.Playback.PlaybackID
+	albumChanged := data.AlbumID != s.data.AlbumID
+	if albumChanged {
+		s.localArt = ""
+	}
+	s.data = data
+	artURL := data.ImageURL
+	if artURL == "" && s.localArt != "" {
+		artURL = "file://" + s.localArt
+	}
+	s.setMetadata(mprisMetadata(data, artURL))
+	s.mu.Unlock()
+
+	status := "Paused"
+	if data.State == "playing" {
+		status = "Playing"
+	}
+	s.props.SetMust(mprisPlayerIface, "Position", data.PositionMs*1000)
+	if s.props.GetMust(mprisPlayerIface, "PlaybackStatus") != status {
+		s.props.SetMust(mprisPlayerIface, "PlaybackStatus", status)
+	}
+
+	// Without a public URL, hand desktop widgets a local copy of the cover.
+	if data.ImageURL == "" && data.AlbumID != 0 && albumChanged {
+		go s.loadLocalArt(data.AlbumID)
+	}
+}
+
+// setMetadata replaces the metadata if it shows another track or cover
+// than it does now. Callers hold s.mu, so a cover saved in the background
+// can't overwrite a newer track.
+func (s *mprisSink) setMetadata(metadata map[string]dbus.Variant) {
+	current, _ := s.props.GetMust(mprisPlayerIface, "Metadata").(map[string]dbus.Variant)
+	if current["mpris:trackid"] != metadata["mpris:trackid"] || current["mpris:artUrl"] != metadata["mpris:artUrl"] {
+		s.props.SetMust(mprisPlayerIface, "Metadata", metadata)
+	}
+}
+
+func mprisMetadata(data presence.Data, artURL string) map[string]dbus.Variant {
+	metadata := map[string]dbus.Variant{
+		"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath(fmt.Sprintf("/org/lyra/track/%d", data.TrackID))),
+		"xesam:title":   dbus.MakeVariant(data.Title),
+		"xesam:artist":  dbus.MakeVariant(data.Artists),
+		"xesam:album":   dbus.MakeVariant(data.Album),
+	}
+	if data.DurationMs > 0 {
+		metadata["mpris:length"] = dbus.MakeVariant(data.DurationMs * 1000)
+	}
+	if artURL != "" {
+		metadata["mpris:artUrl"] = dbus.MakeVariant(artURL)
+	}
+	return metadata
+}
+
+// loadLocalArt saves a copy of the album's cover, for as long as the album
+// is playing without one online.
+func (s *mprisSink) loadLocalArt(albumID int64) {
+	image, err := fetchLyraImage(lyra.AlbumCoverPath(albumID))
+	if err != nil {
+		return
+	}
+	dir, err := artworkCacheDir()
+	if err != nil {
+		return
+	}
+	path := filepath.Join(dir, "mpris-cover."+uploader.DetectFormat(image).Ext)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return
+	}
+	if err := writeFileAtomic(path, image); err != nil {
+		log.Printf("Error saving MPRIS artwork: %v", err)
+		return
+	}
+
+	// The track may have changed during the download, so the metadata is
+	// built from whatever is showing now.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.AlbumID != albumID {
+		return
+	}
+	s.localArt = path
+	if s.data.ImageURL == "" {
+		s.setMetadata(mprisMetadata(s.data, "file://"+path))
+	}
+}
+
+// command forwards a transport control to Lyra.
+func (s *mprisSink) command(name string) *dbus.Error {
+	s.mu.Lock()
+	playbackID := s.playbackID
+	s.mu.Unlock()
+	if playbackID == 0 {
+		return nil
+	}
+	if err := lyraClient.Load().SendCommand(playbackID, name); err != nil {
+		log.Printf("Error sending %s to Lyra: %v", name, err)
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// mprisRoot implements org.mpris.MediaPlayer2. There's no window to raise
+// and quitting the daemon from a media widget would be surprising, so both
+// are no-ops advertised as unsupported.
+type mprisRoot struct{}
+
+func (mprisRoot) Raise() *dbus.Error { return nil }
+func (mprisRoot) Quit() *dbus.Error  { return nil }
+
+// mprisPlayer implements org.mpris.MediaPlayer2.Player.
+type mprisPlayer struct{ s *mprisSink }
+
+func (p mprisPlayer) Next() *dbus.Error     { return p.s.command("next") }
+func (p mprisPlayer) Previous() *dbus.Error { return p.s.command("previous") }
+func (p mprisPlayer) Pause() *dbus.Error    { return p.s.command("pause") }
+func (p mprisPlayer) Play() *dbus.Error     { return p.s.command("play") }
+func (p mprisPlayer) Stop() *dbus.Error     { return p.s.command("stop") }
+
+func (p mprisPlayer) PlayPause() *dbus.Error {
+	if p.s.props.GetMust(mprisPlayerIface, "PlaybackStatus") == "Playing" {
+		return p.Pause()
+	}
+	return p.Play()
+}
+
+func (p mprisPlayer) SeekBy(offset int64) *dbus.Error                          { return nil }
+func (p mprisPlayer) SetPosition(track dbus.ObjectPath, pos int64) *dbus.Error { return nil }
+func (p mprisPlayer) OpenUri(uri string) *dbus.Error                           { return nil }
@@ -0,0 +1,176 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type MQTTConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Broker   string `json:"broker"`
+	ClientID string `json:"client_id"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// TopicPrefix is prepended to every topic, e.g. "lyra-rpc/state".
+	TopicPrefix   string              `json:"topic_prefix"`
+	Retain        bool                `json:"retain"`
+	HomeAssistant HomeAssistantConfig `json:"home_assistant"`
+}
+
+// HomeAssistantConfig publishes MQTT discovery configs so Home Assistant
+// picks up lyra-rpc's sensors without any manual YAML.
+type HomeAssistantConfig struct {
+	Enabled         bool   `json:"enabled"`
+	DiscoveryPrefix string `json:"discovery_prefix"`
+	// NodeID distinguishes several lyra-rpc instances on one broker.
+	NodeID string `json:"node_id"`
+}
+
+// mqttTrack is the payload published to the track topic.
+type mqttTrack struct {
+	State      string   `json:"state"`
+	TrackID    int64    `json:"track_id,omitempty"`
+	Title      string   `json:"title,omitempty"`
+	Artist     string   `json:"artist,omitempty"`
+	Artists    []string `json:"artists,omitempty"`
+	AlbumID    int64    `json:"album_id,omitempty"`
+	Album      string   `json:"album,omitempty"`
+	Year       int      `json:"year,omitempty"`
+	ArtworkURL string   `json:"artwork_url,omitempty"`
+	DurationMs int64    `json:"duration_ms,omitempty"`
+	PositionMs int64    `json:"position_ms"`
+}
+
+type mqttSink struct {
+	config MQTTConfig
+	client mqtt.Client
+
+	lastState string
+	lastTrack int64
+}
+
+func newMQTTSink(c MQTTConfig) *mqttSink {
+	s := &mqttSink{config: c}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(c.Broker).
+		SetClientID(c.ClientID).
+		SetUsername(c.Username).
+		SetPassword(c.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(time.Minute).
+		// The broker announces "offline" if lyra-rpc disappears without
+		// saying goodbye.
+		SetWill(s.topic("availability"), "offline", 1, true).
+		SetOnConnectHandler(func(client mqtt.Client) {
+			client.Publish(s.topic("availability"), 1, true, "online")
+			if c.HomeAssistant.Enabled {
+				s.publishDiscovery()
+			}
+		})
+	s.client = mqtt.NewClient(opts)
+	return s
+}
+
+func (s *mqttSink) topic(name string) string {
+	return strings.TrimSuffix(s.config.TopicPrefix, "/") + "/" + name
+}
+
+func (s *mqttSink) start() {
+	// With connect retry enabled this returns immediately and keeps trying
+	// in the background; messages published meanwhile are queued.
+	s.client.Connect()
+	log.Printf("Publishing to MQTT broker %s", s.config.Broker)
+}
+
+// stop marks lyra-rpc offline and disconnects cleanly.
+func (s *mqttSink) stop() {
+	s.client.Publish(s.topic("availability"), 1, true, "offline").WaitTimeout(time.Second)
+	s.client.Disconnect(250)
+}
+
+// update publishes when the state or track changes; the position alone
+// changing isn't worth a message.
+func (s *mqttSink) update(np *NowPlaying) {
+	payload := mqttTrack{State: "stopped"}
+	if np != nil {
+		data := newTemplateData(np)
+		payload = mqttTrack{
+			State:      data.State,
+			TrackID:    data.TrackID,
+			Title:      data.Title,
+			Artist:     data.Artist,
+			Artists:    data.Artists,
+			AlbumID:    data.AlbumID,
+			Album:      data.Album,
+			Year:       data.Year,
+			ArtworkURL: data.ImageURL,
+			DurationMs: data.DurationMs,
+			PositionMs: data.PositionMs,
+		}
+	}
+	if payload.State == s.lastState && payload.TrackID == s.lastTrack {
+		return
+	}
+	s.lastState = payload.State
+	s.lastTrack = payload.TrackID
+
+	track, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	s.client.Publish(s.topic("state"), 1, s.config.Retain, payload.State)
+	s.client.Publish(s.topic("track"), 1, s.config.Retain, track)
+}
+
+// publishDiscovery announces a "now playing" sensor carrying the track
+// metadata as attributes, and a playback state sensor. Both are retained so
+// Home Assistant finds them again after it restarts.
+func (s *mqttSink) publishDiscovery() {
+	ha := s.config.HomeAssistant
+	device := map[string]any{
+		"identifiers": []string{ha.NodeID},
+		"name":        "Lyra",
+		"model":       "lyra-rpc",
+	}
+
+	sensors := []struct {
+		id     string
+		config map[string]any
+	}{
+		{"now_playing", map[string]any{
+			"name":                  "Lyra Now Playing",
+			"icon":                  "mdi:music",
+			"state_topic":           s.topic("track"),
+			"value_template":        "{{ value_json.title if value_json.state != 'stopped' else 'Nothing' }}",
+			"json_attributes_topic": s.topic("track"),
+		}},
+		{"playback_state", map[string]any{
+			"name":        "Lyra Playback State",
+			"icon":        "mdi:play-pause",
+			"state_topic": s.topic("state"),
+		}},
+	}
+
+	for _, sensor := range sensors {
+		sensor.config["unique_id"] = ha.NodeID + "_" + sensor.id
+		sensor.config["availability_topic"] = s.topic("availability")
+		sensor.config["device"] = device
+
+		payload, err := json.Marshal(sensor.config)
+		if err != nil {
+			continue
+		}
+		topic := strings.Join([]string{strings.TrimSuffix(ha.DiscoveryPrefix, "/"), "sensor", ha.NodeID, sensor.id, "config"}, "/")
+		s.client.Publish(topic, 1, true, payload)
+	}
+}
@@ -0,0 +1,120 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// netCheckInterval is how often the network interfaces are looked at.
+const netCheckInterval = 5 * time.Second
+
+// networkWatcher notices the network changing under lyra-rpc, as on sleep
+// and wake, roaming between Wi-Fi networks, or a VPN coming up or going
+// down, so connections can be remade right away rather than once they time
+// out.
+type networkWatcher struct {
+	mu          sync.Mutex
+	subscribers []func()
+}
+
+var network networkWatcher
+
+// subscribe calls fn whenever the network changes. fn must not block.
+func (w *networkWatcher) subscribe(fn func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// reset drops every subscriber.
+func (w *networkWatcher) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = nil
+}
+
+// watch checks for changes until ctx is done. A check that comes much
+// later than it should counts as a change too, since the machine was most
+// likely asleep in between.
+func (w *networkWatcher) watch(ctx context.Context, httpClient *http.Client) {
+	interval := backgroundInterval(netCheckInterval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := networkFingerprint()
+	lastCheck := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		now := time.Now()
+		// The wall clock keeps counting during sleep, unlike the
+		// monotonic one.
+		slept := now.Round(0).Sub(lastCheck.Round(0)) > 3*interval
+		lastCheck = now
+		fingerprint := networkFingerprint()
+		if fingerprint == last && !slept {
+			continue
+		}
+		last = fingerprint
+		if slept {
+			debugf("Woke from sleep, reconnecting")
+		} else {
+			debugf("Network changed, reconnecting")
+		}
+		w.changed(httpClient)
+	}
+}
+
+// changed drops idle connections, so the next request resolves Lyra's
+// address again and dials it afresh, polls right away, and tells every
+// subscriber.
+func (w *networkWatcher) changed(httpClient *http.Client) {
+	transport.Load().CloseIdleConnections()
+	if httpClient != nil {
+		httpClient.CloseIdleConnections()
+	}
+	presenceState.poke()
+
+	w.mu.Lock()
+	subscribers := w.subscribers
+	w.mu.Unlock()
+	for _, fn := range subscribers {
+		fn()
+	}
+}
+
+// networkFingerprint describes the interfaces that are up and their
+// addresses, to tell when any of them change.
+func networkFingerprint() string {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		debugf("Error listing network interfaces: %v", err)
+		return ""
+	}
+	var parts []string
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			parts = append(parts, iface.Name+"="+addr.String())
+		}
+	}
+	slices.Sort(parts)
+	return strings.Join(parts, ",")
+}
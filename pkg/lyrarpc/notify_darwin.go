@@ -0,0 +1,27 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// Notifications shown through AppleScript belong to Script Editor, and
+// can't be taken back.
+const canWithdrawNotifications = false
+
+func showNotification(tag, title, body string) error {
+	script := fmt.Sprintf("display notification %s with title %s", strconv.Quote(body), strconv.Quote(title))
+	if out, err := exec.Command("osascript", "-e", script).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, out)
+	}
+	return nil
+}
+
+func withdrawNotification(tag string) error {
+	return nil
+}
@@ -0,0 +1,66 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build linux
+
+package lyrarpc
+
+import (
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	notificationsDest = "org.freedesktop.Notifications"
+	notificationsPath = "/org/freedesktop/Notifications"
+)
+
+const canWithdrawNotifications = true
+
+// notificationIDs maps the tags notifications were shown with to the IDs
+// the notification server gave them.
+var notificationIDs = struct {
+	sync.Mutex
+	ids map[string]uint32
+}{ids: map[string]uint32{}}
+
+// showNotification shows a desktop notification through the freedesktop
+// notification service, replacing any already shown with the same tag.
+func showNotification(tag, title, body string) error {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+	notificationIDs.Lock()
+	defer notificationIDs.Unlock()
+
+	var id uint32
+	// Urgency 1 is normal, and an expiry of 0 keeps it up until it's
+	// dismissed or withdrawn.
+	hints := map[string]dbus.Variant{"urgency": dbus.MakeVariant(byte(1))}
+	call := conn.Object(notificationsDest, notificationsPath).Call(notificationsDest+".Notify", 0,
+		"lyra-rpc", notificationIDs.ids[tag], "dialog-warning", title, body, []string{}, hints, int32(0))
+	if err := call.Store(&id); err != nil {
+		return err
+	}
+	notificationIDs.ids[tag] = id
+	return nil
+}
+
+// withdrawNotification closes the notification shown with tag, if any.
+func withdrawNotification(tag string) error {
+	notificationIDs.Lock()
+	defer notificationIDs.Unlock()
+	id, ok := notificationIDs.ids[tag]
+	if !ok {
+		return nil
+	}
+	delete(notificationIDs.ids, tag)
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+	return conn.Object(notificationsDest, notificationsPath).Call(notificationsDest+".CloseNotification", 0, id).Err
+}
@@ -0,0 +1,19 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !linux && !darwin && !windows
+
+package lyrarpc
+
+import "fmt"
+
+const canWithdrawNotifications = false
+
+func showNotification(tag, title, body string) error {
+	return fmt.Errorf("desktop notifications aren't supported on this platform")
+}
+
+func withdrawNotification(tag string) error {
+	return nil
+}
@@ -0,0 +1,58 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+const canWithdrawNotifications = true
+
+// notificationAppID is the app toasts are shown as. lyra-rpc isn't
+// registered with the Start menu, so they borrow PowerShell's.
+const notificationAppID = `{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe`
+
+// showNotification shows a toast, replacing any already shown with the same
+// tag. Toasts are a WinRT API, which PowerShell can reach without cgo.
+func showNotification(tag, title, body string) error {
+	script := fmt.Sprintf(`[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+[Windows.Data.Xml.Dom.XmlDocument, Windows.Data.Xml.Dom.XmlDocument, ContentType = WindowsRuntime] | Out-Null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode(%s)) | Out-Null
+$text.Item(1).AppendChild($xml.CreateTextNode(%s)) | Out-Null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($xml)
+$toast.Tag = %s
+$toast.Group = 'lyra-rpc'
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier(%s).Show($toast)`,
+		powershellQuote(title), powershellQuote(body), powershellQuote(toastTag(tag)), powershellQuote(notificationAppID))
+	return runNotificationScript(script)
+}
+
+// withdrawNotification removes the toast shown with tag from the Action
+// Center, if it's still there.
+func withdrawNotification(tag string) error {
+	script := fmt.Sprintf(`[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+[Windows.UI.Notifications.ToastNotificationManager]::History.Remove(%s, 'lyra-rpc', %s)`,
+		powershellQuote(toastTag(tag)), powershellQuote(notificationAppID))
+	return runNotificationScript(script)
+}
+
+// toastTag shortens tag to the 64 characters a toast's tag is limited to.
+func toastTag(tag string) string {
+	if len(tag) > 64 {
+		return tag[:64]
+	}
+	return tag
+}
+
+func runNotificationScript(script string) error {
+	out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, out)
+	}
+	return nil
+}
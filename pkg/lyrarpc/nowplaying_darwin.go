@@ -0,0 +1,203 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build darwin && cgo
+
+package lyrarpc
+
+/*
+#cgo CFLAGS: -x objective-c -fobjc-arc
+#cgo LDFLAGS: -framework Foundation -framework AppKit -framework MediaPlayer
+#include <stdlib.h>
+#import <AppKit/AppKit.h>
+#import <MediaPlayer/MediaPlayer.h>
+
+extern void goRemoteCommand(int command);
+
+static void registerRemoteCommands(void) {
+	MPRemoteCommandCenter *center = [MPRemoteCommandCenter sharedCommandCenter];
+	NSArray *commands = @[
+		center.playCommand, center.pauseCommand, center.togglePlayPauseCommand,
+		center.stopCommand, center.nextTrackCommand, center.previousTrackCommand,
+	];
+	for (NSUInteger i = 0; i < commands.count; i++) {
+		int command = (int)i;
+		MPRemoteCommand *remote = commands[i];
+		remote.enabled = YES;
+		[remote addTargetWithHandler:^MPRemoteCommandHandlerStatus(MPRemoteCommandEvent *event) {
+			goRemoteCommand(command);
+			return MPRemoteCommandHandlerStatusSuccess;
+		}];
+	}
+}
+
+static void setNowPlaying(const char *title, const char *artist, const char *album,
+		double duration, double elapsed, int playing, const void *art, int artLen) {
+	NSMutableDictionary *info = [NSMutableDictionary dictionary];
+	info[MPMediaItemPropertyTitle] = [NSString stringWithUTF8String:title];
+	info[MPMediaItemPropertyArtist] = [NSString stringWithUTF8String:artist];
+	info[MPMediaItemPropertyAlbumTitle] = [NSString stringWithUTF8String:album];
+	info[MPMediaItemPropertyPlaybackDuration] = @(duration);
+	info[MPNowPlayingInfoPropertyElapsedPlaybackTime] = @(elapsed);
+	info[MPNowPlayingInfoPropertyPlaybackRate] = @(playing ? 1.0 : 0.0);
+	if (art != NULL && artLen > 0) {
+		NSImage *image = [[NSImage alloc] initWithData:[NSData dataWithBytes:art length:artLen]];
+		if (image != nil) {
+			info[MPMediaItemPropertyArtwork] = [[MPMediaItemArtwork alloc]
+				initWithBoundsSize:image.size
+				requestHandler:^NSImage *(CGSize size) { return image; }];
+		}
+	}
+
+	MPNowPlayingInfoCenter *center = [MPNowPlayingInfoCenter defaultCenter];
+	center.nowPlayingInfo = info;
+	center.playbackState = playing ? MPNowPlayingPlaybackStatePlaying : MPNowPlayingPlaybackStatePaused;
+}
+
+static void clearNowPlaying(void) {
+	MPNowPlayingInfoCenter *center = [MPNowPlayingInfoCenter defaultCenter];
+	center.nowPlayingInfo = nil;
+	center.playbackState = MPNowPlayingPlaybackStateStopped;
+}
+
+// Remote commands are delivered on the main queue, which nothing else in
+// this process services, so drain whatever is pending without blocking.
+static void pumpMainRunLoop(void) {
+	while (CFRunLoopRunInMode(kCFRunLoopDefaultMode, 0, true) == kCFRunLoopRunHandledSource) {
+	}
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// The main goroutine stays on the main thread so update can pump the main
+// run loop, which is where MediaPlayer delivers remote commands.
+func init() {
+	runtime.LockOSThread()
+}
+
+// Indexes into the command list built by registerRemoteCommands.
+var remoteCommands = []string{"play", "pause", "toggle", "stop", "next", "previous"}
+
+// nowPlayingCenter is the sink registered with MediaPlayer; there is only
+// ever one per process.
+var nowPlayingCenter *nowPlayingSink
+
+type nowPlayingSink struct {
+	mu         sync.Mutex
+	playbackID int64
+	playing    bool
+
+	albumID int64
+	art     []byte
+}
+
+func startMediaControls() (sink, error) {
+	nowPlayingCenter = &nowPlayingSink{}
+	C.registerRemoteCommands()
+	log.Println("Publishing playback to the macOS Now Playing widget")
+	return nowPlayingCenter, nil
+}
+
+// threadBound keeps updates on the polling goroutine, which owns the main
+// thread whose run loop delivers remote commands.
+func (s *nowPlayingSink) threadBound() {}
+
+func (s *nowPlayingSink) update(np *NowPlaying) {
+	defer C.pumpMainRunLoop()
+
+	if np == nil {
+		s.mu.Lock()
+		s.playbackID, s.playing = 0, false
+		s.mu.Unlock()
+		C.clearNowPlaying()
+		return
+	}
+
+	data := newTemplateData(np)
+	playing := data.State == "playing"
+	s.mu.Lock()
+	s.playbackID = np.Playback.PlaybackID
+	s.playing = playing
+	if data.AlbumID != s.albumID {
+		s.albumID = data.AlbumID
+		s.art = nil
+		if data.AlbumID != 0 {
+			go s.loadArt(data.AlbumID)
+		}
+	}
+	art := s.art
+	s.mu.Unlock()
+
+	title := C.CString(data.Title)
+	artist := C.CString(data.Artist)
+	album := C.CString(data.Album)
+	defer C.free(unsafe.Pointer(title))
+	defer C.free(unsafe.Pointer(artist))
+	defer C.free(unsafe.Pointer(album))
+
+	var artPtr unsafe.Pointer
+	if len(art) > 0 {
+		artPtr = C.CBytes(art)
+		defer C.free(artPtr)
+	}
+	C.setNowPlaying(title, artist, album,
+		C.double(float64(data.DurationMs)/1000), C.double(float64(data.PositionMs)/1000),
+		C.int(boolToInt(playing)), artPtr, C.int(len(art)))
+}
+
+// loadArt fetches the cover from Lyra; it shows up on the next poll.
+func (s *nowPlayingSink) loadArt(albumID int64) {
+	image, err := fetchLyraImage(lyra.AlbumCoverPath(albumID))
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	if s.albumID == albumID {
+		s.art = image
+	}
+	s.mu.Unlock()
+}
+
+//export goRemoteCommand
+func goRemoteCommand(index C.int) {
+	s := nowPlayingCenter
+	if s == nil || int(index) >= len(remoteCommands) {
+		return
+	}
+	command := remoteCommands[index]
+
+	s.mu.Lock()
+	playbackID := s.playbackID
+	if command == "toggle" {
+		command = "play"
+		if s.playing {
+			command = "pause"
+		}
+	}
+	s.mu.Unlock()
+	if playbackID == 0 {
+		return
+	}
+	// The handler runs on the main thread; don't hold it up on the network.
+	go func() {
+		if err := lyraClient.Load().SendCommand(playbackID, command); err != nil {
+			log.Printf("Error sending %s to Lyra: %v", command, err)
+		}
+	}()
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
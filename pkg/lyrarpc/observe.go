@@ -0,0 +1,82 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"lyra-rpc/pkg/discord"
+)
+
+// observeSink logs the presence lyra-rpc would show instead of showing it,
+// for running everything else without Discord.
+type observeSink struct {
+	lastKey string
+}
+
+func (s *observeSink) update(np *NowPlaying) {
+	if np == nil || presenceState.isHidden() {
+		if s.lastKey != "" {
+			log.Println(tr("Would clear the presence."))
+		}
+		s.lastKey = ""
+		return
+	}
+
+	key := presenceKey(np)
+	if key == s.lastKey {
+		return
+	}
+	s.lastKey = key
+	activity := config.Presence.Activity(np.Playback, newTemplateData(np), np.Image, np.ArtistImage)
+	log.Print(tr("Would show: %s", describeActivity(activity)))
+}
+
+// describeActivity renders activity on one line, roughly as Discord lays
+// it out.
+func describeActivity(a *discord.Activity) string {
+	parts := []string{a.Details}
+	if a.State != "" {
+		state := a.State
+		if a.Party != nil && a.Party.Size > 0 {
+			state += fmt.Sprintf(" (%d of %d)", a.Party.Size, max(a.Party.Max, a.Party.Size))
+		}
+		parts = append(parts, state)
+	}
+	if a.Assets != nil {
+		if a.Assets.LargeImage != "" {
+			parts = append(parts, fmt.Sprintf("large: %s (%s)", a.Assets.LargeImage, a.Assets.LargeText))
+		}
+		if a.Assets.SmallImage != "" {
+			parts = append(parts, fmt.Sprintf("small: %s (%s)", a.Assets.SmallImage, a.Assets.SmallText))
+		}
+	}
+	if t := a.Timestamps; t != nil && t.Start != 0 {
+		elapsed := time.Since(time.UnixMilli(t.Start)).Round(time.Second)
+		if t.End != 0 {
+			parts = append(parts, fmt.Sprintf("%s / %s", elapsed, time.Duration(t.End-t.Start)*time.Millisecond))
+		} else {
+			parts = append(parts, elapsed.String())
+		}
+	}
+	for _, b := range a.Buttons {
+		parts = append(parts, fmt.Sprintf("[%s](%s)", b.Label, b.URL))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// runObserve runs as usual but logs the presence instead of showing it in
+// Discord.
+func runObserve(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: lyra-rpc observe")
+	}
+	config.Observe = true
+	runDaemon(false, nil)
+	return nil
+}
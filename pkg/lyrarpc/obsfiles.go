@@ -0,0 +1,91 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"lyra-rpc/pkg/presence"
+)
+
+// TextFilesConfig writes the current track to plain text files, for
+// streaming software like OBS to display through text sources.
+type TextFilesConfig struct {
+	Enabled bool   `json:"enabled"`
+	Dir     string `json:"dir"`
+	// Files maps file names, relative to Dir, to templates. Nil writes
+	// defaultTextFiles.
+	Files map[string]string `json:"files"`
+	// ClearOnStop empties every file when playback stops instead of leaving
+	// the last track up.
+	ClearOnStop bool `json:"clear_on_stop"`
+}
+
+// defaultTextFiles are written when files is left out. They're filled in
+// once the config is loaded rather than being part of DefaultConfig, as
+// decoding into a map adds to it, leaving no way to remove one.
+var defaultTextFiles = map[string]string{
+	"title.txt":  "{{.Title}}",
+	"artist.txt": "{{.Artist}}",
+	"album.txt":  "{{.Album}}",
+}
+
+type textFilesSink struct {
+	config  TextFilesConfig
+	written map[string]string
+}
+
+func newTextFilesSink(c TextFilesConfig) (*textFilesSink, error) {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	if c.Files == nil {
+		c.Files = defaultTextFiles
+	}
+	return &textFilesSink{config: c, written: map[string]string{}}, nil
+}
+
+// update rewrites each file whose rendered contents changed. Files are
+// small and local, so this runs inline rather than in the background.
+func (s *textFilesSink) update(np *NowPlaying) {
+	if np == nil && !s.config.ClearOnStop {
+		return
+	}
+
+	var data presence.Data
+	if np != nil {
+		data = newTemplateData(np)
+	}
+	for name, text := range s.config.Files {
+		contents := ""
+		if np != nil {
+			var err error
+			if contents, err = presence.Render(text, data); err != nil {
+				log.Printf("Error rendering %s: %v", name, err)
+				continue
+			}
+		}
+		if written, ok := s.written[name]; ok && written == contents {
+			continue
+		}
+		if err := writeFileAtomic(filepath.Join(s.config.Dir, name), []byte(contents)); err != nil {
+			log.Printf("Error writing %s: %v", name, err)
+			continue
+		}
+		s.written[name] = contents
+	}
+}
+
+// writeFileAtomic replaces path in one step, so readers polling the file
+// never see it half-written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
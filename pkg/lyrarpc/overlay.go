@@ -0,0 +1,187 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"lyra-rpc/pkg/lyra"
+
+	"github.com/coder/websocket"
+)
+
+//go:embed overlay/index.html
+var overlayPage []byte
+
+// OverlayConfig serves a now-playing overlay page for use as an OBS browser
+// source.
+type OverlayConfig struct {
+	Enabled bool   `json:"enabled"`
+	Listen  string `json:"listen"`
+	// CSSFile is an optional stylesheet loaded after the built-in styles,
+	// typically overriding the --np-* CSS variables.
+	CSSFile string `json:"css_file"`
+}
+
+// overlayState is what the page receives over the WebSocket.
+type overlayState struct {
+	Playing    bool   `json:"playing"`
+	State      string `json:"state,omitempty"`
+	Title      string `json:"title,omitempty"`
+	Artist     string `json:"artist,omitempty"`
+	Album      string `json:"album,omitempty"`
+	Cover      string `json:"cover,omitempty"`
+	PositionMs int64  `json:"position_ms"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+}
+
+type overlaySink struct {
+	config OverlayConfig
+
+	mu      sync.Mutex
+	last    []byte
+	clients map[chan []byte]struct{}
+}
+
+func newOverlaySink(c OverlayConfig) *overlaySink {
+	return &overlaySink{config: c, last: []byte(`{"playing":false}`), clients: map[chan []byte]struct{}{}}
+}
+
+func (s *overlaySink) update(np *NowPlaying) {
+	state := overlayState{}
+	if np != nil {
+		data := newTemplateData(np)
+		state = overlayState{
+			Playing:    true,
+			State:      data.State,
+			Title:      data.Title,
+			Artist:     data.Artist,
+			Album:      data.Album,
+			PositionMs: data.PositionMs,
+			DurationMs: data.DurationMs,
+		}
+		// Covers come through the overlay server so the page works without
+		// any uploader configured.
+		if data.AlbumID != 0 {
+			state.Cover = "/cover/" + strconv.FormatInt(data.AlbumID, 10)
+		}
+	}
+
+	msg, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = msg
+	for ch := range s.clients {
+		// A client that can't keep up misses an update; the next one
+		// carries the full state anyway.
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+func (s *overlaySink) subscribe() (chan []byte, []byte) {
+	ch := make(chan []byte, 4)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[ch] = struct{}{}
+	return ch, s.last
+}
+
+func (s *overlaySink) unsubscribe(ch chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clients, ch)
+}
+
+func (s *overlaySink) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(overlayPage)
+	})
+	mux.HandleFunc("GET /theme.css", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css; charset=utf-8")
+		if s.config.CSSFile != "" {
+			http.ServeFile(w, r, s.config.CSSFile)
+		}
+	})
+	mux.HandleFunc("GET /cover/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		image, err := fetchLyraImage(lyra.AlbumCoverPath(id))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", http.DetectContentType(image))
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Write(image)
+	})
+	mux.HandleFunc("GET /ws", s.serveWebSocket)
+	return mux
+}
+
+func (s *overlaySink) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+
+	ch, last := s.subscribe()
+	defer s.unsubscribe(ch)
+
+	// The page never sends anything; reading just notices when it goes away.
+	ctx := conn.CloseRead(r.Context())
+
+	msg := last
+	for {
+		writeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := conn.Write(writeCtx, websocket.MessageText, msg)
+		cancel()
+		if err != nil {
+			return
+		}
+
+		select {
+		case msg = <-ch:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *overlaySink) start() (*http.Server, error) {
+	ln, err := net.Listen("tcp", s.config.Listen)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	// Shutting down doesn't wait for WebSockets, so they're told to
+	// close instead.
+	ctx, cancel := context.WithCancel(context.Background())
+	server.BaseContext = func(net.Listener) context.Context { return ctx }
+	server.RegisterOnShutdown(cancel)
+	serve(server, ln, "Overlay server")
+	log.Printf("Serving overlay at http://%s/", s.config.Listen)
+	return server, nil
+}
@@ -0,0 +1,323 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"lyra-rpc/pkg/presence"
+	"lyra-rpc/pkg/uploader"
+)
+
+// Plugins are executables in the plugins directory that talk JSON, one
+// message per line, over stdin and stdout. See the README for the protocol.
+const pluginProtocolVersion = 1
+
+// pluginUploaderPrefix selects a plugin as an uploader, e.g.
+// "uploader": "plugin:s3".
+const pluginUploaderPrefix = "plugin:"
+
+// pluginMessage is a message from a plugin.
+type pluginMessage struct {
+	Type         string   `json:"type"`
+	ID           int64    `json:"id"`
+	Version      int      `json:"version"`
+	Capabilities []string `json:"capabilities"`
+	URL          string   `json:"url"`
+	Error        string   `json:"error"`
+	Message      string   `json:"message"`
+}
+
+type plugin struct {
+	name         string
+	capabilities []string
+
+	writeMu sync.Mutex
+	stdin   io.WriteCloser
+	// updates holds the newest update not yet written, so a plugin that
+	// stops reading can't hold up the main loop.
+	updates chan *presence.Data
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan pluginMessage
+	exited  bool
+
+	process *os.Process
+	// done is closed once the plugin has exited and been waited for.
+	done chan struct{}
+}
+
+// pluginExitGrace is how long a plugin gets to exit on its own once its
+// stdin is closed, before it's killed.
+const pluginExitGrace = 2 * time.Second
+
+// startPlugins starts every executable in dir, registering them as sinks
+// and uploaders according to what they report supporting. Plugins are off
+// unless dir is set, and a missing directory just means there are none.
+func (e *Engine) startPlugins(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || !isExecutable(entry.Name(), info.Mode()) {
+			continue
+		}
+		p, err := startPlugin(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			log.Printf("Error starting plugin %s: %v", entry.Name(), err)
+			continue
+		}
+		e.cleanup = append(e.cleanup, p.close)
+		if slices.Contains(p.capabilities, "sink") {
+			e.sinks = append(e.sinks, p)
+		}
+		if slices.Contains(p.capabilities, "uploader") {
+			uploader.Register(pluginUploaderPrefix+p.name, p)
+		}
+		log.Printf("Started plugin %s (%s)", p.name, strings.Join(p.capabilities, ", "))
+	}
+	return nil
+}
+
+func isExecutable(name string, mode os.FileMode) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Ext(name), ".exe")
+	}
+	return mode&0o111 != 0
+}
+
+func startPlugin(path string) (*plugin, error) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	cmd := exec.Command(path)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &plugin{
+		name:    name,
+		stdin:   stdin,
+		updates: make(chan *presence.Data, 1),
+		pending: map[int64]chan pluginMessage{},
+		process: cmd.Process,
+		done:    make(chan struct{}),
+	}
+	lines := bufio.NewScanner(stdout)
+	lines.Buffer(nil, 1<<20)
+
+	// A plugin that fails the handshake is killed and reaped right away.
+	abandon := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+
+	// The plugin answers hello with what it can do before anything else.
+	hello := make(chan pluginMessage, 1)
+	go func() {
+		if lines.Scan() {
+			var msg pluginMessage
+			if json.Unmarshal(lines.Bytes(), &msg) == nil {
+				hello <- msg
+			}
+		}
+		close(hello)
+	}()
+	if err := p.send(map[string]any{"type": "hello", "version": pluginProtocolVersion}); err != nil {
+		abandon()
+		return nil, err
+	}
+
+	select {
+	case msg, ok := <-hello:
+		if !ok || msg.Type != "hello" {
+			abandon()
+			return nil, fmt.Errorf("plugin didn't answer hello")
+		}
+		if msg.Version != pluginProtocolVersion {
+			abandon()
+			return nil, fmt.Errorf("plugin speaks protocol version %d, want %d", msg.Version, pluginProtocolVersion)
+		}
+		p.capabilities = msg.Capabilities
+	case <-time.After(5 * time.Second):
+		abandon()
+		return nil, fmt.Errorf("timed out waiting for hello")
+	}
+
+	go p.run()
+	// Wait closes stdout, so it has to wait for everything the plugin
+	// wrote to be read.
+	go func() {
+		defer close(p.done)
+		p.read(lines)
+		err := cmd.Wait()
+		log.Printf("Plugin %s exited: %v", p.name, err)
+	}()
+	return p, nil
+}
+
+// close asks the plugin to exit by closing its stdin, and kills it if it
+// hasn't within pluginExitGrace.
+func (p *plugin) close() {
+	close(p.updates)
+	p.stdin.Close()
+
+	select {
+	case <-p.done:
+		return
+	case <-time.After(pluginExitGrace):
+	}
+	log.Printf("Plugin %s didn't exit, killing it", p.name)
+	p.process.Kill()
+	<-p.done
+}
+
+// read handles messages from the plugin until it closes stdout.
+func (p *plugin) read(lines *bufio.Scanner) {
+	for lines.Scan() {
+		var msg pluginMessage
+		if err := json.Unmarshal(lines.Bytes(), &msg); err != nil {
+			log.Printf("Error decoding message from plugin %s: %v", p.name, err)
+			continue
+		}
+		switch msg.Type {
+		case "log":
+			log.Printf("[%s] %s", p.name, msg.Message)
+		case "upload_result":
+			p.mu.Lock()
+			reply := p.pending[msg.ID]
+			delete(p.pending, msg.ID)
+			p.mu.Unlock()
+			if reply != nil {
+				reply <- msg
+			}
+		}
+	}
+
+	p.mu.Lock()
+	p.exited = true
+	for id, reply := range p.pending {
+		close(reply)
+		delete(p.pending, id)
+	}
+	p.mu.Unlock()
+}
+
+func (p *plugin) send(msg any) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	_, err = p.stdin.Write(append(line, '\n'))
+	return err
+}
+
+func (p *plugin) update(np *NowPlaying) {
+	var data *presence.Data
+	if np != nil {
+		d := newTemplateData(np)
+		data = &d
+	}
+	p.mu.Lock()
+	exited := p.exited
+	p.mu.Unlock()
+	if exited {
+		return
+	}
+	// Only the newest update matters if the plugin falls behind.
+	select {
+	case <-p.updates:
+	default:
+	}
+	p.updates <- data
+}
+
+func (p *plugin) run() {
+	for data := range p.updates {
+		if err := p.send(map[string]any{"type": "update", "now_playing": data}); err != nil {
+			log.Printf("Error sending update to plugin %s: %v", p.name, err)
+		}
+	}
+}
+
+// Upload asks the plugin to host image and waits for the URL until ctx is
+// done.
+func (p *plugin) Upload(ctx context.Context, image []byte, meta uploader.Meta) (string, error) {
+	reply := make(chan pluginMessage, 1)
+	p.mu.Lock()
+	if p.exited {
+		p.mu.Unlock()
+		return "", fmt.Errorf("plugin %s has exited", p.name)
+	}
+	p.nextID++
+	id := p.nextID
+	p.pending[id] = reply
+	p.mu.Unlock()
+
+	err := p.send(map[string]any{
+		"type":     "upload",
+		"id":       id,
+		"format":   meta.Format.Ext,
+		"animated": meta.Format.Animated,
+		"data":     image,
+	})
+	if err != nil {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+		return "", err
+	}
+
+	select {
+	case msg, ok := <-reply:
+		if !ok {
+			return "", fmt.Errorf("plugin %s exited during upload", p.name)
+		}
+		if msg.Error != "" {
+			return "", fmt.Errorf("plugin %s: %s", p.name, msg.Error)
+		}
+		if msg.URL == "" {
+			return "", fmt.Errorf("plugin %s returned no URL", p.name)
+		}
+		return msg.URL, nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+		return "", fmt.Errorf("plugin %s: %w", p.name, ctx.Err())
+	}
+}
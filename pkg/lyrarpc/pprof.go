@@ -0,0 +1,50 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+type DebugConfig struct {
+	// PprofAddr, when set, serves net/http/pprof at /debug/pprof/. It must
+	// be a loopback address, since profiles reveal a lot about the process.
+	PprofAddr string `json:"pprof_addr"`
+}
+
+// PprofHandler serves the profiling endpoints for debug.pprof_addr. The
+// lyra-rpc binary sets it; this package leaves net/http/pprof out, as
+// importing it registers the endpoints on http.DefaultServeMux in every
+// program embedding the engine.
+var PprofHandler http.Handler
+
+// startPprofServer serves the profiling endpoints on addr in the
+// background.
+func startPprofServer(addr string) (*http.Server, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("%s isn't a loopback address", addr)
+	}
+
+	if PprofHandler == nil {
+		return nil, fmt.Errorf("this build doesn't include the profiling endpoints")
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{Handler: PprofHandler, ReadHeaderTimeout: 10 * time.Second}
+	serve(server, ln, "pprof server")
+	log.Printf("Serving pprof on http://%s/debug/pprof/", addr)
+	return server, nil
+}
@@ -0,0 +1,77 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"sync"
+	"time"
+)
+
+// presenceLogSize is how many recent events the daemon remembers for
+// `lyra-rpc tail`.
+const presenceLogSize = 100
+
+// presenceLogEntry is one playback event as `lyra-rpc tail` shows it.
+type presenceLogEntry struct {
+	Time  time.Time `json:"time"`
+	Event eventType `json:"event"`
+	Track string    `json:"track,omitempty"`
+	// State is the playback state after the event, e.g. "playing".
+	State string `json:"state,omitempty"`
+}
+
+// presenceLog keeps the most recent events in memory and hands new ones to
+// whoever is tailing them.
+type presenceLog struct {
+	mu          sync.Mutex
+	entries     []presenceLogEntry
+	subscribers map[chan presenceLogEntry]struct{}
+}
+
+// add records ev, dropping the oldest entry once the log is full.
+func (l *presenceLog) add(ev event) {
+	entry := presenceLogEntry{Time: time.Now(), Event: ev.Type}
+	if np := ev.NowPlaying; np != nil {
+		entry.Track = trackLabel(np.Track)
+		entry.State = np.Playback.State
+		if ev.Type == eventStopped {
+			entry.State = "stopped"
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > presenceLogSize {
+		l.entries = l.entries[len(l.entries)-presenceLogSize:]
+	}
+	for ch := range l.subscribers {
+		// A tail that can't keep up misses entries rather than holding up
+		// the main loop.
+		select {
+		case ch <- entry:
+		default:
+		}
+	}
+}
+
+// subscribe returns the entries so far and a channel receiving every one
+// after them, until unsubscribe.
+func (l *presenceLog) subscribe() ([]presenceLogEntry, chan presenceLogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.subscribers == nil {
+		l.subscribers = map[chan presenceLogEntry]struct{}{}
+	}
+	ch := make(chan presenceLogEntry, 16)
+	l.subscribers[ch] = struct{}{}
+	return append([]presenceLogEntry(nil), l.entries...), ch
+}
+
+func (l *presenceLog) unsubscribe(ch chan presenceLogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.subscribers, ch)
+}
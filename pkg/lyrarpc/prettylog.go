@@ -0,0 +1,145 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiBold   = "\x1b[1m"
+	// ansiClearLine returns to the start of the line and clears it.
+	ansiClearLine = "\r\x1b[K"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// prettyConsole reformats the log for an interactive terminal: short
+// timestamps, colored errors, aligned now-playing lines, and a spinner
+// while artwork uploads.
+type prettyConsole struct {
+	out io.Writer
+
+	mu       sync.Mutex
+	spinning int
+	spinMsg  string
+	frame    int
+	ticker   *time.Ticker
+}
+
+// console is the pretty console when log_format is "pretty", or nil.
+var console *prettyConsole
+
+func newPrettyConsole(out io.Writer) *prettyConsole {
+	return &prettyConsole{out: out}
+}
+
+// Write takes one line from the log package, with its default date and
+// time prefix.
+func (c *prettyConsole) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+	stamp := ""
+	// "2006/01/02 15:04:05 " becomes "15:04:05".
+	if len(line) >= 20 && line[4] == '/' && line[10] == ' ' && line[19] == ' ' {
+		stamp, line = line[11:19], line[20:]
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clearSpinner()
+	fmt.Fprintf(c.out, "%s%s%s  %s\n", ansiDim, stamp, ansiReset, c.format(line))
+	c.drawSpinner()
+	return len(p), nil
+}
+
+// format colors a line by what it reports.
+func (c *prettyConsole) format(line string) string {
+	playing, paused := tr("Playing"), tr("Paused")
+	width := max(len([]rune(playing)), len([]rune(paused)))
+	pad := func(s string) string {
+		return s + strings.Repeat(" ", width-len([]rune(s)))
+	}
+
+	switch {
+	case strings.HasPrefix(line, playing+": "):
+		return fmt.Sprintf("%s▶ %s%s  %s%s%s", ansiGreen, pad(playing), ansiReset, ansiBold, strings.TrimPrefix(line, playing+": "), ansiReset)
+	case strings.HasPrefix(line, paused+": "):
+		return fmt.Sprintf("%s⏸ %s%s  %s", ansiYellow, pad(paused), ansiReset, strings.TrimPrefix(line, paused+": "))
+	case strings.HasPrefix(line, "Error") || strings.HasPrefix(line, tr("Error")):
+		return ansiRed + line + ansiReset
+	}
+	return line
+}
+
+// spin shows a spinner with msg until the returned func is called. Nested
+// spinners share one line.
+func (c *prettyConsole) spin(msg string) func() {
+	c.mu.Lock()
+	c.spinning++
+	c.spinMsg = msg
+	if c.spinning == 1 {
+		c.ticker = time.NewTicker(100 * time.Millisecond)
+		go c.animate(c.ticker)
+	}
+	c.drawSpinner()
+	c.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.spinning--
+			if c.spinning == 0 {
+				c.ticker.Stop()
+				c.clearSpinner()
+			}
+		})
+	}
+}
+
+func (c *prettyConsole) animate(ticker *time.Ticker) {
+	for range ticker.C {
+		c.mu.Lock()
+		if c.ticker != ticker || c.spinning == 0 {
+			c.mu.Unlock()
+			return
+		}
+		c.frame = (c.frame + 1) % len(spinnerFrames)
+		c.drawSpinner()
+		c.mu.Unlock()
+	}
+}
+
+// drawSpinner and clearSpinner are called with c.mu held.
+func (c *prettyConsole) drawSpinner() {
+	if c.spinning > 0 {
+		fmt.Fprintf(c.out, "%s%s%s %s%s", ansiClearLine, ansiDim, spinnerFrames[c.frame], c.spinMsg, ansiReset)
+	}
+}
+
+func (c *prettyConsole) clearSpinner() {
+	if c.spinning > 0 {
+		io.WriteString(c.out, ansiClearLine)
+	}
+}
+
+// spin shows a spinner on the pretty console, if it's in use, until the
+// returned func is called.
+func spin(msg string) func() {
+	if console == nil {
+		return func() {}
+	}
+	return console.spin(msg)
+}
@@ -0,0 +1,122 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// proxyDir holds the covers served by the image proxy, stored by content
+// hash so URLs stay stable across restarts.
+func proxyDir() (string, error) {
+	dir, err := artworkCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "covers"), nil
+}
+
+// storeProxyImage saves image for the proxy to serve and returns its public
+// URL. ext is kept in the URL so clients that go by extension, Discord
+// included, treat animated covers as animated.
+func storeProxyImage(image []byte, ext string) (string, error) {
+	dir, err := proxyDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(image)
+	name := hex.EncodeToString(sum[:]) + "." + ext
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.WriteFile(path, image, 0o644); err != nil {
+			return "", err
+		}
+	}
+
+	return strings.TrimSuffix(config.Images.Proxy.PublicURL, "/") + "/cover/" + name, nil
+}
+
+var proxyExtensions = map[string]bool{"jpg": true, "png": true, "gif": true, "webp": true}
+
+func proxyHandler(dir string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /cover/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		hash, ext, ok := strings.Cut(name, ".")
+		if !ok || len(hash) != sha256.Size*2 || !proxyExtensions[ext] {
+			http.NotFound(w, r)
+			return
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		// The modification time tracks when a cover was last served, so
+		// the cache budget removes the least recently used first.
+		now := time.Now()
+		os.Chtimes(path, now, now)
+
+		// Covers are named by content, so they never change.
+		w.Header().Set("Content-Type", http.DetectContentType(data))
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Write(data)
+	})
+	return mux
+}
+
+// startProxyServer serves stored covers in the background, over TLS when a
+// certificate is configured.
+func startProxyServer() (*http.Server, error) {
+	dir, err := proxyDir()
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := config.Images.Proxy
+	// Listening up front lets a port already in use or a bad certificate
+	// fail startup.
+	var cert tls.Certificate
+	if proxy.TLSCert != "" && proxy.TLSKey != "" {
+		if cert, err = tls.LoadX509KeyPair(proxy.TLSCert, proxy.TLSKey); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("tcp", proxy.Listen)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Certificate != nil {
+		ln = tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2", "http/1.1"}})
+	}
+	server := &http.Server{
+		Handler:           proxyHandler(dir),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serve(server, ln, "Image proxy")
+
+	log.Printf("Serving covers on %s as %s", proxy.Listen, proxy.PublicURL)
+	return server, nil
+}
@@ -0,0 +1,282 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"lyra-rpc/pkg/presence"
+)
+
+type RecapConfig struct {
+	Enabled bool `json:"enabled"`
+	// Period is "day" or "week": how far back a recap looks, and how often
+	// it's posted.
+	Period string `json:"period"`
+	// At is the local time of day recaps are posted, as "21:00". Weekly
+	// recaps are posted on Weekday.
+	At      string `json:"at"`
+	Weekday string `json:"weekday"`
+	// Limit is how many top artists, albums, and tracks are included.
+	Limit int `json:"limit"`
+	// DiscordWebhookURL posts the recap as an embed, with Title and
+	// Template as its title and text.
+	DiscordWebhookURL string `json:"discord_webhook_url"`
+	Title             string `json:"title"`
+	Template          string `json:"template"`
+	// WebhookURL posts the recap anywhere else, as JSON or rendered from
+	// WebhookTemplate.
+	WebhookURL      string            `json:"webhook_url"`
+	WebhookHeaders  map[string]string `json:"webhook_headers"`
+	WebhookTemplate string            `json:"webhook_template"`
+}
+
+// defaultRecapTemplate lays out the recap's embed text.
+const defaultRecapTemplate = `**{{number .Listens}} listens**, {{.Listened}} in total
+{{if .TopArtists}}
+**Top artists**
+{{range .TopArtists}}{{.Name}} ({{.Listens}})
+{{end}}{{end}}{{if .TopTracks}}
+**Top tracks**
+{{range .TopTracks}}{{.Name}} – {{.Artist}} ({{.Listens}})
+{{end}}{{end}}`
+
+// recapData is what recap templates can refer to: the stats for the
+// period, plus its bounds and total listening time formatted.
+type recapData struct {
+	historyStats
+	Period   string    `json:"period"`
+	Listened string    `json:"listened"`
+	Since    time.Time `json:"since"`
+	Until    time.Time `json:"until"`
+}
+
+type recapper struct {
+	config  RecapConfig
+	db      *sql.DB
+	at      time.Duration
+	weekday time.Weekday
+	client  *http.Client
+}
+
+func newRecapper(db *sql.DB, c RecapConfig) (*recapper, error) {
+	if c.Period != "day" && c.Period != "week" {
+		return nil, fmt.Errorf("unknown recap period %q; use day or week", c.Period)
+	}
+	at, err := time.Parse("15:04", c.At)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recap time %q, want HH:MM", c.At)
+	}
+	r := &recapper{
+		config: c,
+		db:     db,
+		at:     time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute,
+		client: newHTTPClient(15 * time.Second),
+	}
+	if c.Period == "week" {
+		weekday, ok := parseWeekday(c.Weekday)
+		if !ok {
+			return nil, fmt.Errorf("unknown recap weekday %q", c.Weekday)
+		}
+		r.weekday = weekday
+	}
+	return r, nil
+}
+
+func parseWeekday(name string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(name, d.String()) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// next returns when the first recap after now is due.
+func (r *recapper) next(now time.Time) time.Time {
+	y, m, d := now.Date()
+	due := time.Date(y, m, d, 0, 0, 0, 0, now.Location()).Add(r.at)
+	for !due.After(now) || (r.config.Period == "week" && due.Weekday() != r.weekday) {
+		// Going by the calendar rather than 24 hours keeps the time of
+		// day across daylight saving changes.
+		due = time.Date(due.Year(), due.Month(), due.Day()+1, 0, 0, 0, 0, now.Location()).Add(r.at)
+	}
+	return due
+}
+
+// run posts a recap whenever one is due until ctx is canceled. Recaps that
+// fell due while lyra-rpc wasn't running are skipped.
+func (r *recapper) run(ctx context.Context) {
+	for {
+		due := r.next(time.Now())
+		timer := time.NewTimer(time.Until(due))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := r.post(time.Now()); err != nil {
+			log.Printf("Error posting %sly recap: %v", r.config.Period, err)
+		}
+	}
+}
+
+// recap gathers the stats for the period ending at until.
+func (r *recapper) recap(until time.Time) (recapData, error) {
+	since := until.Add(-statsRanges[r.config.Period])
+	stats, err := queryHistoryStats(r.db, since, r.config.Limit)
+	if err != nil {
+		return recapData{}, err
+	}
+	stats.Range = r.config.Period
+	return recapData{
+		historyStats: stats,
+		Period:       r.config.Period,
+		Listened:     formatListened(stats.ListenedMs),
+		Since:        since,
+		Until:        until,
+	}, nil
+}
+
+// post sends the recap for the period ending at until to every configured
+// destination.
+func (r *recapper) post(until time.Time) error {
+	data, err := r.recap(until)
+	if err != nil {
+		return err
+	}
+	if r.config.DiscordWebhookURL != "" {
+		if err := r.postDiscord(data); err != nil {
+			return fmt.Errorf("Discord webhook: %w", err)
+		}
+	}
+	if r.config.WebhookURL != "" {
+		if err := r.postWebhook(data); err != nil {
+			return fmt.Errorf("webhook: %w", err)
+		}
+	}
+	return nil
+}
+
+// renderEmbed renders the recap's embed.
+func (r *recapper) renderEmbed(data recapData) (webhookEmbed, error) {
+	title, err := presence.Render(r.config.Title, data)
+	if err != nil {
+		return webhookEmbed{}, err
+	}
+	text := r.config.Template
+	if text == "" {
+		text = defaultRecapTemplate
+	}
+	description, err := presence.Render(text, data)
+	if err != nil {
+		return webhookEmbed{}, err
+	}
+	return webhookEmbed{Title: title, Description: strings.TrimSpace(description)}, nil
+}
+
+func (r *recapper) postDiscord(data recapData) error {
+	embed, err := r.renderEmbed(data)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]any{"embeds": []webhookEmbed{embed}})
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Post(r.config.DiscordWebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return &statusError{api: "Discord webhook", status: resp.StatusCode}
+	}
+	return nil
+}
+
+func (r *recapper) postWebhook(data recapData) error {
+	var body []byte
+	if r.config.WebhookTemplate == "" {
+		var err error
+		if body, err = json.Marshal(data); err != nil {
+			return err
+		}
+	} else {
+		rendered, err := presence.Render(r.config.WebhookTemplate, data)
+		if err != nil {
+			return err
+		}
+		body = []byte(rendered)
+	}
+
+	req, err := http.NewRequest("POST", r.config.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range r.config.WebhookHeaders {
+		req.Header.Set(name, value)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{api: "webhook", status: resp.StatusCode}
+	}
+	return nil
+}
+
+// runRecapCommand prints the recap as it would be posted now, or with
+// --post, posts it.
+func runRecapCommand(args []string) error {
+	fs := flag.NewFlagSet("recap", flag.ContinueOnError)
+	post := fs.Bool("post", false, "post the recap now instead of printing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := openHistory()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	r, err := newRecapper(db, config.Recap)
+	if err != nil {
+		return err
+	}
+	if *post {
+		if config.Recap.DiscordWebhookURL == "" && config.Recap.WebhookURL == "" {
+			return fmt.Errorf("recap needs a discord_webhook_url or webhook_url to post to")
+		}
+		return r.post(time.Now())
+	}
+
+	data, err := r.recap(time.Now())
+	if err != nil {
+		return err
+	}
+	embed, err := r.renderEmbed(data)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n\n%s\n", embed.Title, embed.Description)
+	return nil
+}
@@ -0,0 +1,114 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// statusError reports an unexpected HTTP status from a remote API.
+type statusError struct {
+	api    string
+	status int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s returned status %d", e.api, e.status)
+}
+
+func (e *statusError) HTTPStatus() int {
+	return e.status
+}
+
+// httpStatus returns the HTTP status carried by err, from this package or
+// any of pkg's clients, or zero.
+func httpStatus(err error) int {
+	var se interface{ HTTPStatus() int }
+	if errors.As(err, &se) {
+		return se.HTTPStatus()
+	}
+	return 0
+}
+
+// isRetryable reports whether err looks transient: a network failure, a
+// rate limit, or a server-side error.
+func isRetryable(err error) bool {
+	// API clients that report failures in the response body can classify
+	// them themselves.
+	var re interface{ retryable() bool }
+	if errors.As(err, &re) {
+		return re.retryable()
+	}
+	if status := httpStatus(err); status != 0 {
+		return status == http.StatusTooManyRequests || status >= 500
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// isNotFound reports whether err is a 404 from a remote API, which for
+// Lyra's image endpoints means the image simply doesn't exist.
+func isNotFound(err error) bool {
+	return httpStatus(err) == http.StatusNotFound
+}
+
+const uploadBackoff = time.Second
+
+// hostIntervals is the minimum spacing between requests to each image host.
+// Hosts not listed here are not rate limited.
+var hostIntervals = map[string]time.Duration{
+	"litterbox.catbox.moe": 2 * time.Second,
+	"catbox.moe":           2 * time.Second,
+	"api.imgur.com":        time.Second,
+}
+
+var (
+	hostMu          sync.Mutex
+	hostLastRequest = map[string]time.Time{}
+)
+
+// waitForHost blocks until another request to host is allowed.
+func waitForHost(host string) {
+	interval, ok := hostIntervals[host]
+	if !ok {
+		return
+	}
+
+	hostMu.Lock()
+	next := hostLastRequest[host].Add(interval)
+	now := time.Now()
+	if next.Before(now) {
+		next = now
+	}
+	hostLastRequest[host] = next
+	hostMu.Unlock()
+
+	time.Sleep(time.Until(next))
+}
+
+// retryUpload calls upload until it succeeds, fails permanently, or the
+// configured number of attempts is exhausted, backing off exponentially
+// between transient failures.
+func retryUpload(host string, upload func() (string, error)) (string, error) {
+	attempts := max(config.Images.UploadAttempts, 1)
+
+	for attempt := 1; ; attempt++ {
+		waitForHost(host)
+		url, err := upload()
+		if err == nil || !isRetryable(err) || attempt >= attempts {
+			return url, err
+		}
+
+		delay := uploadBackoff << (attempt - 1)
+		log.Printf("Upload to %s failed (attempt %d/%d), retrying in %s: %v", host, attempt, attempts, delay, err)
+		time.Sleep(delay)
+	}
+}
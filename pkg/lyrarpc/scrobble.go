@@ -0,0 +1,261 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"lyra-rpc/pkg/lyra"
+)
+
+// listen is one play of a track, as submitted to scrobbling services.
+type listen struct {
+	TrackID    int64     `json:"track_id"`
+	Title      string    `json:"title"`
+	Artists    []string  `json:"artists"`
+	Album      string    `json:"album"`
+	DurationMs int64     `json:"duration_ms"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+func (l listen) artist() string {
+	if len(l.Artists) == 0 {
+		return ""
+	}
+	return l.Artists[0]
+}
+
+func newListen(playback *lyra.Playback, track *lyra.Track, startedAt time.Time) listen {
+	l := listen{TrackID: track.DbID, Title: track.Title, StartedAt: startedAt}
+	for _, a := range track.Artists {
+		l.Artists = append(l.Artists, a.ArtistName)
+	}
+	if len(track.Albums) > 0 {
+		l.Album = track.Albums[0].AlbumTitle
+	}
+	if playback.DurationMs != nil {
+		l.DurationMs = *playback.DurationMs
+	}
+	return l
+}
+
+// scrobbleThreshold is how long a track must be played to count as a listen:
+// half its length or four minutes, whichever comes first. Tracks of 30
+// seconds or less never count.
+func scrobbleThreshold(durationMs int64) (time.Duration, bool) {
+	const maxThreshold = 4 * time.Minute
+	if durationMs == 0 {
+		return maxThreshold, true
+	}
+	duration := time.Duration(durationMs) * time.Millisecond
+	if duration <= 30*time.Second {
+		return 0, false
+	}
+	return min(duration/2, maxThreshold), true
+}
+
+// scrobbler is a service that receives now-playing updates and listens.
+type scrobbler interface {
+	name() string
+	nowPlaying(l listen) error
+	scrobble(batch []listen) error
+}
+
+// maxScrobbleBatch is the most listens submitted in one request.
+const maxScrobbleBatch = 50
+
+// scrobbleQueue submits listens to a scrobbler, keeping them on disk until
+// they're accepted so nothing is lost while offline or across restarts.
+type scrobbleQueue struct {
+	scrobbler scrobbler
+	path      string
+
+	mu       sync.Mutex
+	pending  []listen
+	flushing bool
+	backoff  time.Duration
+	retryAt  time.Time
+}
+
+func newScrobbleQueue(s scrobbler) *scrobbleQueue {
+	q := &scrobbleQueue{scrobbler: s}
+	dir, err := cacheDir()
+	if err != nil {
+		log.Printf("Error locating %s queue, listens won't survive restarts: %v", s.name(), err)
+		return q
+	}
+	q.path = filepath.Join(dir, "scrobbles-"+s.name()+".json")
+
+	data, err := os.ReadFile(q.path)
+	if err == nil {
+		err = json.Unmarshal(data, &q.pending)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Error loading %s queue: %v", s.name(), err)
+	}
+	if len(q.pending) > 0 {
+		log.Printf("%d queued %s listens to submit.", len(q.pending), s.name())
+	}
+	return q
+}
+
+// saveLocked writes the queue to disk. q.mu must be held.
+func (q *scrobbleQueue) saveLocked() {
+	if q.path == "" {
+		return
+	}
+	data, err := json.Marshal(q.pending)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(q.path), 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(q.path, data, 0o644)
+	}
+	if err != nil {
+		log.Printf("Error saving %s queue: %v", q.scrobbler.name(), err)
+	}
+}
+
+func (q *scrobbleQueue) add(l listen) {
+	q.mu.Lock()
+	q.pending = append(q.pending, l)
+	q.saveLocked()
+	q.mu.Unlock()
+	go q.flush()
+}
+
+// flush submits queued listens in batches until the queue is empty or a
+// submission fails, in which case it backs off before trying again.
+func (q *scrobbleQueue) flush() {
+	q.mu.Lock()
+	if q.flushing || len(q.pending) == 0 || time.Now().Before(q.retryAt) {
+		q.mu.Unlock()
+		return
+	}
+	q.flushing = true
+	q.mu.Unlock()
+
+	defer func() {
+		q.mu.Lock()
+		q.flushing = false
+		q.mu.Unlock()
+	}()
+
+	for {
+		q.mu.Lock()
+		batch := q.pending[:min(len(q.pending), maxScrobbleBatch)]
+		q.mu.Unlock()
+		if len(batch) == 0 {
+			return
+		}
+
+		err := q.scrobbler.scrobble(batch)
+
+		q.mu.Lock()
+		if err != nil && isRetryable(err) {
+			q.backoff = min(max(2*q.backoff, 30*time.Second), 30*time.Minute)
+			q.retryAt = time.Now().Add(q.backoff)
+			q.mu.Unlock()
+			log.Printf("Error submitting %d %s listens, retrying in %s: %v", len(batch), q.scrobbler.name(), q.backoff, err)
+			return
+		}
+		if err != nil {
+			log.Printf("Dropping %d %s listens rejected by the server: %v", len(batch), q.scrobbler.name(), err)
+		} else {
+			log.Printf("Submitted %d %s listens.", len(batch), q.scrobbler.name())
+		}
+		q.pending = q.pending[len(batch):]
+		q.backoff = 0
+		q.saveLocked()
+		q.mu.Unlock()
+	}
+}
+
+// listenTracker follows playback across polls, deciding when a track has
+// been played long enough to count as a listen.
+type listenTracker struct {
+	queues []*scrobbleQueue
+
+	current   *listen
+	playedFor time.Duration
+	lastSeen  time.Time
+	lastPosMs int64
+	playing   bool
+	submitted bool
+	threshold time.Duration
+	countable bool
+}
+
+func (t *listenTracker) addScrobbler(s scrobbler) {
+	t.queues = append(t.queues, newScrobbleQueue(s))
+}
+
+// update records the latest playback state for track.
+func (t *listenTracker) update(playback *lyra.Playback, track *lyra.Track) {
+	if len(t.queues) == 0 {
+		return
+	}
+	now := time.Now()
+	playing := playback.State == "playing"
+
+	// A repeat of the same track shows up as the position jumping back to
+	// the start once the previous play was already counted.
+	restarted := t.current != nil && t.submitted && playback.PositionMs < t.lastPosMs && playback.PositionMs < 5000
+
+	if t.current == nil || t.current.TrackID != track.DbID || restarted {
+		l := newListen(playback, track, now.Add(-time.Duration(playback.PositionMs)*time.Millisecond))
+		t.current = &l
+		t.playedFor = 0
+		t.submitted = false
+		t.threshold, t.countable = scrobbleThreshold(l.DurationMs)
+		if playing {
+			t.sendNowPlaying()
+		}
+	} else {
+		if t.playing {
+			t.playedFor += now.Sub(t.lastSeen)
+		}
+		if playing && !t.playing {
+			t.sendNowPlaying()
+		}
+	}
+
+	t.lastSeen = now
+	t.lastPosMs = playback.PositionMs
+	t.playing = playing
+
+	if !t.submitted && t.countable && t.playedFor >= t.threshold {
+		t.submitted = true
+		for _, q := range t.queues {
+			q.add(*t.current)
+		}
+	}
+
+	for _, q := range t.queues {
+		go q.flush()
+	}
+}
+
+// stop ends the current listen when playback stops.
+func (t *listenTracker) stop() {
+	t.current = nil
+	t.playing = false
+}
+
+func (t *listenTracker) sendNowPlaying() {
+	l := *t.current
+	for _, q := range t.queues {
+		go func(s scrobbler) {
+			if err := s.nowPlaying(l); err != nil {
+				log.Printf("Error sending now playing to %s: %v", s.name(), err)
+			}
+		}(q.scrobbler)
+	}
+}
@@ -0,0 +1,69 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends state to systemd when running as a Type=notify service,
+// and does nothing otherwise.
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	// An abstract socket is given with a leading @.
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		log.Printf("Error notifying systemd: %v", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		log.Printf("Error notifying systemd: %v", err)
+	}
+}
+
+// startWatchdog pings the systemd watchdog for as long as the engine's loop
+// keeps responding, so systemd restarts lyra-rpc if it wedges. It does
+// nothing unless the unit sets WatchdogSec.
+func startWatchdog(e *Engine) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	// The loop gets half the period to answer and is asked four times
+	// per period, so an update held up by a slow request still gets a
+	// ping in before systemd gives up. Artwork uploads, which can take
+	// far longer, happen off the loop and don't hold it up.
+	period := time.Duration(usec) * time.Microsecond
+	go func() {
+		for {
+			start := time.Now()
+			if e.alive(period / 2) {
+				sdNotify("WATCHDOG=1")
+			} else {
+				select {
+				case <-e.done:
+					return
+				default:
+				}
+				log.Printf("Playback loop hasn't responded in %s, skipping watchdog ping.", period/2)
+			}
+			time.Sleep(time.Until(start.Add(period / 4)))
+		}
+	}()
+}
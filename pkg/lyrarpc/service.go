@@ -0,0 +1,69 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// serviceOptions describes the service `lyra-rpc service install` sets up.
+type serviceOptions struct {
+	// user installs a per-user service rather than a system one.
+	user bool
+	// executable is the lyra-rpc binary the service runs.
+	executable string
+	// workDir is where the service runs, so it finds config.json.
+	workDir string
+}
+
+// runServiceCommand installs, removes, starts, or stops lyra-rpc as a
+// service managed by the platform's service manager.
+func runServiceCommand(args []string) error {
+	usage := fmt.Errorf("usage: lyra-rpc service install|uninstall|start|stop [--user]")
+	if len(args) == 0 {
+		return usage
+	}
+
+	fs := flag.NewFlagSet("service", flag.ContinueOnError)
+	user := fs.Bool("user", false, "install a service for the current user")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	opts, err := newServiceOptions(*user)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "install":
+		return installService(opts)
+	case "uninstall":
+		return uninstallService(opts)
+	case "start":
+		return startService(opts)
+	case "stop":
+		return stopService(opts)
+	default:
+		return usage
+	}
+}
+
+func newServiceOptions(user bool) (serviceOptions, error) {
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		return serviceOptions{}, fmt.Errorf("locating lyra-rpc: %w", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return serviceOptions{}, err
+	}
+	return serviceOptions{user: user, executable: exe, workDir: wd}, nil
+}
@@ -0,0 +1,170 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+const launchAgentLabel = "com.github.stayblue.lyra-rpc"
+
+// launchAgent starts lyra-rpc at login, and with KeepAlive, keeps it
+// running. Agents run in the user's session, where Discord is reachable, so
+// --user is implied.
+var launchAgent = template.Must(template.New("plist").Funcs(template.FuncMap{
+	"xml": func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	},
+}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{.Label | xml}}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{.Executable | xml}}</string>
+	</array>
+	<key>WorkingDirectory</key>
+	<string>{{.WorkDir | xml}}</string>
+	<key>RunAtLoad</key>
+	<true/>
+{{- if .KeepAlive}}
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>ThrottleInterval</key>
+	<integer>10</integer>
+{{- end}}
+	<key>StandardOutPath</key>
+	<string>{{.Log | xml}}</string>
+	<key>StandardErrorPath</key>
+	<string>{{.Log | xml}}</string>
+</dict>
+</plist>
+`))
+
+func launchAgentPath(label string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", label+".plist"), nil
+}
+
+func launchAgentLog() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "Logs", "lyra-rpc.log"), nil
+}
+
+// launchDomain is the launchd domain of the logged-in user's session.
+func launchDomain() string {
+	return fmt.Sprintf("gui/%d", os.Getuid())
+}
+
+// writeLaunchAgent writes the plist for an agent running lyra-rpc as opts
+// describes, returning where it was written.
+func writeLaunchAgent(label string, opts serviceOptions, keepAlive bool) (string, error) {
+	path, err := launchAgentPath(label)
+	if err != nil {
+		return "", err
+	}
+	logPath, err := launchAgentLog()
+	if err != nil {
+		return "", err
+	}
+
+	var plist bytes.Buffer
+	err = launchAgent.Execute(&plist, map[string]any{
+		"Label":      label,
+		"Executable": opts.executable,
+		"WorkDir":    opts.workDir,
+		"Log":        logPath,
+		"KeepAlive":  keepAlive,
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, dir := range []string{filepath.Dir(path), filepath.Dir(logPath)} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", err
+		}
+	}
+	if err := os.WriteFile(path, plist.Bytes(), 0o644); err != nil {
+		return "", err
+	}
+	log.Printf("Wrote %s", path)
+	return path, nil
+}
+
+func installService(opts serviceOptions) error {
+	path, err := writeLaunchAgent(launchAgentLabel, opts, true)
+	if err != nil {
+		return err
+	}
+
+	// Reinstalling replaces an agent that's already loaded.
+	exec.Command("launchctl", "bootout", launchDomain()+"/"+launchAgentLabel).Run()
+	if err := launchctl("bootstrap", launchDomain(), path); err != nil {
+		return err
+	}
+	logPath, _ := launchAgentLog()
+	log.Printf("lyra-rpc is running as a launch agent, logging to %s", logPath)
+	return nil
+}
+
+func uninstallService(opts serviceOptions) error {
+	path, err := launchAgentPath(launchAgentLabel)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return fmt.Errorf("no launch agent installed at %s", path)
+	}
+
+	if err := launchctl("bootout", launchDomain()+"/"+launchAgentLabel); err != nil {
+		log.Printf("Error unloading launch agent: %v", err)
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	log.Printf("Removed %s", path)
+	return nil
+}
+
+func startService(opts serviceOptions) error {
+	return launchctl("kickstart", launchDomain()+"/"+launchAgentLabel)
+}
+
+// stopService stops the agent until the next login. It exits cleanly on
+// SIGTERM, so KeepAlive leaves it stopped.
+func stopService(opts serviceOptions) error {
+	return launchctl("kill", "SIGTERM", launchDomain()+"/"+launchAgentLabel)
+}
+
+func launchctl(args ...string) error {
+	cmd := exec.Command("launchctl", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("launchctl %s: %w", args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const systemdUnitName = "lyra-rpc.service"
+
+// systemdUnit runs lyra-rpc as a notify service, so systemd knows when it's
+// up and restarts it if the watchdog stops being pinged.
+var systemdUnit = template.Must(template.New("unit").Parse(`[Unit]
+Description=Lyra Discord Rich Presence
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=notify
+ExecStart={{.Executable}}
+WorkingDirectory={{.WorkDir}}
+Restart=on-failure
+RestartSec=10
+WatchdogSec=60
+
+[Install]
+WantedBy=default.target
+`))
+
+func systemdUnitPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "systemd", "user", systemdUnitName), nil
+}
+
+// errSystemService is returned without --user. Discord and the session
+// bus live in the user's session, out of reach of a system service.
+var errSystemService = errors.New("only user services are supported, as a system service can't reach Discord; pass --user")
+
+func installService(opts serviceOptions) error {
+	if !opts.user {
+		return errSystemService
+	}
+	path, err := systemdUnitPath()
+	if err != nil {
+		return err
+	}
+
+	var unit bytes.Buffer
+	err = systemdUnit.Execute(&unit, map[string]string{
+		"Executable": systemdQuote(opts.executable),
+		"WorkDir":    systemdEscape(opts.workDir),
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, unit.Bytes(), 0o644); err != nil {
+		return err
+	}
+	log.Printf("Wrote %s", path)
+
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	if err := systemctl("enable", "--now", systemdUnitName); err != nil {
+		return err
+	}
+	log.Printf("lyra-rpc is running as a user service. Follow its log with: journalctl --user -u %s -f", systemdUnitName)
+	return nil
+}
+
+func uninstallService(opts serviceOptions) error {
+	if !opts.user {
+		return errSystemService
+	}
+	path, err := systemdUnitPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return fmt.Errorf("no user service installed at %s", path)
+	}
+
+	if err := systemctl("disable", "--now", systemdUnitName); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	log.Printf("Removed %s", path)
+	return nil
+}
+
+func startService(opts serviceOptions) error {
+	if !opts.user {
+		return errSystemService
+	}
+	return systemctl("start", systemdUnitName)
+}
+
+func stopService(opts serviceOptions) error {
+	if !opts.user {
+		return errSystemService
+	}
+	return systemctl("stop", systemdUnitName)
+}
+
+func systemctl(args ...string) error {
+	cmd := exec.Command("systemctl", append([]string{"--user"}, args...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemctl --user %s: %w", args[0], err)
+	}
+	return nil
+}
+
+// systemdQuote quotes a path for a command line in a unit file.
+func systemdQuote(s string) string {
+	return systemdEscape(strconv.Quote(s))
+}
+
+// systemdEscape escapes the % specifiers systemd would otherwise expand.
+func systemdEscape(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
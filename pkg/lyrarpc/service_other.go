@@ -0,0 +1,27 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !linux && !darwin && !windows
+
+package lyrarpc
+
+import "errors"
+
+var errServiceUnsupported = errors.New("installing a service isn't supported on this platform")
+
+func installService(opts serviceOptions) error {
+	return errServiceUnsupported
+}
+
+func uninstallService(opts serviceOptions) error {
+	return errServiceUnsupported
+}
+
+func startService(opts serviceOptions) error {
+	return errServiceUnsupported
+}
+
+func stopService(opts serviceOptions) error {
+	return errServiceUnsupported
+}
@@ -0,0 +1,240 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const windowsServiceName = "lyra-rpc"
+
+// errUserService is returned for --user. Windows services run under a
+// service account, which can still reach Discord's pipe.
+var errUserService = errors.New("per-user services aren't supported on Windows; leave out --user")
+
+func installService(opts serviceOptions) error {
+	if opts.user {
+		return errUserService
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connecting to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(windowsServiceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s is already installed", windowsServiceName)
+	}
+	s, err := m.CreateService(windowsServiceName, opts.executable, mgr.Config{
+		DisplayName: "Lyra Discord Rich Presence",
+		Description: "Shows what's playing on Lyra in Discord.",
+		StartType:   mgr.StartAutomatic,
+	}, "service", "run", "--dir", opts.workDir)
+	if err != nil {
+		return fmt.Errorf("creating service: %w", err)
+	}
+	defer s.Close()
+
+	// Restart after a crash, backing off a little each time.
+	err = s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 10 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: time.Minute},
+	}, uint32((24 * time.Hour).Seconds()))
+	if err != nil {
+		log.Printf("Error setting service recovery actions: %v", err)
+	}
+
+	if err := eventlog.InstallAsEventCreate(windowsServiceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		log.Printf("Error registering event log source: %v", err)
+	}
+
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("starting service: %w", err)
+	}
+	log.Printf("lyra-rpc is running as the %s service. Its log is in the Event Viewer, under Windows Logs > Application.", windowsServiceName)
+	return nil
+}
+
+func uninstallService(opts serviceOptions) error {
+	if opts.user {
+		return errUserService
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connecting to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(windowsServiceName)
+	if err != nil {
+		return fmt.Errorf("service %s isn't installed", windowsServiceName)
+	}
+	defer s.Close()
+
+	if err := stopWindowsService(s); err != nil {
+		log.Printf("Error stopping service: %v", err)
+	}
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("removing service: %w", err)
+	}
+	eventlog.Remove(windowsServiceName)
+	log.Printf("Removed the %s service.", windowsServiceName)
+	return nil
+}
+
+func startService(opts serviceOptions) error {
+	return withWindowsService(opts, func(s *mgr.Service) error {
+		return s.Start()
+	})
+}
+
+func stopService(opts serviceOptions) error {
+	return withWindowsService(opts, stopWindowsService)
+}
+
+func withWindowsService(opts serviceOptions, f func(s *mgr.Service) error) error {
+	if opts.user {
+		return errUserService
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connecting to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(windowsServiceName)
+	if err != nil {
+		return fmt.Errorf("service %s isn't installed", windowsServiceName)
+	}
+	defer s.Close()
+	return f(s)
+}
+
+// stopWindowsService asks the service to stop and waits for it to, while
+// it clears the presence.
+func stopWindowsService(s *mgr.Service) error {
+	status, err := s.Query()
+	if err != nil {
+		return err
+	}
+	if status.State == svc.Stopped {
+		return nil
+	}
+	if _, err := s.Control(svc.Stop); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for the service to stop")
+		}
+		time.Sleep(300 * time.Millisecond)
+		if status, err = s.Query(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runWindowsService runs lyra-rpc under the service manager if that's what
+// started it, reporting whether it did.
+func runWindowsService() bool {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return false
+	}
+
+	if elog, err := eventlog.Open(windowsServiceName); err == nil {
+		defer elog.Close()
+		log.SetOutput(eventLogWriter{elog})
+		log.SetFlags(0)
+	}
+
+	// Services start in System32, so the directory with config.json is
+	// passed on the command line when installing.
+	fs := flag.NewFlagSet("service", flag.ContinueOnError)
+	dir := fs.String("dir", "", "")
+	if len(os.Args) > 3 {
+		fs.Parse(os.Args[3:])
+	}
+	if *dir != "" {
+		if err := os.Chdir(*dir); err != nil {
+			log.Printf("Error changing to %s: %v", *dir, err)
+			return true
+		}
+	}
+	if err := loadConfig("config.json"); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error loading config: %v", err)
+		return true
+	}
+
+	if err := svc.Run(windowsServiceName, windowsService{}); err != nil {
+		log.Printf("Error running service: %v", err)
+	}
+	return true
+}
+
+// windowsService handles requests from the service manager.
+type windowsService struct{}
+
+func (windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	engine := New(Options{Config: config})
+	if err := engine.Start(); err != nil {
+		log.Printf("Error starting: %v", err)
+		return true, 1
+	}
+	log.Println("Rich presence is running.")
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				log.Println("Shutting down.")
+				status <- svc.Status{State: svc.StopPending}
+				engine.Stop()
+				return false, 0
+			}
+		case <-engine.done:
+			return false, 0
+		}
+	}
+}
+
+// eventLogWriter sends log output to the Windows event log, as errors for
+// lines that report one.
+type eventLogWriter struct {
+	elog *eventlog.Log
+}
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\n")
+	var err error
+	if strings.HasPrefix(msg, "Error") {
+		err = w.elog.Error(1, msg)
+	} else {
+		err = w.elog.Info(1, msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,16 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !windows
+
+package lyrarpc
+
+import (
+	"os"
+	"syscall"
+)
+
+// shutdownSignals are the signals that stop lyra-rpc cleanly. systemd and
+// most service managers send SIGTERM.
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT}
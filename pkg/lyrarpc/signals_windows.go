@@ -0,0 +1,16 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"os"
+	"syscall"
+)
+
+// shutdownSignals are the signals that stop lyra-rpc cleanly. Go delivers
+// Ctrl+C and Ctrl+Break as os.Interrupt, and closing the console window,
+// logging off, or shutting down as SIGTERM, holding the process open for
+// the few seconds Windows allows so the presence can still be cleared.
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
@@ -0,0 +1,275 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"lyra-rpc/pkg/lyra"
+)
+
+// scenario scripts playback for `lyra-rpc simulate`.
+type scenario struct {
+	// Tracks are served by the fake Lyra API. Empty uses the demo tracks.
+	Tracks []demoTrack    `json:"tracks"`
+	Steps  []scenarioStep `json:"steps"`
+	// IntervalSec is how often playback is reported between steps, as a
+	// poller would. Zero only reports it at each step.
+	IntervalSec float64 `json:"interval_sec"`
+	// Loop starts over after the last step instead of stopping.
+	Loop bool `json:"loop"`
+}
+
+// scenarioStep changes playback at AtSec seconds into the scenario.
+type scenarioStep struct {
+	AtSec float64 `json:"at_sec"`
+	// Action is "play", "pause", "resume", "seek", "stop", or "error".
+	// "play" with a TrackID changes track; without one it's "resume".
+	Action      string  `json:"action"`
+	TrackID     int64   `json:"track_id"`
+	PositionSec float64 `json:"position_sec"`
+	// Error is what an "error" step reports instead of playback, as if Lyra
+	// couldn't be reached.
+	Error string `json:"error"`
+}
+
+func loadScenario(path string) (*scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sc scenario
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return nil, err
+	}
+	if len(sc.Tracks) == 0 {
+		sc.Tracks = demoTracks
+	}
+
+	tracks := map[int64]bool{}
+	for _, t := range sc.Tracks {
+		tracks[t.DbID] = true
+	}
+	last := 0.0
+	for i, step := range sc.Steps {
+		if step.AtSec < last {
+			return nil, fmt.Errorf("step %d: at_sec goes backwards", i+1)
+		}
+		last = step.AtSec
+		switch step.Action {
+		case "play":
+			if step.TrackID != 0 && !tracks[step.TrackID] {
+				return nil, fmt.Errorf("step %d: no track with db_id %d", i+1, step.TrackID)
+			}
+		case "pause", "resume", "seek", "stop", "error":
+		default:
+			return nil, fmt.Errorf("step %d: unknown action %q", i+1, step.Action)
+		}
+	}
+	if len(sc.Steps) == 0 {
+		return nil, errors.New("scenario has no steps")
+	}
+	return &sc, nil
+}
+
+// simulator is a lyra.Source that plays a scenario.
+type simulator struct {
+	scenario  *scenario
+	durations map[int64]int64
+
+	trackID int64
+	state   string
+	basePos int64
+	since   time.Time
+	err     error
+}
+
+func newSimulator(sc *scenario) *simulator {
+	s := &simulator{scenario: sc, durations: map[int64]int64{}}
+	for _, t := range sc.Tracks {
+		s.durations[t.DbID] = t.DurationMs
+	}
+	return s
+}
+
+// position returns where playback is at now.
+func (s *simulator) position(now time.Time) int64 {
+	pos := s.basePos
+	if s.state == "playing" {
+		pos += now.Sub(s.since).Milliseconds()
+	}
+	if d := s.durations[s.trackID]; d > 0 && pos > d {
+		pos = d
+	}
+	return pos
+}
+
+func (s *simulator) apply(step scenarioStep, now time.Time) {
+	s.basePos = s.position(now)
+	s.since = now
+	s.err = nil
+
+	switch step.Action {
+	case "play":
+		if step.TrackID != 0 {
+			s.trackID = step.TrackID
+			s.basePos = 0
+		}
+		if s.trackID != 0 {
+			s.state = "playing"
+		}
+	case "resume":
+		if s.trackID != 0 {
+			s.state = "playing"
+		}
+	case "pause":
+		if s.state == "playing" {
+			s.state = "paused"
+		}
+	case "seek":
+		s.basePos = int64(step.PositionSec * 1000)
+	case "stop":
+		s.trackID, s.state, s.basePos = 0, "", 0
+	case "error":
+		s.err = errors.New(step.Error)
+		if step.Error == "" {
+			s.err = errors.New("simulated error")
+		}
+	}
+}
+
+func (s *simulator) current(now time.Time) lyra.Update {
+	if s.err != nil {
+		return lyra.Update{Err: s.err}
+	}
+	if s.state == "" {
+		return lyra.Update{}
+	}
+	playback := &lyra.Playback{
+		PlaybackID:  1,
+		TrackID:     s.trackID,
+		UserID:      1,
+		PositionMs:  s.position(now),
+		State:       s.state,
+		ActivityMs:  now.UnixMilli(),
+		UpdatedAtMs: now.UnixMilli(),
+	}
+	if d, ok := s.durations[s.trackID]; ok {
+		playback.DurationMs = &d
+	}
+	return lyra.Update{Playback: playback}
+}
+
+// Run plays the scenario, reporting playback after every step and every
+// interval in between. It returns after the last step unless the scenario
+// loops.
+func (s *simulator) Run(ctx context.Context, updates chan<- lyra.Update) error {
+	interval := time.Duration(s.scenario.IntervalSec * float64(time.Second))
+	for {
+		start := time.Now()
+		*s = simulator{scenario: s.scenario, durations: s.durations, since: start}
+
+		for _, step := range s.scenario.Steps {
+			at := start.Add(time.Duration(step.AtSec * float64(time.Second)))
+			// Report in between steps, as a poller would.
+			for interval > 0 && time.Until(at) > interval {
+				if !sleepCtx(ctx, interval) {
+					return nil
+				}
+				if !sendUpdate(ctx, updates, s.current(time.Now())) {
+					return nil
+				}
+			}
+			if !sleepCtx(ctx, time.Until(at)) {
+				return nil
+			}
+
+			now := time.Now()
+			s.apply(step, now)
+			debugf("Simulator: %s at %.1fs", step.Action, step.AtSec)
+			if !sendUpdate(ctx, updates, s.current(now)) {
+				return nil
+			}
+		}
+
+		if !s.scenario.Loop {
+			log.Println("Scenario finished.")
+			return nil
+		}
+	}
+}
+
+// sleepCtx waits for d, reporting false if ctx was done first.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func sendUpdate(ctx context.Context, updates chan<- lyra.Update, u lyra.Update) bool {
+	select {
+	case updates <- u:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// runSimulate runs lyra-rpc with playback scripted by a scenario file,
+// against a fake Lyra API serving the scenario's tracks.
+func runSimulate(args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	discordLog := fs.String("discord-log", "", "show the presence on a fake Discord, recording each activity to this file, or - for stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: lyra-rpc simulate [--discord-log FILE] SCENARIO.json")
+	}
+	sc, err := loadScenario(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("loading scenario: %w", err)
+	}
+
+	if *discordLog != "" {
+		stop, err := recordActivities(*discordLog)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: newDemoServer(sc.Tracks).handler()}
+	go func() {
+		if err := server.Serve(ln); err != nil {
+			log.Printf("Error serving simulated Lyra API: %v", err)
+		}
+	}()
+	useDemoServer(ln.Addr())
+	log.Printf("Simulating %d steps from %s", len(sc.Steps), fs.Arg(0))
+	runDaemon(false, newSimulator(sc))
+	return nil
+}
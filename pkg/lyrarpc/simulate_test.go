@@ -0,0 +1,99 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"lyra-rpc/pkg/discord"
+	"lyra-rpc/pkg/discord/discordtest"
+	"lyra-rpc/pkg/presence"
+)
+
+// TestSimulatePresence plays a scenario through the whole engine and checks
+// what reaches Discord.
+func TestSimulatePresence(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	sc := &scenario{
+		Tracks: demoTracks,
+		Steps: []scenarioStep{
+			{AtSec: 0, Action: "play", TrackID: demoTracks[0].DbID},
+			{AtSec: 0.3, Action: "pause"},
+			{AtSec: 0.6, Action: "seek", PositionSec: 20},
+			{AtSec: 0.9, Action: "resume"},
+			{AtSec: 1.2, Action: "stop"},
+		},
+	}
+	lyraServer := httptest.NewServer(newDemoServer(sc.Tracks).handler())
+	defer lyraServer.Close()
+	discordServer, err := discordtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer discordServer.Close()
+
+	cfg := DefaultConfig()
+	cfg.BaseURL = lyraServer.URL
+	cfg.DiscordIPCPath = discordServer.Path
+	cfg.RestoreState = false
+	cfg.StopGraceSec = 0
+	cfg.Battery.Enabled = false
+	cfg.Away = AwayConfig{}
+	cfg.Alerts.Enabled = false
+	if err := New(Options{Config: cfg, Source: newSimulator(sc)}).Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := discordServer.Wait(5, 5*time.Second)
+	if err != nil {
+		t.Fatalf("got %d activities: %v", len(got), err)
+	}
+	activities := make([]*discord.Activity, len(got))
+	for i, a := range got {
+		if err := json.Unmarshal(a.Payload, &activities[i]); err != nil {
+			t.Fatalf("activity %d: %v", i, err)
+		}
+	}
+
+	duration := time.Duration(demoTracks[0].DurationMs) * time.Millisecond
+	checkPlaying := func(i int, position time.Duration) {
+		t.Helper()
+		a := activities[i]
+		if a == nil || a.Timestamps == nil {
+			t.Fatalf("activity %d = %+v, want timestamps while playing", i, a)
+		}
+		if a.Details != demoTracks[0].Title {
+			t.Errorf("activity %d details = %q, want %q", i, a.Details, demoTracks[0].Title)
+		}
+		start := time.UnixMilli(a.Timestamps.Start)
+		if want := got[i].Received.Add(-position); start.Sub(want).Abs() > time.Second {
+			t.Errorf("activity %d starts %v after it arrived, want %v", i, got[i].Received.Sub(start), position)
+		}
+		if end := time.UnixMilli(a.Timestamps.End); end.Sub(start) != duration {
+			t.Errorf("activity %d lasts %v, want %v", i, end.Sub(start), duration)
+		}
+	}
+	checkPaused := func(i int) {
+		t.Helper()
+		a := activities[i]
+		if a == nil || a.Timestamps != nil || a.Assets == nil || a.Assets.SmallImage != presence.PausedImage {
+			t.Fatalf("activity %d = %+v, want paused without timestamps", i, a)
+		}
+	}
+
+	checkPlaying(0, 0)
+	checkPaused(1)
+	checkPaused(2)
+	checkPlaying(3, 20*time.Second)
+	if activities[4] != nil {
+		t.Errorf("activity 4 = %+v, want the presence cleared on stop", activities[4])
+	}
+}
@@ -0,0 +1,129 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"log"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"lyra-rpc/pkg/lyra"
+	"lyra-rpc/pkg/presence"
+)
+
+// NowPlaying is a snapshot of the current playback, handed to every sink
+// after each poll.
+type NowPlaying struct {
+	Playback *lyra.Playback
+	Track    *lyra.Track
+	// Image is the large image shown in the presence: an uploaded cover URL
+	// or a Discord asset key.
+	Image string
+	// ArtistImage is the first artist's uploaded image, if any.
+	ArtistImage string
+	// LyricsURL is where the lyrics button links, if it's enabled.
+	LyricsURL string
+	// SpotifyURL is where the Spotify button links, if it's enabled.
+	SpotifyURL string
+	// Listeners is how many other users on the same server are playing
+	// along, when listening_along is enabled.
+	Listeners int
+}
+
+// imageURL returns Image if it's a URL rather than an asset key, which only
+// means something to Discord.
+func (np *NowPlaying) imageURL() string {
+	if strings.HasPrefix(np.Image, "http://") || strings.HasPrefix(np.Image, "https://") {
+		return np.Image
+	}
+	return ""
+}
+
+// newTemplateData describes np for user-supplied templates.
+func newTemplateData(np *NowPlaying) presence.Data {
+	data := presence.NewData(np.Playback, np.Track, np.imageURL())
+	data.Listeners = np.Listeners
+	return data
+}
+
+// sink is an output, such as the Discord presence. update is called after
+// every poll, with nil once nothing is playing, and must not block on
+// network I/O. Sinks are updated concurrently with each other, but a sink's
+// update is never called again before the last call returned.
+type sink interface {
+	update(np *NowPlaying)
+}
+
+// threadBoundSink is a sink that has to be updated from the polling
+// goroutine rather than alongside the others, e.g. because it services the
+// main thread's run loop.
+type threadBoundSink interface {
+	sink
+	threadBound()
+}
+
+// stoppableSink is a sink with work of its own in the background, which is
+// stopped once the engine stops.
+type stoppableSink interface {
+	sink
+	stop()
+}
+
+// publish hands np to every sink and waits for them all. A sink that panics
+// is logged and skipped, so one broken output can't take the others down.
+func (e *Engine) publish(np *NowPlaying) {
+	var wg sync.WaitGroup
+	for _, s := range e.sinks {
+		if _, ok := s.(threadBoundSink); ok {
+			updateSink(s, np)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			updateSink(s, np)
+		}()
+	}
+	wg.Wait()
+}
+
+func updateSink(s sink, np *NowPlaying) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Error updating %T: %v\n%s", s, r, debug.Stack())
+		}
+	}()
+	s.update(np)
+}
+
+// playTimer accumulates how long the current track has been playing across
+// polls, for sinks that only act once a track has played for a while.
+type playTimer struct {
+	trackID   int64
+	playedFor time.Duration
+	lastSeen  time.Time
+	playing   bool
+}
+
+// update advances the timer and reports whether the track changed.
+func (t *playTimer) update(np *NowPlaying) bool {
+	now := time.Now()
+	if np == nil {
+		*t = playTimer{}
+		return false
+	}
+
+	changed := np.Track.DbID != t.trackID
+	if changed {
+		*t = playTimer{trackID: np.Track.DbID}
+	} else if t.playing {
+		t.playedFor += now.Sub(t.lastSeen)
+	}
+	t.lastSeen = now
+	t.playing = np.Playback.State == "playing"
+	return changed
+}
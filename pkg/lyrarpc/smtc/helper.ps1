@@ -0,0 +1,69 @@
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this
+# file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+# Bridges lyra-rpc to the Windows System Media Transport Controls. Reads one
+# JSON update per line on stdin and writes the name of each pressed media
+# button (Play, Pause, Next, Previous, Stop) to stdout.
+
+$ErrorActionPreference = "Stop"
+Add-Type -AssemblyName System.Runtime.WindowsRuntime
+$null = [Windows.Media.Playback.MediaPlayer, Windows.Media.Playback, ContentType = WindowsRuntime]
+$null = [Windows.Storage.Streams.RandomAccessStreamReference, Windows.Storage.Streams, ContentType = WindowsRuntime]
+
+# A MediaPlayer with its command manager disabled hands out a transport
+# controls instance that isn't tied to any actual playback.
+$player = New-Object Windows.Media.Playback.MediaPlayer
+$player.CommandManager.IsEnabled = $false
+$smtc = $player.SystemMediaTransportControls
+$smtc.IsEnabled = $true
+$smtc.IsPlayEnabled = $true
+$smtc.IsPauseEnabled = $true
+$smtc.IsNextEnabled = $true
+$smtc.IsPreviousEnabled = $true
+$smtc.IsStopEnabled = $true
+
+$null = Register-ObjectEvent -InputObject $smtc -EventName ButtonPressed -Action {
+    [Console]::Out.WriteLine($EventArgs.Button.ToString())
+    [Console]::Out.Flush()
+}
+
+$stdin = [Console]::In
+while ($true) {
+    # Reading asynchronously and sleeping in between lets PowerShell run the
+    # ButtonPressed handler while waiting for the next update.
+    $read = $stdin.ReadLineAsync()
+    while (-not $read.IsCompleted) {
+        Start-Sleep -Milliseconds 100
+    }
+    $line = $read.Result
+    if ($null -eq $line) {
+        break
+    }
+
+    $update = $line | ConvertFrom-Json
+    if ($update.status -eq "stopped") {
+        $smtc.PlaybackStatus = [Windows.Media.MediaPlaybackStatus]::Stopped
+        $smtc.DisplayUpdater.ClearAll()
+        $smtc.DisplayUpdater.Update()
+        continue
+    }
+
+    $updater = $smtc.DisplayUpdater
+    $updater.Type = [Windows.Media.MediaPlaybackType]::Music
+    $updater.MusicProperties.Title = $update.title
+    $updater.MusicProperties.Artist = $update.artist
+    $updater.MusicProperties.AlbumTitle = $update.album
+    if ($update.artwork) {
+        $updater.Thumbnail = [Windows.Storage.Streams.RandomAccessStreamReference]::CreateFromUri([Uri]$update.artwork)
+    } else {
+        $updater.Thumbnail = $null
+    }
+    $updater.Update()
+
+    if ($update.status -eq "playing") {
+        $smtc.PlaybackStatus = [Windows.Media.MediaPlaybackStatus]::Playing
+    } else {
+        $smtc.PlaybackStatus = [Windows.Media.MediaPlaybackStatus]::Paused
+    }
+}
@@ -0,0 +1,138 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build windows
+
+package lyrarpc
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The System Media Transport Controls are a WinRT API, which PowerShell can
+// reach without cgo, so a small helper script does the talking.
+//
+//go:embed smtc/helper.ps1
+var smtcHelper []byte
+
+// smtcUpdate is one line sent to the helper.
+type smtcUpdate struct {
+	Status  string `json:"status"`
+	Title   string `json:"title,omitempty"`
+	Artist  string `json:"artist,omitempty"`
+	Album   string `json:"album,omitempty"`
+	Artwork string `json:"artwork,omitempty"`
+}
+
+type smtcSink struct {
+	stdin io.WriteCloser
+	last  smtcUpdate
+
+	mu         sync.Mutex
+	playbackID int64
+}
+
+func startMediaControls() (sink, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	script := filepath.Join(dir, "smtc-helper.ps1")
+	if err := os.WriteFile(script, smtcHelper, 0o644); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", script)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	s := &smtcSink{stdin: stdin}
+	go s.readButtons(stdout)
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("Media controls helper exited: %v", err)
+		}
+	}()
+
+	log.Println("Publishing playback to the Windows media controls")
+	return s, nil
+}
+
+func (s *smtcSink) update(np *NowPlaying) {
+	update := smtcUpdate{Status: "stopped"}
+	var playbackID int64
+	if np != nil {
+		data := newTemplateData(np)
+		update = smtcUpdate{
+			Status:  data.State,
+			Title:   data.Title,
+			Artist:  data.Artist,
+			Album:   data.Album,
+			Artwork: data.ImageURL,
+		}
+		playbackID = np.Playback.PlaybackID
+	}
+
+	s.mu.Lock()
+	s.playbackID = playbackID
+	s.mu.Unlock()
+
+	if update == s.last {
+		return
+	}
+	s.last = update
+
+	line, err := json.Marshal(update)
+	if err != nil {
+		return
+	}
+	if _, err := s.stdin.Write(append(line, '\n')); err != nil {
+		log.Printf("Error updating media controls: %v", err)
+	}
+}
+
+// readButtons forwards media key presses reported by the helper to Lyra.
+func (s *smtcSink) readButtons(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		command := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		switch command {
+		case "play", "pause", "stop", "next", "previous":
+		default:
+			continue
+		}
+
+		s.mu.Lock()
+		playbackID := s.playbackID
+		s.mu.Unlock()
+		if playbackID == 0 {
+			continue
+		}
+		if err := lyraClient.Load().SendCommand(playbackID, command); err != nil {
+			log.Printf("Error sending %s to Lyra: %v", command, err)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"lyra-rpc/pkg/lyra"
+)
+
+// snapshotMaxAge is how old a snapshot may be and still be restored. Past
+// that, whatever was playing has likely moved on.
+const snapshotMaxAge = 5 * time.Minute
+
+// snapshot is what the outputs were last shown, saved so a restart can put
+// it back before the first poll.
+type snapshot struct {
+	BaseURL     string         `json:"base_url"`
+	Playback    *lyra.Playback `json:"playback"`
+	Track       *lyra.Track    `json:"track"`
+	Image       string         `json:"image"`
+	ArtistImage string         `json:"artist_image"`
+	LyricsURL   string         `json:"lyrics_url"`
+	SpotifyURL  string         `json:"spotify_url"`
+	SavedAt     time.Time      `json:"saved_at"`
+}
+
+func snapshotPath() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "state.json"), nil
+}
+
+// key changes whenever the snapshot would restore to something different:
+// another track, state, or artwork, or a seek.
+func (s *snapshot) key() string {
+	p := s.Playback
+	position := p.PositionMs
+	if p.State == "playing" {
+		// Where the track started, to the second, moves only on a seek.
+		position = (p.UpdatedAtMs - p.PositionMs) / 1000
+	}
+	return fmt.Sprintf("%s/%d/%s/%d/%s/%s", s.BaseURL, p.TrackID, p.State, position, s.Image, s.ArtistImage)
+}
+
+func saveSnapshot(s *snapshot) error {
+	path, err := snapshotPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadSnapshot returns the saved snapshot, or nil if there's none or it's
+// too old to restore.
+func loadSnapshot() (*snapshot, error) {
+	path, err := snapshotPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if s.Playback == nil || s.Track == nil || time.Since(s.SavedAt) > snapshotMaxAge {
+		return nil, nil
+	}
+	// A track that would have ended by now isn't worth showing.
+	p := s.Playback
+	if p.State == "playing" && p.DurationMs != nil && p.EffectivePositionMs() >= *p.DurationMs {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+func removeSnapshot() {
+	path, err := snapshotPath()
+	if err != nil {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing %s: %v", path, err)
+	}
+}
+
+// snapshot saves what np shows, if it changed since the last save.
+func (e *Engine) snapshot(np *NowPlaying) {
+	if !config.RestoreState {
+		return
+	}
+	s := &snapshot{
+		BaseURL:     lyraClient.Load().BaseURL,
+		Playback:    np.Playback,
+		Track:       np.Track,
+		Image:       np.Image,
+		ArtistImage: np.ArtistImage,
+		LyricsURL:   np.LyricsURL,
+		SpotifyURL:  np.SpotifyURL,
+		SavedAt:     time.Now(),
+	}
+	key := s.key()
+	if key == e.snapshotKey {
+		return
+	}
+	if err := saveSnapshot(s); err != nil {
+		log.Printf("Error saving state: %v", err)
+		return
+	}
+	e.snapshotKey = key
+}
+
+// forgetSnapshot removes the saved snapshot once nothing is playing, so a
+// later start doesn't bring back a stale presence.
+func (e *Engine) forgetSnapshot() {
+	if !config.RestoreState || e.snapshotKey == "-" {
+		return
+	}
+	removeSnapshot()
+	e.snapshotKey = "-"
+}
+
+// restore shows the saved snapshot, if there's a recent one from a
+// configured server, without waiting for the first poll. The outputs are
+// updated as usual, but no events fire and nothing is scrobbled until the
+// first poll confirms the playback.
+func (e *Engine) restore() {
+	if !config.RestoreState || e.opts.Source != nil {
+		return
+	}
+	s, err := loadSnapshot()
+	if err != nil {
+		log.Printf("Error loading state: %v", err)
+		return
+	}
+	if s == nil {
+		return
+	}
+	var client *lyra.Client
+	for _, c := range lyraServers {
+		if c.BaseURL == s.BaseURL {
+			client = c
+			break
+		}
+	}
+	if client == nil {
+		return
+	}
+
+	lyraClient.Store(client)
+	e.cachedTrack = s.Track
+	e.cachedImage = s.Image
+	e.cachedArtistImage = s.ArtistImage
+	e.cachedLyricsURL = s.LyricsURL
+	e.cachedSpotifyURL = s.SpotifyURL
+	e.lastTrackID = s.Playback.TrackID
+	e.lastState = s.Playback.State
+	e.snapshotKey = s.key()
+
+	log.Print(tr("Restored %s from the last run.", trackLabel(s.Track)))
+	presenceState.setTrack(trackLabel(s.Track))
+	e.publish(&NowPlaying{Playback: s.Playback, Track: s.Track, Image: s.Image, ArtistImage: s.ArtistImage, LyricsURL: s.LyricsURL, SpotifyURL: s.SpotifyURL})
+}
@@ -0,0 +1,177 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"lyra-rpc/pkg/lyra"
+	"lyra-rpc/pkg/presence"
+)
+
+// SpotifyButtonConfig adds a button to the presence linking to what's
+// playing on Spotify.
+type SpotifyButtonConfig struct {
+	Enabled bool   `json:"enabled"`
+	Label   string `json:"label"`
+	// ClientID and ClientSecret are a Spotify app's credentials. With
+	// them, the button links straight to the track; without them, to a
+	// Spotify search.
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// URL replaces the search link. It's a template whose fields are
+	// URL-escaped already.
+	URL string `json:"url"`
+}
+
+// spotifyMissTTL is how long a search that found no track is remembered.
+const spotifyMissTTL = 24 * time.Hour
+
+// spotifyToken is the client-credentials access token, shared until it
+// expires.
+var spotifyToken struct {
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// resolveSpotifyURL returns the link for the Spotify button, or an empty
+// string if it's disabled.
+func resolveSpotifyURL(track *lyra.Track) string {
+	c := config.SpotifyButton
+	if !c.Enabled {
+		return ""
+	}
+
+	search := "https://open.spotify.com/search/" + url.PathEscape(strings.TrimSpace(artistNames(track)+" "+track.Title))
+	if c.URL != "" {
+		data := presence.QueryEscaped(presence.NewData(&lyra.Playback{}, track, ""))
+		link, err := presence.Render(c.URL, data)
+		if err != nil {
+			log.Printf("Error rendering Spotify URL: %v", err)
+			return ""
+		}
+		search = link
+	}
+	if c.ClientID == "" || c.ClientSecret == "" {
+		return search
+	}
+
+	key := lyraImageKey("spotify", track.DbID)
+	if link, ok := cache.image(key); ok {
+		return link
+	}
+	link, err := searchSpotify(c, track)
+	if err != nil {
+		log.Printf("Error searching Spotify: %v", err)
+		return search
+	}
+	if link == "" {
+		cache.setImage(key, search, spotifyMissTTL)
+		return search
+	}
+	cache.setImage(key, link, 0)
+	return link
+}
+
+// searchSpotify returns the Spotify page of the best match for track, or
+// an empty string if there's none.
+func searchSpotify(c SpotifyButtonConfig, track *lyra.Track) (string, error) {
+	token, err := spotifyAccessToken(c)
+	if err != nil {
+		return "", err
+	}
+
+	q := fmt.Sprintf("track:%s", track.Title)
+	if len(track.Artists) > 0 {
+		q += fmt.Sprintf(" artist:%s", track.Artists[0].ArtistName)
+	}
+	query := url.Values{}
+	query.Set("q", q)
+	query.Set("type", "track")
+	query.Set("limit", "1")
+	req, err := http.NewRequest("GET", "https://api.spotify.com/v1/search?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := defaultHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		// The token was revoked early; fetch a new one next time.
+		spotifyToken.mu.Lock()
+		spotifyToken.token = ""
+		spotifyToken.mu.Unlock()
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &statusError{api: "Spotify", status: resp.StatusCode}
+	}
+
+	var result struct {
+		Tracks struct {
+			Items []struct {
+				ExternalURLs struct {
+					Spotify string `json:"spotify"`
+				} `json:"external_urls"`
+			} `json:"items"`
+		} `json:"tracks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if len(result.Tracks.Items) == 0 {
+		return "", nil
+	}
+	return result.Tracks.Items[0].ExternalURLs.Spotify, nil
+}
+
+// spotifyAccessToken returns a client-credentials token, requesting a new
+// one once the last has expired.
+func spotifyAccessToken(c SpotifyButtonConfig) (string, error) {
+	spotifyToken.mu.Lock()
+	defer spotifyToken.mu.Unlock()
+	if spotifyToken.token != "" && time.Now().Before(spotifyToken.expires) {
+		return spotifyToken.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequest("POST", "https://accounts.spotify.com/api/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.ClientID, c.ClientSecret)
+	resp, err := defaultHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &statusError{api: "Spotify token", status: resp.StatusCode}
+	}
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	spotifyToken.token = result.AccessToken
+	// Renew a minute early so a token never expires mid-request.
+	spotifyToken.expires = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - time.Minute)
+	return spotifyToken.token, nil
+}
@@ -0,0 +1,165 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// statsRanges maps the ranges accepted by `lyra-rpc stats` to how far back
+// they reach. Zero means all time.
+var statsRanges = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"all":   0,
+}
+
+type historyStats struct {
+	Range      string      `json:"range"`
+	Listens    int64       `json:"listens"`
+	ListenedMs int64       `json:"listened_ms"`
+	TopArtists []statsItem `json:"top_artists"`
+	TopAlbums  []statsItem `json:"top_albums"`
+	TopTracks  []statsItem `json:"top_tracks"`
+}
+
+type statsItem struct {
+	Name       string `json:"name"`
+	Artist     string `json:"artist,omitempty"`
+	Listens    int64  `json:"listens"`
+	ListenedMs int64  `json:"listened_ms"`
+}
+
+func runStatsCommand(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	rangeName := fs.String("range", "week", "day, week, month, or all")
+	limit := fs.Int("limit", 10, "how many top artists, albums, and tracks to show")
+	asJSON := fs.Bool("json", false, "print JSON instead of tables")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	window, ok := statsRanges[*rangeName]
+	if !ok {
+		return fmt.Errorf("unknown range %q; use day, week, month, or all", *rangeName)
+	}
+
+	db, err := openHistory()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var since time.Time
+	if window > 0 {
+		since = time.Now().Add(-window)
+	}
+	stats, err := queryHistoryStats(db, since, *limit)
+	if err != nil {
+		return err
+	}
+	stats.Range = *rangeName
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+
+	fmt.Printf("%d listens, %s listened\n", stats.Listens, formatListened(stats.ListenedMs))
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, section := range []struct {
+		title string
+		items []statsItem
+	}{
+		{"ARTIST", stats.TopArtists},
+		{"ALBUM", stats.TopAlbums},
+		{"TRACK", stats.TopTracks},
+	} {
+		fmt.Fprintf(w, "\n%s\tLISTENS\tTIME\n", section.title)
+		for _, item := range section.items {
+			name := item.Name
+			if item.Artist != "" {
+				name += " – " + item.Artist
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\n", name, item.Listens, formatListened(item.ListenedMs))
+		}
+	}
+	return w.Flush()
+}
+
+// formatListened formats a total listening time as hours and minutes.
+func formatListened(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+func queryHistoryStats(db *sql.DB, since time.Time, limit int) (historyStats, error) {
+	var stats historyStats
+	sinceMs := int64(0)
+	if !since.IsZero() {
+		sinceMs = since.UnixMilli()
+	}
+
+	err := db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(listened_ms), 0) FROM listens WHERE started_at >= ?`, sinceMs).
+		Scan(&stats.Listens, &stats.ListenedMs)
+	if err != nil {
+		return stats, err
+	}
+
+	// Listens with several artists count towards each of them.
+	stats.TopArtists, err = queryStatsItems(db, `
+		SELECT artist.value, '', COUNT(*), SUM(listened_ms)
+		FROM listens, json_each(listens.artists) AS artist
+		WHERE started_at >= ?
+		GROUP BY artist.value
+		ORDER BY COUNT(*) DESC, SUM(listened_ms) DESC
+		LIMIT ?`, sinceMs, limit)
+	if err != nil {
+		return stats, err
+	}
+	stats.TopAlbums, err = queryStatsItems(db, `
+		SELECT album, COALESCE(json_extract(artists, '$[0]'), ''), COUNT(*), SUM(listened_ms)
+		FROM listens
+		WHERE started_at >= ? AND album != ''
+		GROUP BY album_id
+		ORDER BY COUNT(*) DESC, SUM(listened_ms) DESC
+		LIMIT ?`, sinceMs, limit)
+	if err != nil {
+		return stats, err
+	}
+	stats.TopTracks, err = queryStatsItems(db, `
+		SELECT title, COALESCE(json_extract(artists, '$[0]'), ''), COUNT(*), SUM(listened_ms)
+		FROM listens
+		WHERE started_at >= ?
+		GROUP BY track_id
+		ORDER BY COUNT(*) DESC, SUM(listened_ms) DESC
+		LIMIT ?`, sinceMs, limit)
+	return stats, err
+}
+
+func queryStatsItems(db *sql.DB, query string, args ...any) ([]statsItem, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []statsItem{}
+	for rows.Next() {
+		var item statsItem
+		if err := rows.Scan(&item.Name, &item.Artist, &item.Listens, &item.ListenedMs); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
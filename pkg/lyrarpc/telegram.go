@@ -0,0 +1,221 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"lyra-rpc/pkg/lyra"
+	"lyra-rpc/pkg/presence"
+	"lyra-rpc/pkg/uploader"
+)
+
+type TelegramConfig struct {
+	Enabled  bool   `json:"enabled"`
+	BotToken string `json:"bot_token"`
+	// ChatID is a numeric chat ID or a channel's @username.
+	ChatID   string `json:"chat_id"`
+	Template string `json:"template"`
+	// Edit keeps a single message up to date instead of sending one per
+	// track. MessageID reuses an existing message; Pin pins the message
+	// once it's sent.
+	Edit      bool  `json:"edit"`
+	MessageID int64 `json:"message_id"`
+	Pin       bool  `json:"pin"`
+	// MinPlayingSec is how long a track must play before it's sent.
+	MinPlayingSec int `json:"min_playing_sec"`
+	// MinIntervalSec is the shortest time between two messages or edits.
+	MinIntervalSec int `json:"min_interval_sec"`
+	// AttachArtwork sends the album cover with the message.
+	AttachArtwork bool `json:"attach_artwork"`
+}
+
+type telegramSink struct {
+	config TelegramConfig
+	client *http.Client
+
+	timer    playTimer
+	posted   bool
+	lastPost time.Time
+	pending  chan presence.Data
+
+	messageID int64
+	// photo is whether the message being edited has a photo, which
+	// decides how it can be edited.
+	photo bool
+}
+
+func newTelegramSink(c TelegramConfig) *telegramSink {
+	s := &telegramSink{
+		config:    c,
+		client:    newHTTPClient(30 * time.Second),
+		pending:   make(chan presence.Data, 1),
+		messageID: c.MessageID,
+		photo:     c.AttachArtwork,
+	}
+	go s.run()
+	return s
+}
+
+func (s *telegramSink) update(np *NowPlaying) {
+	if s.timer.update(np) {
+		s.posted = false
+	}
+	if np == nil || s.posted {
+		return
+	}
+	if s.timer.playedFor < time.Duration(s.config.MinPlayingSec)*time.Second {
+		return
+	}
+	if time.Since(s.lastPost) < time.Duration(s.config.MinIntervalSec)*time.Second {
+		return
+	}
+
+	s.posted = true
+	s.lastPost = time.Now()
+	// Only the newest track matters if sending falls behind.
+	select {
+	case <-s.pending:
+	default:
+	}
+	s.pending <- newTemplateData(np)
+}
+
+func (s *telegramSink) stop() {
+	close(s.pending)
+}
+
+func (s *telegramSink) run() {
+	for data := range s.pending {
+		if err := s.send(data); err != nil {
+			log.Printf("Error sending to Telegram: %v", err)
+		}
+	}
+}
+
+func (s *telegramSink) send(data presence.Data) error {
+	text, err := presence.Render(s.config.Template, data)
+	if err != nil {
+		return err
+	}
+
+	var cover []byte
+	if s.config.AttachArtwork && data.AlbumID != 0 {
+		cover, err = fetchLyraImage(lyra.AlbumCoverPath(data.AlbumID))
+		if err != nil {
+			log.Printf("Error fetching artwork for Telegram: %v", err)
+		}
+	}
+
+	fields := map[string]string{"chat_id": s.config.ChatID}
+	files := map[string][]byte{}
+	var method string
+	switch {
+	case s.config.Edit && s.messageID != 0 && s.photo && cover != nil:
+		method = "editMessageMedia"
+		fields["message_id"] = strconv.FormatInt(s.messageID, 10)
+		media, _ := json.Marshal(map[string]string{"type": "photo", "media": "attach://cover", "caption": text})
+		fields["media"] = string(media)
+		files["cover"] = cover
+	case s.config.Edit && s.messageID != 0 && s.photo:
+		method = "editMessageCaption"
+		fields["message_id"] = strconv.FormatInt(s.messageID, 10)
+		fields["caption"] = text
+	case s.config.Edit && s.messageID != 0:
+		method = "editMessageText"
+		fields["message_id"] = strconv.FormatInt(s.messageID, 10)
+		fields["text"] = text
+	case cover != nil:
+		method = "sendPhoto"
+		fields["caption"] = text
+		files["photo"] = cover
+	default:
+		method = "sendMessage"
+		fields["text"] = text
+	}
+
+	var message struct {
+		MessageID int64 `json:"message_id"`
+	}
+	if err := s.call(method, fields, files, &message); err != nil {
+		return err
+	}
+
+	if s.config.Edit && s.messageID == 0 {
+		s.messageID = message.MessageID
+		s.photo = method == "sendPhoto"
+		if s.config.Pin {
+			fields := map[string]string{
+				"chat_id":              s.config.ChatID,
+				"message_id":           strconv.FormatInt(s.messageID, 10),
+				"disable_notification": "true",
+			}
+			if err := s.call("pinChatMessage", fields, nil, nil); err != nil {
+				log.Printf("Error pinning Telegram message: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// call invokes a Bot API method, uploading files as multipart form data.
+func (s *telegramSink) call(method string, fields map[string]string, files map[string][]byte, result any) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	for name, data := range files {
+		part, err := writer.CreateFormFile(name, name+"."+uploader.DetectFormat(data).Ext)
+		if err != nil {
+			return err
+		}
+		part.Write(data)
+	}
+	writer.Close()
+
+	endpoint := "https://api.telegram.org/bot" + s.config.BotToken + "/" + method
+	resp, err := s.client.Post(endpoint, writer.FormDataContentType(), &body)
+	if err != nil {
+		// The error names the URL, which has the token in it.
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			uerr.URL = strings.ReplaceAll(uerr.URL, s.config.BotToken, "[redacted]")
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return &statusError{api: "telegram " + method, status: resp.StatusCode}
+	}
+	if !reply.OK {
+		return fmt.Errorf("telegram %s: %s", method, reply.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(reply.Result, result)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"time"
+
+	"lyra-rpc/pkg/lyra"
+)
+
+// trackEndChecks are when, after the current track is due to end, the
+// engine checks for the next one with poll_at_track_end on. Lyra can take
+// a moment to move on, so there's a second, later check.
+var trackEndChecks = []time.Duration{250 * time.Millisecond, 1500 * time.Millisecond}
+
+// scheduleTrackEnd arranges for playback to be checked right as the
+// current track ends, instead of up to a poll interval later, if
+// poll_at_track_end is on. Only the end of a track is sped up this way:
+// Lyra has no way to push changes, so pauses, seeks, and skips still wait
+// for the next poll.
+func (e *Engine) scheduleTrackEnd(playback *lyra.Playback) {
+	for _, t := range e.trackEndTimers {
+		t.Stop()
+	}
+	e.trackEndTimers = e.trackEndTimers[:0]
+	if !config.PollAtTrackEnd || playback == nil || playback.State != "playing" || playback.DurationMs == nil {
+		return
+	}
+
+	remaining := time.Duration(*playback.DurationMs-playback.EffectivePositionMs()) * time.Millisecond
+	for _, after := range trackEndChecks {
+		e.trackEndTimers = append(e.trackEndTimers, time.AfterFunc(max(remaining, 0)+after, presenceState.poke))
+	}
+}
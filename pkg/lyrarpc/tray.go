@@ -0,0 +1,144 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !darwin || cgo
+
+package lyrarpc
+
+import (
+	_ "embed"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"fyne.io/systray"
+)
+
+//go:embed tray/icon.png
+var trayIconPNG []byte
+
+//go:embed tray/icon.ico
+var trayIconICO []byte
+
+// runTray shows the tray icon and runs loop alongside it. The tray has to
+// own the main thread on some platforms, so it returns once loop does.
+func runTray(loop func()) {
+	systray.Run(func() {
+		if runtime.GOOS == "windows" {
+			systray.SetIcon(trayIconICO)
+		} else {
+			systray.SetIcon(trayIconPNG)
+		}
+		systray.SetTooltip("lyra-rpc")
+
+		status := systray.AddMenuItem(tr("Starting…"), "")
+		status.Disable()
+		systray.AddSeparator()
+		pause := systray.AddMenuItemCheckbox(tr("Pause presence"), tr("Hide the Discord presence"), false)
+		private := systray.AddMenuItemCheckbox(tr("Private session"), tr("Stop broadcasting and scrobbling"), false)
+		systray.AddSeparator()
+		openConfig := systray.AddMenuItem(tr("Open config"), tr("Open config.json in an editor"))
+		quit := systray.AddMenuItem(tr("Quit"), "")
+
+		go func() {
+			loop()
+			systray.Quit()
+		}()
+
+		go func() {
+			ticker := time.NewTicker(2 * time.Second)
+			defer ticker.Stop()
+			var shown string
+			for {
+				s := presenceState.status()
+				if text := trayStatus(s); text != shown {
+					shown = text
+					status.SetTitle(text)
+					systray.SetTooltip("lyra-rpc: " + text)
+				}
+				setChecked(pause, s.Paused)
+				setChecked(private, s.Private)
+
+				select {
+				case <-ticker.C:
+				case <-pause.ClickedCh:
+					presenceState.setPaused(!pause.Checked())
+				case <-private.ClickedCh:
+					if private.Checked() {
+						presenceState.endPrivate()
+					} else {
+						presenceState.setPrivate(0)
+					}
+				case <-openConfig.ClickedCh:
+					if err := openConfigFile(); err != nil {
+						log.Printf("Error opening config: %v", err)
+					}
+				case <-quit.ClickedCh:
+					presenceState.requestQuit()
+					return
+				}
+			}
+		}()
+	}, nil)
+}
+
+func setChecked(item *systray.MenuItem, checked bool) {
+	if item.Checked() == checked {
+		return
+	}
+	if checked {
+		item.Check()
+	} else {
+		item.Uncheck()
+	}
+}
+
+func trayStatus(s controlStatus) string {
+	switch {
+	case s.LyraError != "":
+		return tr("Can't reach Lyra")
+	case s.DiscordError != "":
+		return tr("Can't reach Discord")
+	case s.Private:
+		return tr("Private session")
+	case s.Track == "":
+		return tr("Nothing playing")
+	case s.Paused, s.Away:
+		return tr("Paused: %s", s.Track)
+	}
+	return s.Track
+}
+
+// openConfigFile opens config.json with the system's default editor,
+// creating an empty one first if needed.
+func openConfigFile() error {
+	path, err := filepath.Abs("config.json")
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.WriteFile(path, []byte("{}\n"), 0o644); err != nil {
+			return err
+		}
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", path)
+	case "darwin":
+		cmd = exec.Command("open", "-t", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%s: %w", cmd.Path, err)
+	}
+	go cmd.Wait()
+	return nil
+}
@@ -0,0 +1,14 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build darwin && !cgo
+
+package lyrarpc
+
+import "log"
+
+func runTray(loop func()) {
+	log.Println("The tray icon needs a build with cgo enabled on macOS.")
+	loop()
+}
@@ -0,0 +1,177 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// tuiLogLines is how many recent log lines the dashboard keeps.
+const tuiLogLines = 8
+
+// tuiSink keeps the latest snapshot and log lines for the dashboard.
+type tuiSink struct {
+	mu   sync.Mutex
+	np   *NowPlaying
+	logs []string
+}
+
+func (s *tuiSink) update(np *NowPlaying) {
+	s.mu.Lock()
+	s.np = np
+	s.mu.Unlock()
+}
+
+// Write collects log output, which would otherwise scribble over the
+// dashboard.
+func (s *tuiSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		s.logs = append(s.logs, line)
+	}
+	if len(s.logs) > tuiLogLines {
+		s.logs = s.logs[len(s.logs)-tuiLogLines:]
+	}
+	return len(p), nil
+}
+
+// runTUI shows the dashboard and runs loop alongside it, returning once
+// either is done.
+func runTUI(s *tuiSink, loop func()) {
+	log.SetOutput(teeCrashLog(s))
+	log.SetFlags(log.Ltime)
+
+	p := tea.NewProgram(tuiModel{sink: s}, tea.WithAltScreen())
+	done := make(chan struct{})
+	go func() {
+		loop()
+		close(done)
+		p.Quit()
+	}()
+	if _, err := p.Run(); err != nil {
+		fmt.Printf("Error running dashboard: %v\n", err)
+	}
+	presenceState.requestQuit()
+	<-done
+}
+
+type tuiTick struct{}
+
+func tuiTickCmd() tea.Cmd {
+	return tea.Tick(500*time.Millisecond, func(time.Time) tea.Msg { return tuiTick{} })
+}
+
+type tuiModel struct {
+	sink  *tuiSink
+	width int
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return tuiTickCmd()
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+	case tuiTick:
+		return m, tuiTickCmd()
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "p":
+			presenceState.setPaused(!presenceState.isPaused())
+		case "s":
+			if presenceState.isPrivate() {
+				presenceState.endPrivate()
+			} else {
+				presenceState.setPrivate(0)
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m tuiModel) View() string {
+	status := presenceState.status()
+	m.sink.mu.Lock()
+	np := m.sink.np
+	logs := append([]string(nil), m.sink.logs...)
+	m.sink.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("lyra-rpc\n\n")
+
+	lyra, discord := tr("connected"), tr("connected")
+	if status.LyraError != "" {
+		lyra = tr("error: %s", status.LyraError)
+	}
+	if status.DiscordError != "" {
+		discord = tr("error: %s", status.DiscordError)
+	}
+	fmt.Fprintf(&b, "Lyra: %s\nDiscord: %s\n", lyra, discord)
+	if status.Paused {
+		b.WriteString(tr("Presence paused") + "\n")
+	} else if status.Away {
+		b.WriteString(tr("Away, presence hidden") + "\n")
+	}
+	if status.Private {
+		b.WriteString(tr("Private session"))
+		if !status.PrivateUntil.IsZero() {
+			b.WriteString(tr(" until %s", status.PrivateUntil.Local().Format(time.Kitchen)))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	if np == nil {
+		b.WriteString("  " + tr("Nothing playing") + "\n")
+	} else {
+		data := newTemplateData(np)
+		icon := "▶"
+		if data.State != "playing" {
+			icon = "⏸"
+		}
+		fmt.Fprintf(&b, "  %s %s\n", icon, data.Title)
+		artist := data.Artist
+		if data.Album != "" {
+			artist += " — " + data.Album
+		}
+		fmt.Fprintf(&b, "    %s\n", artist)
+		if data.DurationMs > 0 {
+			fmt.Fprintf(&b, "    %s %s %s\n", data.Position, progressBar(data.PositionMs, data.DurationMs, m.barWidth()), data.Duration)
+		} else {
+			fmt.Fprintf(&b, "    %s\n", data.Position)
+		}
+	}
+
+	b.WriteString("\n" + tr("Recent log") + "\n")
+	for _, line := range logs {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+	b.WriteString("\n" + tr("p pause presence · s private session · q quit") + "\n")
+	return b.String()
+}
+
+func (m tuiModel) barWidth() int {
+	if m.width <= 0 {
+		return 30
+	}
+	return max(10, min(60, m.width-24))
+}
+
+func progressBar(positionMs, durationMs int64, width int) string {
+	filled := int(positionMs * int64(width) / durationMs)
+	filled = max(0, min(width, filled))
+	return strings.Repeat("━", filled) + strings.Repeat("─", width-filled)
+}
@@ -0,0 +1,252 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version is the release this binary was built from, set at build time
+// with -ldflags "-X lyra-rpc/pkg/lyrarpc.version=v1.2.3".
+var version = "dev"
+
+// updateDisabled, if set at build time, turns `lyra-rpc update` off and is
+// shown instead, for packages whose binary is updated by a package manager:
+// -ldflags "-X 'lyra-rpc/pkg/lyrarpc.updateDisabled=Update lyra-rpc with apt.'"
+var updateDisabled = ""
+
+const releasesURL = "https://api.github.com/repos/StayBlue/lyra-rpc/releases/latest"
+
+// maxUpdateBytes caps how much of a release asset is downloaded.
+const maxUpdateBytes = 200 << 20
+
+type release struct {
+	TagName string         `json:"tag_name"`
+	HTMLURL string         `json:"html_url"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+func (r *release) asset(name string) (releaseAsset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return releaseAsset{}, false
+}
+
+// releaseAssetName is the binary a release provides for this platform.
+func releaseAssetName() string {
+	name := fmt.Sprintf("lyra-rpc_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// runUpdateCommand replaces the running binary with the latest release, once
+// its checksum matches the one published alongside it.
+func runUpdateCommand(args []string) error {
+	fs := flag.NewFlagSet("update", flag.ContinueOnError)
+	checkOnly := fs.Bool("check-only", false, "only report whether an update is available")
+	force := fs.Bool("force", false, "update even from a development build or to the same version")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if updateDisabled != "" {
+		return errors.New(updateDisabled)
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		return fmt.Errorf("locating lyra-rpc: %w", err)
+	}
+	// Left behind by an update on Windows, where the running binary can be
+	// renamed but not removed.
+	os.Remove(exe + ".old")
+
+	client := newHTTPClient(5 * time.Minute)
+	var latest release
+	if err := getJSON(client, releasesURL, &latest); err != nil {
+		return fmt.Errorf("checking for updates: %w", err)
+	}
+
+	switch {
+	case version == "dev" && !*force:
+		fmt.Printf("This is a development build. The latest release is %s: %s\n", latest.TagName, latest.HTMLURL)
+		if !*checkOnly {
+			fmt.Println("Run with --force to replace it anyway.")
+		}
+		return nil
+	case compareVersions(latest.TagName, version) <= 0 && !*force:
+		fmt.Printf("lyra-rpc %s is up to date.\n", version)
+		return nil
+	}
+	fmt.Printf("lyra-rpc %s is available (this is %s): %s\n", latest.TagName, version, latest.HTMLURL)
+	if *checkOnly {
+		return nil
+	}
+
+	name := releaseAssetName()
+	asset, ok := latest.asset(name)
+	if !ok {
+		return fmt.Errorf("release %s has no build for %s/%s", latest.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+	sums, ok := latest.asset("checksums.txt")
+	if !ok {
+		return fmt.Errorf("release %s has no checksums.txt to verify the download with", latest.TagName)
+	}
+
+	sumsData, err := download(client, sums.URL)
+	if err != nil {
+		return fmt.Errorf("downloading checksums: %w", err)
+	}
+	want, err := findChecksum(sumsData, name)
+	if err != nil {
+		return err
+	}
+	binary, err := download(client, asset.URL)
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", name, err)
+	}
+	got := sha256.Sum256(binary)
+	if hex.EncodeToString(got[:]) != want {
+		return fmt.Errorf("checksum mismatch for %s; not updating", name)
+	}
+
+	if err := replaceExecutable(exe, binary); err != nil {
+		return fmt.Errorf("replacing %s: %w", exe, err)
+	}
+	log.Printf("Updated to %s. Restart lyra-rpc to use it.", latest.TagName)
+	return nil
+}
+
+func getJSON(client *http.Client, url string, v any) error {
+	data, err := download(client, url)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func download(client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "lyra-rpc (https://github.com/StayBlue/lyra-rpc)")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxUpdateBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxUpdateBytes {
+		return nil, fmt.Errorf("GET %s: response too large", url)
+	}
+	return data, nil
+}
+
+// findChecksum looks name up in a sha256sum-style checksums file.
+func findChecksum(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("checksums.txt has no checksum for %s", name)
+}
+
+// replaceExecutable swaps exe for binary by renaming a copy written next to
+// it, so an interrupted update never leaves a half-written binary behind.
+func replaceExecutable(exe string, binary []byte) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".lyra-rpc-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "windows" {
+		// Windows won't replace a running binary, but will rename it.
+		if err := os.Rename(exe, exe+".old"); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp.Name(), exe); err != nil {
+			os.Rename(exe+".old", exe)
+			return err
+		}
+		return nil
+	}
+	return os.Rename(tmp.Name(), exe)
+}
+
+// compareVersions compares two versions like v1.2.3, numerically by
+// component, returning -1, 0, or 1. Pre-release suffixes are ignored.
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := range max(len(as), len(bs)) {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(strings.SplitN(as[i], "-", 2)[0])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(strings.SplitN(bs[i], "-", 2)[0])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
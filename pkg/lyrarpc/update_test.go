@@ -0,0 +1,52 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "v1.2.3", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"v1.2.3", "v1.2.4", -1},
+		{"v1.10.0", "v1.9.0", 1},
+		{"v1.2", "v1.2.0", 0},
+		{"v1.2", "v1.2.1", -1},
+		{"v2.0.0-rc1", "v2.0.0", 0},
+		{"v2.0.0", "v1.99.99", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestFindChecksum(t *testing.T) {
+	sums := []byte(`ABC123  lyra-rpc_linux_amd64.tar.gz
+def456 *lyra-rpc_windows_amd64.zip
+not a checksum line
+789abc  lyra-rpc_darwin_arm64.tar.gz.sig
+`)
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"lyra-rpc_linux_amd64.tar.gz", "abc123", false},
+		{"lyra-rpc_windows_amd64.zip", "def456", false},
+		{"lyra-rpc_darwin_arm64.tar.gz", "", true},
+		{"missing", "", true},
+	}
+	for _, tt := range tests {
+		got, err := findChecksum(sums, tt.name)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("findChecksum(%q) = %q, %v, want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
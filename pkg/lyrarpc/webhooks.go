@@ -0,0 +1,123 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package lyrarpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"lyra-rpc/pkg/presence"
+)
+
+type WebhookConfig struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	// Events limits which events are sent: any of track_change, pause,
+	// resume, and stop. Empty means all of them.
+	Events []string `json:"events"`
+	// Template is the request body. Empty sends the event and the template
+	// data as JSON; use {{json .Title}} to quote values in a custom one.
+	Template string `json:"template"`
+}
+
+// webhookData is what webhook templates can refer to: the usual template
+// data plus the event that fired.
+type webhookData struct {
+	Event string `json:"event"`
+	presence.Data
+}
+
+// legacyWebhookEvents maps the event names webhooks used before the event
+// bus to what they cover now, so older configs keep working.
+var legacyWebhookEvents = map[string][]eventType{
+	"track_change": {eventTrackStarted, eventTrackChanged},
+	"pause":        {eventPaused},
+	"resume":       {eventResumed},
+	"stop":         {eventStopped},
+}
+
+type webhookSender struct {
+	hooks []WebhookConfig
+	// events holds each hook's event filter with legacy names expanded;
+	// nil sends every event.
+	events [][]eventType
+	client *http.Client
+}
+
+func newWebhookSender(hooks []WebhookConfig) (*webhookSender, error) {
+	w := &webhookSender{hooks: hooks, client: newHTTPClient(15 * time.Second)}
+	for _, hook := range hooks {
+		if hook.URL == "" {
+			return nil, fmt.Errorf("webhook url is required")
+		}
+		var filter []eventType
+		for _, name := range hook.Events {
+			if legacy, ok := legacyWebhookEvents[name]; ok {
+				filter = append(filter, legacy...)
+			} else if slices.Contains(eventTypes, eventType(name)) {
+				filter = append(filter, eventType(name))
+			} else {
+				return nil, fmt.Errorf("unknown webhook event %q", name)
+			}
+		}
+		w.events = append(w.events, filter)
+	}
+	return w, nil
+}
+
+func (w *webhookSender) handle(e event) {
+	data := webhookData{Event: string(e.Type), Data: newTemplateData(e.NowPlaying)}
+	for i, hook := range w.hooks {
+		if w.events[i] != nil && !slices.Contains(w.events[i], e.Type) {
+			continue
+		}
+		go func() {
+			if err := w.send(hook, data); err != nil {
+				log.Printf("Error sending %s webhook to %s: %v", e.Type, hook.URL, err)
+			}
+		}()
+	}
+}
+
+func (w *webhookSender) send(hook WebhookConfig, data webhookData) error {
+	var body []byte
+	if hook.Template == "" {
+		var err error
+		if body, err = json.Marshal(data); err != nil {
+			return err
+		}
+	} else {
+		rendered, err := presence.Render(hook.Template, data)
+		if err != nil {
+			return err
+		}
+		body = []byte(rendered)
+	}
+
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range hook.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{api: "webhook", status: resp.StatusCode}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package presence
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"lyra-rpc/pkg/discord"
+	"lyra-rpc/pkg/lyra"
+)
+
+// PausedImage is the small image shown while playback is paused.
+const PausedImage = "https://files.catbox.moe/ibpq2d.png"
+
+// Templates holds the templates for the Discord presence's text.
+type Templates struct {
+	Details   string `json:"details"`
+	State     string `json:"state"`
+	LargeText string `json:"large_text"`
+	// PausedState and PausedText, if set, replace the state and the paused
+	// badge's tooltip while paused, e.g. to show where playback stopped
+	// now that the progress bar is gone.
+	PausedState string `json:"paused_state"`
+	PausedText  string `json:"paused_text"`
+	// LiveBadge marks streams with no set length, such as internet radio,
+	// as live in the playing badge's tooltip. LiveImage, if set, replaces
+	// the badge itself.
+	LiveBadge bool   `json:"live_badge"`
+	LiveImage string `json:"live_image"`
+	// UnknownTitle, UnknownArtist, and UnknownAlbum stand in for whatever
+	// a track is missing, for the templates to show. Empty leaves it
+	// blank, and a field that renders blank is left out.
+	UnknownTitle  string `json:"unknown_title"`
+	UnknownArtist string `json:"unknown_artist"`
+	UnknownAlbum  string `json:"unknown_album"`
+	// Buttons are links shown under the presence, such as a search on a
+	// streaming service. Discord shows at most two.
+	Buttons []Button `json:"buttons"`
+	// Labels translate the presence's fixed text. Empty labels are left
+	// in English.
+	Labels Labels `json:"-"`
+}
+
+// Labels are the fixed text shown on the playing and paused badges.
+type Labels struct {
+	Playing string
+	Paused  string
+	Live    string
+}
+
+// DefaultLabels are the English labels.
+var DefaultLabels = Labels{Playing: "Playing", Paused: "Paused", Live: "Live"}
+
+// Button is a link shown under the presence. URL is a template whose
+// fields are URL-escaped already, so "?q={{.Artist}}+{{.Title}}" works as
+// it is.
+type Button struct {
+	Label string `json:"label"`
+	URL   string `json:"url"`
+}
+
+// MaxButtons is how many buttons Discord shows; it rejects activities with
+// more.
+const MaxButtons = 2
+
+// DefaultTemplates show the title, then the album and year, with the artist
+// on hover.
+var DefaultTemplates = Templates{
+	Details:   "{{.Title}}",
+	State:     "{{.Album}}{{if .Year}} ({{.Year}}){{end}}",
+	LargeText: "{{.Artist}}",
+
+	UnknownTitle:  "Unknown Title",
+	UnknownArtist: "Unknown Artist",
+}
+
+// render renders one of the templates, logging and leaving the field empty
+// if it's broken. Surrounding whitespace is trimmed, so a field that only
+// rendered spaces is left out too.
+func (t Templates) render(field, text string, data Data) string {
+	out, err := Render(text, data)
+	if err != nil {
+		log.Printf("Error rendering presence %s: %v", field, err)
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// withFallbacks fills in the title, artist, and album if the track has
+// none.
+func (t Templates) withFallbacks(data Data) Data {
+	if strings.TrimSpace(data.Title) == "" {
+		data.Title = t.UnknownTitle
+	}
+	if data.Artist == "" && t.UnknownArtist != "" {
+		data.Artist = t.UnknownArtist
+		data.Artists = []string{t.UnknownArtist}
+	}
+	if strings.TrimSpace(data.Album) == "" {
+		data.Album = t.UnknownAlbum
+	}
+	return data
+}
+
+// QueryEscaped returns data with its text escaped for use in a URL.
+func QueryEscaped(data Data) Data {
+	data.Title = url.QueryEscape(data.Title)
+	data.Artist = url.QueryEscape(data.Artist)
+	data.Album = url.QueryEscape(data.Album)
+	artists := make([]string, len(data.Artists))
+	for i, a := range data.Artists {
+		artists[i] = url.QueryEscape(a)
+	}
+	data.Artists = artists
+	return data
+}
+
+// Activity builds the Discord activity for playback. image is the artwork
+// and artistImage the artist's picture; either may be empty.
+func (t Templates) Activity(playback *lyra.Playback, data Data, image, artistImage string) *discord.Activity {
+	labels := t.Labels
+	if labels.Playing == "" {
+		labels.Playing = DefaultLabels.Playing
+	}
+	if labels.Paused == "" {
+		labels.Paused = DefaultLabels.Paused
+	}
+	if labels.Live == "" {
+		labels.Live = DefaultLabels.Live
+	}
+	data = t.withFallbacks(data)
+
+	assets := &discord.Assets{
+		LargeImage: image,
+		LargeText:  t.render("large_text", t.LargeText, data),
+	}
+	activity := &discord.Activity{
+		Type:    discord.ActivityListening,
+		Details: t.render("details", t.Details, data),
+		State:   t.render("state", t.State, data),
+		Assets:  assets,
+	}
+
+	if playback.State == "playing" {
+		start := time.Now().Add(-time.Duration(playback.EffectivePositionMs()) * time.Millisecond)
+		activity.Timestamps = &discord.Timestamps{Start: start.UnixMilli()}
+		if playback.DurationMs != nil {
+			activity.Timestamps.End = start.Add(time.Duration(*playback.DurationMs) * time.Millisecond).UnixMilli()
+		}
+		assets.SmallImage = "playing"
+		assets.SmallText = labels.Playing
+		// With no length to count down to, Discord shows the time
+		// elapsed instead.
+		if data.Live && t.LiveBadge {
+			assets.SmallText = labels.Live
+			if t.LiveImage != "" {
+				assets.SmallImage = t.LiveImage
+			}
+		}
+	} else {
+		assets.SmallImage = PausedImage
+		assets.SmallText = labels.Paused
+		if t.PausedState != "" {
+			activity.State = t.render("paused_state", t.PausedState, data)
+		}
+		if t.PausedText != "" {
+			if text := t.render("paused_text", t.PausedText, data); text != "" {
+				assets.SmallText = text
+			}
+		}
+	}
+
+	escaped := QueryEscaped(data)
+	for _, b := range t.Buttons {
+		if len(activity.Buttons) == MaxButtons {
+			break
+		}
+		label := t.render("button label", b.Label, data)
+		link := t.render("button url", b.URL, escaped)
+		if label != "" && link != "" {
+			activity.Buttons = append(activity.Buttons, discord.Button{Label: label, URL: link})
+		}
+	}
+
+	// Discord shows a party's size after the state, as in "(3 of 3)".
+	if data.Listeners > 0 {
+		size := data.Listeners + 1
+		activity.Party = &discord.Party{ID: fmt.Sprintf("lyra-%d", data.AlbumID), Size: size, Max: size}
+	}
+
+	// The artist image replaces the playing/paused badge only while
+	// playing, so a paused presence still reads as paused at a glance.
+	if playback.State == "playing" && artistImage != "" && artistImage != image {
+		assets.SmallImage = artistImage
+		assets.SmallText = assets.LargeText
+	}
+	return activity
+}
@@ -0,0 +1,110 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package presence
+
+import (
+	"testing"
+
+	"lyra-rpc/pkg/lyra"
+)
+
+func TestActivity(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates Templates
+		playback  *lyra.Playback
+		track     *lyra.Track
+		check     func(t *testing.T, details, state, smallImage, smallText string, timestamps bool)
+	}{
+		{
+			name:      "playing",
+			templates: DefaultTemplates,
+			playback:  &lyra.Playback{State: "playing", DurationMs: ms(545_000)},
+			track:     testTrack,
+			check: func(t *testing.T, details, state, smallImage, smallText string, timestamps bool) {
+				if details != "So What" || state != "Kind of Blue (1959)" {
+					t.Errorf("got %q / %q", details, state)
+				}
+				if smallImage != "playing" || smallText != "Playing" || !timestamps {
+					t.Errorf("got badge %q %q, timestamps %v", smallImage, smallText, timestamps)
+				}
+			},
+		},
+		{
+			name:      "paused",
+			templates: Templates{Details: "{{.Title}}", State: "{{.Album}}", PausedState: "Stopped at {{.Position}}"},
+			playback:  &lyra.Playback{State: "paused", PositionMs: 65_000, DurationMs: ms(545_000)},
+			track:     testTrack,
+			check: func(t *testing.T, details, state, smallImage, smallText string, timestamps bool) {
+				if state != "Stopped at 1:05" {
+					t.Errorf("state = %q", state)
+				}
+				if smallImage != PausedImage || smallText != "Paused" || timestamps {
+					t.Errorf("got badge %q %q, timestamps %v", smallImage, smallText, timestamps)
+				}
+			},
+		},
+		{
+			name:      "fallbacks",
+			templates: DefaultTemplates,
+			playback:  &lyra.Playback{State: "playing"},
+			track:     &lyra.Track{Title: "  "},
+			check: func(t *testing.T, details, state, smallImage, smallText string, timestamps bool) {
+				if details != "Unknown Title" || state != "" {
+					t.Errorf("got %q / %q", details, state)
+				}
+			},
+		},
+		{
+			name:      "live badge",
+			templates: Templates{Details: "{{.Title}}", LiveBadge: true, LiveImage: "live"},
+			playback:  &lyra.Playback{State: "playing"},
+			track:     &lyra.Track{Title: "Radio"},
+			check: func(t *testing.T, details, state, smallImage, smallText string, timestamps bool) {
+				if smallImage != "live" || smallText != "Live" || !timestamps {
+					t.Errorf("got badge %q %q, timestamps %v", smallImage, smallText, timestamps)
+				}
+			},
+		},
+		{
+			name:      "broken template is left out",
+			templates: Templates{Details: "{{.Title", State: "{{.Album}}"},
+			playback:  &lyra.Playback{State: "playing"},
+			track:     testTrack,
+			check: func(t *testing.T, details, state, smallImage, smallText string, timestamps bool) {
+				if details != "" || state != "Kind of Blue" {
+					t.Errorf("got %q / %q", details, state)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := tt.templates.Activity(tt.playback, NewData(tt.playback, tt.track, ""), "cover", "")
+			tt.check(t, a.Details, a.State, a.Assets.SmallImage, a.Assets.SmallText, a.Timestamps != nil)
+		})
+	}
+}
+
+func TestActivityButtons(t *testing.T) {
+	templates := DefaultTemplates
+	templates.Buttons = []Button{
+		{Label: "Search", URL: "https://example.com/?q={{.Artist}}+{{.Title}}"},
+		{Label: "", URL: "https://example.com/skipped"},
+		{Label: "Album", URL: "https://example.com/a/{{.AlbumID}}"},
+		{Label: "Third", URL: "https://example.com/third"},
+	}
+	playback := &lyra.Playback{State: "playing"}
+	a := templates.Activity(playback, NewData(playback, testTrack, ""), "", "")
+	if len(a.Buttons) != MaxButtons {
+		t.Fatalf("got %d buttons, want %d", len(a.Buttons), MaxButtons)
+	}
+	if want := "https://example.com/?q=Miles+Davis%2C+John+Coltrane+So+What"; a.Buttons[0].URL != want {
+		t.Errorf("URL = %q, want %q", a.Buttons[0].URL, want)
+	}
+	if a.Buttons[1].Label != "Album" || a.Buttons[1].URL != "https://example.com/a/3" {
+		t.Errorf("second button = %+v", a.Buttons[1])
+	}
+}
@@ -0,0 +1,102 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package presence
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// locale is how the locale-aware template functions write durations,
+// dates, and numbers.
+type locale struct {
+	printer *message.Printer
+	// hours, minutes, and seconds format each part of a spelled-out
+	// duration.
+	hours, minutes, seconds string
+	// dateLayout is a time layout with "Jan" standing in for the month
+	// name, which comes from months.
+	dateLayout string
+	months     [12]string
+}
+
+var locales = map[string]locale{
+	"en": {
+		hours: "%d h", minutes: "%d min", seconds: "%d s",
+		dateLayout: "Jan 2, 2006",
+		months:     [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+	},
+	"de": {
+		hours: "%d Std.", minutes: "%d Min.", seconds: "%d Sek.",
+		dateLayout: "2. Jan 2006",
+		months:     [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+	},
+	"es": {
+		hours: "%d h", minutes: "%d min", seconds: "%d s",
+		dateLayout: "2 Jan 2006",
+		months:     [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+	},
+	"fr": {
+		hours: "%d h", minutes: "%d min", seconds: "%d s",
+		dateLayout: "2 Jan 2006",
+		months:     [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+	},
+}
+
+var currentLocale atomic.Pointer[locale]
+
+func init() {
+	SetLanguage(language.English)
+}
+
+// SetLanguage makes the locale-aware template functions follow tag's
+// conventions, or English's for languages without their own.
+func SetLanguage(tag language.Tag) {
+	base, _ := tag.Base()
+	l, ok := locales[base.String()]
+	if !ok {
+		l = locales["en"]
+	}
+	l.printer = message.NewPrinter(tag)
+	currentLocale.Store(&l)
+}
+
+// FormatLongDuration spells out milliseconds with units, e.g. "4 min 5 s",
+// leaving out parts that are zero.
+func FormatLongDuration(ms int64) string {
+	l := currentLocale.Load()
+	d := time.Duration(ms) * time.Millisecond
+	h, m, s := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	var parts []string
+	if h > 0 {
+		parts = append(parts, fmt.Sprintf(l.hours, h))
+	}
+	if m > 0 {
+		parts = append(parts, fmt.Sprintf(l.minutes, m))
+	}
+	if s > 0 || len(parts) == 0 {
+		parts = append(parts, fmt.Sprintf(l.seconds, s))
+	}
+	return strings.Join(parts, " ")
+}
+
+// FormatDate writes t as a date the way the language does, e.g.
+// "Mar 7, 2024" or "7. März 2024".
+func FormatDate(t time.Time) string {
+	l := currentLocale.Load()
+	layout := strings.Replace(l.dateLayout, "Jan", "\x00", 1)
+	return strings.Replace(t.Format(layout), "\x00", l.months[t.Month()-1], 1)
+}
+
+// FormatNumber writes n with the language's digit grouping, e.g. "1,234"
+// or "1.234".
+func FormatNumber(n any) string {
+	return currentLocale.Load().printer.Sprint(n)
+}
@@ -0,0 +1,40 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package presence
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+func TestLocale(t *testing.T) {
+	defer SetLanguage(language.English)
+	date := time.Date(2024, time.March, 7, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		tag          language.Tag
+		longDuration string
+		date         string
+		number       string
+	}{
+		{language.English, "1 h 5 s", "Mar 7, 2024", "1,234"},
+		{language.German, "1 Std. 5 Sek.", "7. März 2024", "1.234"},
+		{language.French, "1 h 5 s", "7 mars 2024", "1 234"},
+		{language.Japanese, "1 h 5 s", "Mar 7, 2024", "1,234"},
+	}
+	for _, tt := range tests {
+		SetLanguage(tt.tag)
+		if got := FormatLongDuration(3_605_000); got != tt.longDuration {
+			t.Errorf("%s: FormatLongDuration = %q, want %q", tt.tag, got, tt.longDuration)
+		}
+		if got := FormatDate(date); got != tt.date {
+			t.Errorf("%s: FormatDate = %q, want %q", tt.tag, got, tt.date)
+		}
+		if got := FormatNumber(1234); got != tt.number {
+			t.Errorf("%s: FormatNumber = %q, want %q", tt.tag, got, tt.number)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package presence turns Lyra playback into text and Discord activities,
+// through user-supplied templates.
+package presence
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"lyra-rpc/pkg/lyra"
+)
+
+// Data is what user-supplied templates can refer to, e.g. {{.Artist}} or
+// {{.Title}}.
+type Data struct {
+	TrackID    int64    `json:"track_id"`
+	Title      string   `json:"title"`
+	Artist     string   `json:"artist"`
+	Artists    []string `json:"artists"`
+	AlbumID    int64    `json:"album_id"`
+	Album      string   `json:"album"`
+	Year       int      `json:"year"`
+	State      string   `json:"state"`
+	ImageURL   string   `json:"image_url"`
+	PositionMs int64    `json:"position_ms"`
+	DurationMs int64    `json:"duration_ms"`
+	// Position and Duration are formatted as m:ss, or h:mm:ss for anything
+	// an hour or longer. Duration is empty if Lyra doesn't know it.
+	Position string `json:"position"`
+	Duration string `json:"duration"`
+	// Listeners is how many other users are playing the same track or
+	// album on a shared server.
+	Listeners int `json:"listeners"`
+	// Live is set for streams with no set length, such as internet radio.
+	Live bool `json:"live"`
+	// StartedAt is when the track started playing, going by the position
+	// Lyra last reported.
+	StartedAt time.Time `json:"started_at"`
+}
+
+// NewData describes playback of track. imageURL is the artwork's public URL,
+// if it has one.
+func NewData(playback *lyra.Playback, track *lyra.Track, imageURL string) Data {
+	data := Data{
+		TrackID:    track.DbID,
+		Title:      track.Title,
+		State:      playback.State,
+		ImageURL:   imageURL,
+		PositionMs: playback.EffectivePositionMs(),
+	}
+	for _, a := range track.Artists {
+		if name := strings.TrimSpace(a.ArtistName); name != "" {
+			data.Artists = append(data.Artists, name)
+		}
+	}
+	data.Artist = strings.Join(data.Artists, ", ")
+	if len(track.Albums) > 0 {
+		album := track.Albums[0]
+		data.AlbumID = album.DbID
+		data.Album = album.AlbumTitle
+		data.Year = album.Year
+	}
+	data.Position = FormatDuration(data.PositionMs)
+	reportedAt := time.Now()
+	if playback.UpdatedAtMs != 0 {
+		reportedAt = time.UnixMilli(playback.UpdatedAtMs)
+	}
+	data.StartedAt = reportedAt.Add(-time.Duration(playback.PositionMs) * time.Millisecond)
+	if playback.DurationMs != nil {
+		data.DurationMs = *playback.DurationMs
+		data.Duration = FormatDuration(data.DurationMs)
+	} else {
+		data.Live = true
+	}
+	return data
+}
+
+// FormatDuration formats milliseconds as m:ss, or h:mm:ss for anything an
+// hour or longer.
+func FormatDuration(ms int64) string {
+	seconds := ms / 1000
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// Funcs are available to every template. Functions taking the value
+// last work in pipelines, e.g. {{.Title | truncate 32 | upper}}.
+var Funcs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	// truncate shortens s to n characters, ending in an ellipsis if
+	// anything was cut.
+	"truncate": func(n int, s string) string {
+		runes := []rune(s)
+		if n <= 0 || len(runes) <= n {
+			return s
+		}
+		return string(runes[:n-1]) + "…"
+	},
+	// duration formats milliseconds as m:ss, like .Position.
+	"duration": FormatDuration,
+	// longDuration, date, and number follow the configured language, as
+	// in "4 min 5 s", "Mar 7, 2024", and "1,234".
+	"longDuration": FormatLongDuration,
+	"date":         FormatDate,
+	"number":       FormatNumber,
+	"replace": func(old, new, s string) string {
+		return strings.ReplaceAll(s, old, new)
+	},
+	// regexReplace replaces matches of pattern, which can refer to groups
+	// as $1 in repl, e.g. {{.Title | regexReplace ` \(.*Remaster.*\)` ""}}.
+	"regexReplace": func(pattern, repl, s string) (string, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", err
+		}
+		return re.ReplaceAllString(s, repl), nil
+	},
+	"join": func(sep string, s []string) string {
+		return strings.Join(s, sep)
+	},
+	// default returns def if s is empty.
+	"default": func(def, s string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	},
+	// json quotes a value for use inside a JSON template, e.g.
+	// {"title": {{json .Title}}}.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// Render executes text against data. Templates come from the config file,
+// so they're parsed on use rather than up front.
+func Render(text string, data any) (string, error) {
+	tmpl, err := template.New("").Funcs(Funcs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
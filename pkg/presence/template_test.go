@@ -0,0 +1,105 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package presence
+
+import (
+	"testing"
+	"time"
+
+	"lyra-rpc/pkg/lyra"
+)
+
+func ms(n int64) *int64 { return &n }
+
+var testTrack = &lyra.Track{
+	DbID:    7,
+	Title:   "So What",
+	Artists: []lyra.Artist{{ArtistName: "Miles Davis"}, {ArtistName: " "}, {ArtistName: "John Coltrane"}},
+	Albums:  []lyra.Album{{DbID: 3, AlbumTitle: "Kind of Blue", Year: 1959}},
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		ms   int64
+		want string
+	}{
+		{0, "0:00"},
+		{59_999, "0:59"},
+		{65_000, "1:05"},
+		{3_599_000, "59:59"},
+		{3_600_000, "1:00:00"},
+		{3_725_000, "1:02:05"},
+	}
+	for _, tt := range tests {
+		if got := FormatDuration(tt.ms); got != tt.want {
+			t.Errorf("FormatDuration(%d) = %q, want %q", tt.ms, got, tt.want)
+		}
+	}
+}
+
+func TestNewData(t *testing.T) {
+	data := NewData(&lyra.Playback{State: "paused", PositionMs: 65_000, DurationMs: ms(545_000)}, testTrack, "https://example.com/c.png")
+	if data.Artist != "Miles Davis, John Coltrane" || len(data.Artists) != 2 {
+		t.Errorf("artists = %q %v, want blank names skipped", data.Artist, data.Artists)
+	}
+	if data.Album != "Kind of Blue" || data.AlbumID != 3 || data.Year != 1959 {
+		t.Errorf("album = %q %d %d", data.Album, data.AlbumID, data.Year)
+	}
+	if data.Position != "1:05" || data.Duration != "9:05" || data.Live {
+		t.Errorf("position %q, duration %q, live %v", data.Position, data.Duration, data.Live)
+	}
+
+	live := NewData(&lyra.Playback{State: "playing"}, &lyra.Track{Title: "Radio"}, "")
+	if !live.Live || live.Duration != "" {
+		t.Errorf("a playback without a length should be live, got live %v, duration %q", live.Live, live.Duration)
+	}
+}
+
+func TestRender(t *testing.T) {
+	reportedAt := time.Date(2024, time.March, 7, 12, 0, 0, 0, time.Local)
+	playback := &lyra.Playback{State: "playing", PositionMs: 65_000, UpdatedAtMs: reportedAt.UnixMilli(), DurationMs: ms(545_000)}
+	data := NewData(playback, testTrack, "")
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"{{.Title}} by {{.Artist}}", "So What by Miles Davis, John Coltrane"},
+		{"{{.Title | upper}}", "SO WHAT"},
+		{"{{.Album | truncate 6}}", "Kind …"},
+		{"{{.Album | truncate 20}}", "Kind of Blue"},
+		{"{{.Title | replace \"What\" \"Who\"}}", "So Who"},
+		{"{{.Album | regexReplace \" of (.*)\" \" in $1\"}}", "Kind in Blue"},
+		{"{{.Artists | join \" & \"}}", "Miles Davis & John Coltrane"},
+		{"{{\"\" | default \"none\"}}", "none"},
+		{"{{json .Title}}", `"So What"`},
+		{"{{duration .DurationMs}}", "9:05"},
+		{"{{if .Live}}live{{else}}{{.Duration}}{{end}}", "9:05"},
+		{"{{date .StartedAt}}", "Mar 7, 2024"},
+		{"{{.StartedAt.Format \"15:04:05\"}}", "11:58:55"},
+	}
+	for _, tt := range tests {
+		got, err := Render(tt.text, data)
+		if err != nil {
+			t.Errorf("Render(%q): %v", tt.text, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Render(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+
+	for _, text := range []string{"{{.Title", "{{.Nope}}", "{{regexReplace \"(\" \"\" .Title}}"} {
+		if _, err := Render(text, data); err == nil {
+			t.Errorf("Render(%q) succeeded, want an error", text)
+		}
+	}
+}
+
+func TestQueryEscaped(t *testing.T) {
+	data := QueryEscaped(Data{Title: "A&B", Artist: "C D", Artists: []string{"C D"}})
+	if data.Title != "A%26B" || data.Artist != "C+D" || data.Artists[0] != "C+D" {
+		t.Errorf("got %q %q %v", data.Title, data.Artist, data.Artists)
+	}
+}
@@ -0,0 +1,110 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// Catbox and litterbox share an API and differ only in endpoint and form
+// fields.
+const (
+	catboxEndpoint    = "https://catbox.moe/user/api.php"
+	litterboxEndpoint = "https://litterbox.catbox.moe/resources/internals/api.php"
+)
+
+// StatusError reports an unexpected HTTP status from an image host.
+type StatusError struct {
+	API    string
+	Status int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned status %d", e.API, e.Status)
+}
+
+// HTTPStatus returns the status code, so callers can tell rate limits and
+// server errors apart without knowing this type.
+func (e *StatusError) HTTPStatus() int {
+	return e.Status
+}
+
+// Catbox uploads to catbox.moe, where files are kept indefinitely.
+// UserHash optionally ties uploads to an account.
+type Catbox struct {
+	UserHash string
+	HTTP     *http.Client
+}
+
+func (c *Catbox) Upload(ctx context.Context, image []byte, meta Meta) (string, error) {
+	fields := map[string]string{"reqtype": "fileupload", "userhash": c.UserHash}
+	return postCatbox(ctx, httpClient(c.HTTP), catboxEndpoint, fields, image, meta.Filename)
+}
+
+// Litterbox uploads to litterbox.catbox.moe, which deletes files after
+// Time: "1h", "12h", "24h", or "72h". It defaults to 72 hours.
+type Litterbox struct {
+	Time string
+	HTTP *http.Client
+}
+
+func (c *Litterbox) Upload(ctx context.Context, image []byte, meta Meta) (string, error) {
+	expiry := c.Time
+	if expiry == "" {
+		expiry = "72h"
+	}
+	fields := map[string]string{"reqtype": "fileupload", "time": expiry}
+	return postCatbox(ctx, httpClient(c.HTTP), litterboxEndpoint, fields, image, meta.Filename)
+}
+
+// postCatbox uploads image to a catbox-style endpoint and returns its URL.
+// Empty fields are left out of the form.
+func postCatbox(ctx context.Context, httpClient *http.Client, endpoint string, fields map[string]string, image []byte, filename string) (string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if value != "" {
+			writer.WriteField(name, value)
+		}
+	}
+
+	part, err := writer.CreateFormFile("fileToUpload", filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(image); err != nil {
+		return "", err
+	}
+	writer.Close()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &StatusError{API: endpoint, Status: resp.StatusCode}
+	}
+
+	urlBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(urlBytes)), nil
+}
@@ -0,0 +1,58 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package uploader re-hosts images somewhere Discord can load them from.
+package uploader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/gif"
+)
+
+// Format describes an image well enough to upload it under the right
+// file extension.
+type Format struct {
+	Ext      string
+	Animated bool
+}
+
+// DetectFormat sniffs the image type from its contents, defaulting to
+// JPEG for anything unrecognized.
+func DetectFormat(data []byte) Format {
+	switch {
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		return Format{Ext: "gif", Animated: isAnimatedGIF(data)}
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return Format{Ext: "png", Animated: isAPNG(data)}
+	case len(data) >= 21 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		// Extended WebP files carry an animation flag in the VP8X header.
+		return Format{Ext: "webp", Animated: string(data[12:16]) == "VP8X" && data[20]&0x02 != 0}
+	default:
+		return Format{Ext: "jpg"}
+	}
+}
+
+func isAnimatedGIF(data []byte) bool {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	return err == nil && len(g.Image) > 1
+}
+
+// isAPNG reports whether a PNG has an animation control chunk, which must
+// come before the first image data chunk.
+func isAPNG(data []byte) bool {
+	pos := 8
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		chunk := string(data[pos+4 : pos+8])
+		switch chunk {
+		case "acTL":
+			return true
+		case "IDAT":
+			return false
+		}
+		pos += 12 + length
+	}
+	return false
+}
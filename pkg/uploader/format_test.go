@@ -0,0 +1,81 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package uploader
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+func encodeGIF(t *testing.T, frames int) []byte {
+	t.Helper()
+	g := &gif.GIF{}
+	for range frames {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black, color.White}))
+		g.Delay = append(g.Delay, 10)
+	}
+	var b bytes.Buffer
+	if err := gif.EncodeAll(&b, g); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func encodePNG(t *testing.T) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// withChunk inserts a chunk right after a PNG's IHDR. The CRC isn't
+// checked when sniffing, so it's left zero.
+func withChunk(data []byte, typ string) []byte {
+	const ihdrEnd = 8 + 12 + 13
+	chunk := append([]byte{0, 0, 0, 0}, typ...)
+	chunk = append(chunk, 0, 0, 0, 0)
+	out := append([]byte{}, data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...)
+}
+
+func webp(chunk string, flags byte) []byte {
+	data := []byte("RIFF\x00\x00\x00\x00WEBP" + chunk + "\x0a\x00\x00\x00")
+	return append(data, flags, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+}
+
+func TestDetectFormat(t *testing.T) {
+	stillPNG := encodePNG(t)
+	tests := []struct {
+		name string
+		data []byte
+		want Format
+	}{
+		{"gif", encodeGIF(t, 1), Format{Ext: "gif"}},
+		{"animated gif", encodeGIF(t, 2), Format{Ext: "gif", Animated: true}},
+		{"png", stillPNG, Format{Ext: "png"}},
+		{"apng", withChunk(stillPNG, "acTL"), Format{Ext: "png", Animated: true}},
+		{"png with other chunks", withChunk(stillPNG, "tEXt"), Format{Ext: "png"}},
+		{"webp", webp("VP8 ", 0), Format{Ext: "webp"}},
+		{"extended webp", webp("VP8X", 0x10), Format{Ext: "webp"}},
+		{"animated webp", webp("VP8X", 0x02), Format{Ext: "webp", Animated: true}},
+		{"jpeg", []byte("\xff\xd8\xff\xe0"), Format{Ext: "jpg"}},
+		{"empty", nil, Format{Ext: "jpg"}},
+		{"truncated riff", []byte("RIFF\x00\x00\x00\x00WEBP"), Format{Ext: "jpg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectFormat(tt.data); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Imgur uploads to imgur, either anonymously with ClientID or, given an
+// AccessToken, to that account. RefreshToken and ClientSecret let an expired
+// token be renewed, and Album groups account uploads into an album of that
+// title.
+type Imgur struct {
+	ClientID     string
+	ClientSecret string
+	AccessToken  string
+	RefreshToken string
+	Album        string
+	HTTP         *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	albumID     string
+}
+
+func (c *Imgur) Upload(ctx context.Context, image []byte, meta Meta) (string, error) {
+	albumID, err := c.album(ctx)
+	if err != nil {
+		log.Printf("Error finding imgur album, uploading without one: %v", err)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("type", "file")
+	if albumID != "" {
+		writer.WriteField("album", albumID)
+	}
+
+	part, err := writer.CreateFormFile("image", meta.Filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(image); err != nil {
+		return "", err
+	}
+	writer.Close()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.imgur.com/3/image", &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &StatusError{API: "imgur API", Status: resp.StatusCode}
+	}
+
+	var result struct {
+		Data struct {
+			Link string `json:"link"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	return result.Data.Link, nil
+}
+
+// do authorizes req as the configured account, or anonymously
+// with the client ID, refreshing the access token once if it was rejected.
+// Requests with bodies must set GetBody for the retry to work.
+func (c *Imgur) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	token := c.accessToken
+	if token == "" {
+		token = c.AccessToken
+	}
+	c.mu.Unlock()
+
+	if token == "" {
+		req.Header.Set("Authorization", "Client-ID "+c.ClientID)
+		return httpClient(c.HTTP).Do(req)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := httpClient(c.HTTP).Do(req)
+	if err != nil || (resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden) {
+		return resp, err
+	}
+	if c.RefreshToken == "" || req.GetBody == nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	token, err = c.refresh(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("refreshing imgur token: %w", err)
+	}
+	retry := req.Clone(req.Context())
+	if retry.Body, err = req.GetBody(); err != nil {
+		return nil, err
+	}
+	retry.Header.Set("Authorization", "Bearer "+token)
+	return httpClient(c.HTTP).Do(retry)
+}
+
+func (c *Imgur) refresh(ctx context.Context) (string, error) {
+	form := url.Values{}
+	form.Set("refresh_token", c.RefreshToken)
+	form.Set("client_id", c.ClientID)
+	form.Set("client_secret", c.ClientSecret)
+	form.Set("grant_type", "refresh_token")
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.imgur.com/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := httpClient(c.HTTP).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &StatusError{API: "imgur token API", Status: resp.StatusCode}
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.accessToken = result.AccessToken
+	c.mu.Unlock()
+	log.Println("Refreshed imgur access token.")
+	return result.AccessToken, nil
+}
+
+// album returns the ID of the album covers are grouped into, finding or
+// creating it on first use. Anonymous uploads aren't grouped.
+func (c *Imgur) album(ctx context.Context) (string, error) {
+	if c.AccessToken == "" || c.Album == "" {
+		return "", nil
+	}
+
+	c.mu.Lock()
+	id := c.albumID
+	c.mu.Unlock()
+	if id != "" {
+		return id, nil
+	}
+
+	id, err := c.findAlbum(ctx, c.Album)
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		if id, err = c.createAlbum(ctx, c.Album); err != nil {
+			return "", err
+		}
+		log.Printf("Created imgur album %q.", c.Album)
+	}
+
+	c.mu.Lock()
+	c.albumID = id
+	c.mu.Unlock()
+	return id, nil
+}
+
+func (c *Imgur) findAlbum(ctx context.Context, title string) (string, error) {
+	for page := 0; ; page++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://api.imgur.com/3/account/me/albums/%d", page), nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := c.do(ctx, req)
+		if err != nil {
+			return "", err
+		}
+
+		var result struct {
+			Data []struct {
+				ID    string `json:"id"`
+				Title string `json:"title"`
+			} `json:"data"`
+		}
+		err = decodeImgurResponse(resp, "imgur albums API", &result)
+		if err != nil {
+			return "", err
+		}
+
+		if len(result.Data) == 0 {
+			return "", nil
+		}
+		for _, album := range result.Data {
+			if album.Title == title {
+				return album.ID, nil
+			}
+		}
+	}
+}
+
+func (c *Imgur) createAlbum(ctx context.Context, title string) (string, error) {
+	form := url.Values{}
+	form.Set("title", title)
+	form.Set("privacy", "hidden")
+	encoded := form.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.imgur.com/3/album", strings.NewReader(encoded))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := decodeImgurResponse(resp, "imgur album API", &result); err != nil {
+		return "", err
+	}
+	return result.Data.ID, nil
+}
+
+func decodeImgurResponse(resp *http.Response, api string, v any) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{API: api, Status: resp.StatusCode}
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,73 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package uploader
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Meta describes an image being uploaded.
+type Meta struct {
+	Format Format
+	// Filename is the name to upload the image as, e.g. "cover.png".
+	Filename string
+}
+
+// Uploader re-hosts an image and returns its public URL. Implementations
+// should give up once ctx is done.
+type Uploader interface {
+	Upload(ctx context.Context, image []byte, meta Meta) (string, error)
+}
+
+// Func adapts an ordinary function to Uploader.
+type Func func(ctx context.Context, image []byte, meta Meta) (string, error)
+
+func (f Func) Upload(ctx context.Context, image []byte, meta Meta) (string, error) {
+	return f(ctx, image, meta)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Uploader{}
+)
+
+// Register makes u available as name, replacing whatever was registered
+// under that name before.
+func Register(name string, u Uploader) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = u
+}
+
+// Lookup returns the uploader registered as name.
+func Lookup(name string) (Uploader, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	u, ok := registry[name]
+	return u, ok
+}
+
+// Names lists the registered uploaders in alphabetical order.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// httpClient returns c, or the default client if it's nil.
+func httpClient(c *http.Client) *http.Client {
+	if c == nil {
+		return http.DefaultClient
+	}
+	return c
+}
@@ -0,0 +1,44 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package uploader
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	defer func() {
+		registryMu.Lock()
+		registry = map[string]Uploader{}
+		registryMu.Unlock()
+	}()
+
+	constant := func(url string) Uploader {
+		return Func(func(ctx context.Context, image []byte, meta Meta) (string, error) {
+			return url, nil
+		})
+	}
+	Register("zeta", constant("https://z"))
+	Register("alpha", constant("https://a"))
+	Register("alpha", constant("https://a2"))
+
+	if got, want := Names(), []string{"alpha", "zeta"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+	if _, ok := Lookup("missing"); ok {
+		t.Error("Lookup found an uploader that was never registered")
+	}
+
+	u, ok := Lookup("alpha")
+	if !ok {
+		t.Fatal("Lookup didn't find alpha")
+	}
+	url, err := u.Upload(context.Background(), nil, Meta{})
+	if err != nil || url != "https://a2" {
+		t.Errorf("Upload = %q, %v; want the later registration", url, err)
+	}
+}